@@ -0,0 +1,5 @@
+// Package accounting records the sessions of a PAM transaction in the login
+// accounting files, utmp, wtmp and lastlog, and the failed logins in btmp,
+// as login(1) does, so that the users of Go login managers are listed by
+// who, last and lastb. It is only available on Linux.
+package accounting
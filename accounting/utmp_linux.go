@@ -0,0 +1,413 @@
+package accounting
+
+//#include <errno.h>
+//#include <fcntl.h>
+//#include <lastlog.h>
+//#include <stdlib.h>
+//#include <string.h>
+//#include <unistd.h>
+//#include <utmp.h>
+//
+//static int acct_write(const char *utmp, const char *wtmp, short type,
+//                      int pid, const char *line, const char *id,
+//                      const char *user, const char *host, long sec,
+//                      long usec)
+//{
+//	struct utmp ut;
+//
+//	memset(&ut, 0, sizeof(ut));
+//	ut.ut_type = type;
+//	ut.ut_pid = pid;
+//	strncpy(ut.ut_line, line, sizeof(ut.ut_line));
+//	strncpy(ut.ut_id, id, sizeof(ut.ut_id));
+//	strncpy(ut.ut_user, user, sizeof(ut.ut_user));
+//	strncpy(ut.ut_host, host, sizeof(ut.ut_host));
+//	ut.ut_tv.tv_sec = sec;
+//	ut.ut_tv.tv_usec = usec;
+//	if (utmp != NULL) {
+//		if (utmpname(utmp) != 0)
+//			return -1;
+//		setutent();
+//		if (pututline(&ut) == NULL) {
+//			int err = errno;
+//			endutent();
+//			errno = err;
+//			return -1;
+//		}
+//		endutent();
+//	}
+//	if (wtmp != NULL) {
+//		int fd = open(wtmp, O_WRONLY | O_APPEND);
+//		ssize_t n;
+//
+//		if (fd < 0)
+//			return -1;
+//		n = write(fd, &ut, sizeof(ut));
+//		close(fd);
+//		if (n != sizeof(ut))
+//			return -1;
+//	}
+//	return 0;
+//}
+//
+//static int acct_lastlog(const char *path, unsigned int uid, const char *line,
+//                        const char *host, long sec)
+//{
+//	struct lastlog ll;
+//	int fd;
+//	ssize_t n;
+//
+//	memset(&ll, 0, sizeof(ll));
+//	ll.ll_time = sec;
+//	strncpy(ll.ll_line, line, sizeof(ll.ll_line));
+//	strncpy(ll.ll_host, host, sizeof(ll.ll_host));
+//	fd = open(path, O_WRONLY);
+//	if (fd < 0)
+//		return -1;
+//	n = pwrite(fd, &ll, sizeof(ll), (off_t)uid * sizeof(ll));
+//	close(fd);
+//	return n == sizeof(ll) ? 0 : -1;
+//}
+//
+//static int acct_read(const char *path, struct utmp **entries)
+//{
+//	struct utmp *ut;
+//	int n = 0;
+//
+//	*entries = NULL;
+//	if (utmpname(path) != 0)
+//		return -1;
+//	setutent();
+//	errno = 0;
+//	while ((ut = getutent()) != NULL) {
+//		struct utmp *e = realloc(*entries, (n + 1) * sizeof(*e));
+//		if (e == NULL) {
+//			endutent();
+//			return -1;
+//		}
+//		*entries = e;
+//		e[n++] = *ut;
+//	}
+//	endutent();
+//	return n;
+//}
+//
+//static int acct_last_login(const char *path, unsigned int uid,
+//                           struct lastlog *ll)
+//{
+//	int fd = open(path, O_RDONLY);
+//	ssize_t n;
+//
+//	if (fd < 0)
+//		return -1;
+//	memset(ll, 0, sizeof(*ll));
+//	n = pread(fd, ll, sizeof(*ll), (off_t)uid * sizeof(*ll));
+//	close(fd);
+//	return n < 0 ? -1 : 0;
+//}
+import "C"
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/msteinert/pam"
+)
+
+// Type is the type of an accounting entry.
+type Type int16
+
+// Accounting entry types.
+const (
+	// UserProcess is the entry of an opened session.
+	UserProcess Type = C.USER_PROCESS
+	// DeadProcess is the entry of a closed session.
+	DeadProcess Type = C.DEAD_PROCESS
+	// LoginProcess is the entry of a failed login, as found in btmp.
+	LoginProcess Type = C.LOGIN_PROCESS
+)
+
+// Entry is an accounting entry.
+type Entry struct {
+	// Type is the type of the entry.
+	Type Type
+	// PID is the process identifier of the session leader.
+	PID int
+	// Tty is the terminal name, without the /dev/ prefix.
+	Tty string
+	// ID identifies the entry of the terminal in utmp, it is derived from
+	// Tty if empty.
+	ID string
+	// User is the user name.
+	User string
+	// Host is the remote host name.
+	Host string
+	// Time is the time of the event, the current time if zero.
+	Time time.Time
+}
+
+// Files are the accounting files to update, an empty path is skipped.
+type Files struct {
+	Utmp    string
+	Wtmp    string
+	Lastlog string
+	// Btmp records the failed logins.
+	Btmp string
+}
+
+// DefaultFiles are the system accounting files, used by the package level
+// functions.
+var DefaultFiles = Files{
+	Utmp:    "/var/run/utmp",
+	Wtmp:    "/var/log/wtmp",
+	Lastlog: "/var/log/lastlog",
+	Btmp:    "/var/log/btmp",
+}
+
+// utmpMu serializes the uses of utmpname, which is global.
+var utmpMu sync.Mutex
+
+// EntryFor returns the entry of the session of t, from its User, Tty and
+// Rhost items, for the current process.
+func EntryFor(t pam.TransactionHandle) (Entry, error) {
+	e := Entry{Type: UserProcess, PID: os.Getpid()}
+	var err error
+	if e.User, err = t.User(); err != nil {
+		return Entry{}, err
+	}
+	if e.Tty, err = t.Tty(); err != nil {
+		return Entry{}, err
+	}
+	if e.Host, err = t.Rhost(); err != nil {
+		return Entry{}, err
+	}
+	e.Tty = strings.TrimPrefix(e.Tty, "/dev/")
+	return e, nil
+}
+
+// normalize fills the defaults of e.
+func (e Entry) normalize() Entry {
+	e.Tty = strings.TrimPrefix(e.Tty, "/dev/")
+	if e.ID == "" {
+		e.ID = e.Tty
+		if len(e.ID) > 4 {
+			e.ID = e.ID[len(e.ID)-4:]
+		}
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	return e
+}
+
+// write writes e to the utmp and wtmp files, if not empty.
+func write(utmp, wtmp string, e Entry) error {
+	var cutmp, cwtmp *C.char
+	if utmp != "" {
+		cutmp = C.CString(utmp)
+		defer C.free(unsafe.Pointer(cutmp))
+	}
+	if wtmp != "" {
+		cwtmp = C.CString(wtmp)
+		defer C.free(unsafe.Pointer(cwtmp))
+	}
+	line, id := C.CString(e.Tty), C.CString(e.ID)
+	defer C.free(unsafe.Pointer(line))
+	defer C.free(unsafe.Pointer(id))
+	name, host := C.CString(e.User), C.CString(e.Host)
+	defer C.free(unsafe.Pointer(name))
+	defer C.free(unsafe.Pointer(host))
+	utmpMu.Lock()
+	defer utmpMu.Unlock()
+	r, err := C.acct_write(cutmp, cwtmp, C.short(e.Type), C.int(e.PID), line, id,
+		name, host, C.long(e.Time.Unix()), C.long(e.Time.Nanosecond()/1000))
+	if r != 0 {
+		return err
+	}
+	return nil
+}
+
+// Login records the opening of the session e: its entry is added to utmp
+// and wtmp and the last login of the user is updated in lastlog, if the
+// file exists.
+func (fs Files) Login(e Entry) error {
+	e = e.normalize()
+	e.Type = UserProcess
+	if err := write(fs.Utmp, fs.Wtmp, e); err != nil {
+		return err
+	}
+	if fs.Lastlog == "" {
+		return nil
+	}
+	if _, err := os.Stat(fs.Lastlog); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	u, err := user.Lookup(e.User)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return err
+	}
+	path, line, host := C.CString(fs.Lastlog), C.CString(e.Tty), C.CString(e.Host)
+	defer C.free(unsafe.Pointer(path))
+	defer C.free(unsafe.Pointer(line))
+	defer C.free(unsafe.Pointer(host))
+	if r, err := C.acct_lastlog(path, C.uint(uid), line, host, C.long(e.Time.Unix())); r != 0 {
+		return err
+	}
+	return nil
+}
+
+// Logout records the closing of the session e: its utmp entry is marked as
+// dead and a logout entry is added to wtmp.
+func (fs Files) Logout(e Entry) error {
+	e = e.normalize()
+	e.Type = DeadProcess
+	e.User, e.Host = "", ""
+	return write(fs.Utmp, fs.Wtmp, e)
+}
+
+// OpenSession opens the session of t, as OpenSession does, and records it
+// with Login. The returned entry is to be passed to CloseSession.
+func (fs Files) OpenSession(t pam.TransactionHandle, f pam.Flags) (Entry, error) {
+	e, err := EntryFor(t)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := t.OpenSession(f); err != nil {
+		return Entry{}, err
+	}
+	e.Time = time.Now()
+	return e, fs.Login(e)
+}
+
+// CloseSession closes the session of t, as CloseSession does, and records
+// the logout of e.
+func (fs Files) CloseSession(t pam.TransactionHandle, f pam.Flags, e Entry) error {
+	return errors.Join(t.CloseSession(f), fs.Logout(e))
+}
+
+// Failed records the failed login e in btmp, an empty user is recorded as
+// "(unknown)" as login does.
+func (fs Files) Failed(e Entry) error {
+	if fs.Btmp == "" {
+		return nil
+	}
+	e = e.normalize()
+	e.Type = LoginProcess
+	if e.User == "" {
+		e.User = "(unknown)"
+	}
+	return write("", fs.Btmp, e)
+}
+
+// Authenticate authenticates the user of t, as Authenticate does, and
+// records the failure in btmp with the User, Tty and Rhost items of t.
+// The returned error is the one of the authentication, unless recording
+// the failure fails too.
+func (fs Files) Authenticate(t pam.TransactionHandle, f pam.Flags) error {
+	err := t.Authenticate(f)
+	if err == nil {
+		return nil
+	}
+	e, eerr := EntryFor(t)
+	if eerr != nil {
+		return errors.Join(err, eerr)
+	}
+	return errors.Join(err, fs.Failed(e))
+}
+
+// Login records the opening of a session in the system files.
+func Login(e Entry) error {
+	return DefaultFiles.Login(e)
+}
+
+// Logout records the closing of a session in the system files.
+func Logout(e Entry) error {
+	return DefaultFiles.Logout(e)
+}
+
+// OpenSession opens the session of t and records it in the system files.
+func OpenSession(t pam.TransactionHandle, f pam.Flags) (Entry, error) {
+	return DefaultFiles.OpenSession(t, f)
+}
+
+// CloseSession closes the session of t and records it in the system files.
+func CloseSession(t pam.TransactionHandle, f pam.Flags, e Entry) error {
+	return DefaultFiles.CloseSession(t, f, e)
+}
+
+// Failed records a failed login in the system btmp file.
+func Failed(e Entry) error {
+	return DefaultFiles.Failed(e)
+}
+
+// Authenticate authenticates the user of t and records the failure in the
+// system btmp file.
+func Authenticate(t pam.TransactionHandle, f pam.Flags) error {
+	return DefaultFiles.Authenticate(t, f)
+}
+
+// Read returns the entries of the utmp, wtmp or btmp file path.
+func Read(path string) ([]Entry, error) {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	var p *C.struct_utmp
+	utmpMu.Lock()
+	n, err := C.acct_read(cpath, &p)
+	utmpMu.Unlock()
+	defer C.free(unsafe.Pointer(p))
+	if n < 0 {
+		return nil, err
+	}
+	var entries []Entry
+	for _, ut := range unsafe.Slice(p, n) {
+		entries = append(entries, Entry{
+			Type: Type(ut.ut_type),
+			PID:  int(ut.ut_pid),
+			Tty:  field(ut.ut_line[:]),
+			ID:   field(ut.ut_id[:]),
+			User: field(ut.ut_user[:]),
+			Host: field(ut.ut_host[:]),
+			Time: time.Unix(int64(ut.ut_tv.tv_sec), int64(ut.ut_tv.tv_usec)*1000),
+		})
+	}
+	return entries, nil
+}
+
+// LastLogin returns the last login of the user uid recorded in the lastlog
+// file path, the entry has a zero Time if there is none.
+func LastLogin(path string, uid int) (Entry, error) {
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	var ll C.struct_lastlog
+	if r, err := C.acct_last_login(cpath, C.uint(uid), &ll); r != 0 {
+		return Entry{}, err
+	}
+	e := Entry{Tty: field(ll.ll_line[:]), Host: field(ll.ll_host[:])}
+	if ll.ll_time != 0 {
+		e.Time = time.Unix(int64(ll.ll_time), 0)
+	}
+	return e, nil
+}
+
+// field returns the string stored in a fixed size, possibly not terminated,
+// C field.
+func field(b []C.char) string {
+	s := make([]byte, 0, len(b))
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+		s = append(s, byte(c))
+	}
+	return string(s)
+}
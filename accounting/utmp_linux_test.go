@@ -0,0 +1,130 @@
+package accounting
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func testFiles(t *testing.T) Files {
+	dir := t.TempDir()
+	fs := Files{
+		Utmp:    filepath.Join(dir, "utmp"),
+		Wtmp:    filepath.Join(dir, "wtmp"),
+		Lastlog: filepath.Join(dir, "lastlog"),
+		Btmp:    filepath.Join(dir, "btmp"),
+	}
+	for _, f := range []string{fs.Utmp, fs.Wtmp, fs.Lastlog, fs.Btmp} {
+		if err := os.WriteFile(f, nil, 0o644); err != nil {
+			t.Fatalf("writefile #error: %v", err)
+		}
+	}
+	return fs
+}
+
+func TestSession(t *testing.T) {
+	u, err := user.Lookup("test")
+	if err != nil {
+		t.Skipf("lookup #error: %v", err)
+	}
+	fs := testFiles(t)
+	tx, err := pam.StartWithOptions("login-service", "test", nil,
+		pam.WithConfDir("../test-services"), pam.WithTTY("/dev/pts/9"),
+		pam.WithRHost("example.com"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	e, err := fs.OpenSession(tx, 0)
+	if err != nil {
+		t.Fatalf("opensession #error: %v", err)
+	}
+	utmp, err := Read(fs.Utmp)
+	if err != nil {
+		t.Fatalf("read #error: %v", err)
+	}
+	if len(utmp) != 1 || utmp[0].Type != UserProcess || utmp[0].User != "test" ||
+		utmp[0].Tty != "pts/9" || utmp[0].ID != "ts/9" || utmp[0].Host != "example.com" ||
+		utmp[0].PID != os.Getpid() {
+		t.Fatalf("read #unexpected entries: %+v", utmp)
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	last, err := LastLogin(fs.Lastlog, uid)
+	if err != nil {
+		t.Fatalf("lastlogin #error: %v", err)
+	}
+	if last.Tty != "pts/9" || last.Host != "example.com" || last.Time.Unix() != e.Time.Unix() {
+		t.Fatalf("lastlogin #unexpected entry: %+v", last)
+	}
+	if err := fs.CloseSession(tx, 0, e); err != nil {
+		t.Fatalf("closesession #error: %v", err)
+	}
+	utmp, err = Read(fs.Utmp)
+	if err != nil {
+		t.Fatalf("read #error: %v", err)
+	}
+	if len(utmp) != 1 || utmp[0].Type != DeadProcess {
+		t.Fatalf("read #unexpected entries: %+v", utmp)
+	}
+	wtmp, err := Read(fs.Wtmp)
+	if err != nil {
+		t.Fatalf("read #error: %v", err)
+	}
+	if len(wtmp) != 2 || wtmp[0].Type != UserProcess || wtmp[1].Type != DeadProcess ||
+		wtmp[1].Tty != "pts/9" {
+		t.Fatalf("read #unexpected entries: %+v", wtmp)
+	}
+}
+
+func TestLoginWithoutLastlog(t *testing.T) {
+	fs := testFiles(t)
+	fs.Lastlog = filepath.Join(t.TempDir(), "missing")
+	if err := fs.Login(Entry{User: "nobody-at-all", Tty: "tty1"}); err != nil {
+		t.Fatalf("login #error: %v", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	fs := testFiles(t)
+	tx, err := pam.StartWithOptions("deny-service", "", nil,
+		pam.WithConfDir("../test-services"), pam.WithTTY("ssh"),
+		pam.WithRHost("192.0.2.1"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := fs.Authenticate(tx, 0); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", pam.ErrAuth, err)
+	}
+	if err := tx.SetUser("test"); err != nil {
+		t.Fatalf("setuser #error: %v", err)
+	}
+	if err := fs.Authenticate(tx, 0); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", pam.ErrAuth, err)
+	}
+	btmp, err := Read(fs.Btmp)
+	if err != nil {
+		t.Fatalf("read #error: %v", err)
+	}
+	if len(btmp) != 2 || btmp[0].User != "(unknown)" || btmp[1].User != "test" ||
+		btmp[1].Type != LoginProcess || btmp[1].Tty != "ssh" || btmp[1].Host != "192.0.2.1" {
+		t.Fatalf("read #unexpected entries: %+v", btmp)
+	}
+	login, err := pam.StartWithOptions("login-service", "test", nil,
+		pam.WithConfDir("../test-services"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer login.End()
+	if err := fs.Authenticate(login, 0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if btmp, _ := Read(fs.Btmp); len(btmp) != 2 {
+		t.Fatalf("read #unexpected entries: %+v", btmp)
+	}
+}
@@ -0,0 +1,38 @@
+package pam
+
+import (
+	"context"
+)
+
+// appDataKey is the context key of the application data.
+type appDataKey struct{}
+
+// SetAppData attaches an application defined value to the transaction, such
+// as the request or session it serves. The value is made available to the
+// conversation handlers through the context they receive, so that a single
+// handler can serve many transactions, see AppDataFromContext.
+func (t *Transaction) SetAppData(v any) {
+	t.historyMu.Lock()
+	t.appData = v
+	t.historyMu.Unlock()
+	if t.state != nil {
+		t.state.mu.Lock()
+		t.state.appData = v
+		t.state.mu.Unlock()
+	}
+}
+
+// AppData returns the value set by SetAppData, nil if none.
+func (t *Transaction) AppData() any {
+	t.historyMu.Lock()
+	defer t.historyMu.Unlock()
+	return t.appData
+}
+
+// AppDataFromContext returns the application data of the transaction whose
+// ContextConversationHandler received ctx. It returns false if no data was
+// set.
+func AppDataFromContext(ctx context.Context) (any, bool) {
+	v := ctx.Value(appDataKey{})
+	return v, v != nil
+}
@@ -0,0 +1,37 @@
+package pam
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAppData(t *testing.T) {
+	h := ContextConversationFunc(func(ctx context.Context, s Style, msg string) (string, error) {
+		v, ok := AppDataFromContext(ctx)
+		if !ok {
+			return "", ErrConv
+		}
+		return v.(string), nil
+	})
+	for _, user := range []string{"testuser", "other"} {
+		tx, err := StartConfDir("succeed-if-user-test", "", h, "test-services")
+		if err != nil {
+			t.Fatalf("start #error: %v", err)
+		}
+		if tx.AppData() != nil {
+			t.Fatalf("appdata #expected nil, got %v", tx.AppData())
+		}
+		tx.SetAppData(user)
+		if tx.AppData() != user {
+			t.Fatalf("appdata #expected %v, got %v", user, tx.AppData())
+		}
+		err = tx.Authenticate(0)
+		tx.End()
+		if (user == "testuser") != (err == nil) {
+			t.Fatalf("authenticate #unexpected result for %v: %v", user, err)
+		}
+	}
+	if _, ok := AppDataFromContext(context.Background()); ok {
+		t.Fatalf("appdatafromcontext #expected no data")
+	}
+}
@@ -0,0 +1,6 @@
+// Package audit integrates PAM based applications with the Linux audit
+// subsystem: it sets up the login user ID of the processes running on
+// behalf of an authenticated user, as pam_loginuid does, and sends the
+// records of the PAM operations, as sshd does. It is only available on
+// Linux.
+package audit
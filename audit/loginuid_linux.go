@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/msteinert/pam"
+)
+
+// Unset is the login user ID of the processes not started by a login, and
+// the session ID of the processes not in an audit session.
+const Unset = 4294967295
+
+// Files of the audit attributes of the current process.
+const (
+	loginUIDFile  = "/proc/self/loginuid"
+	sessionIDFile = "/proc/self/sessionid"
+)
+
+// ErrNotSupported is returned when the kernel does not support the login
+// user ID, it has been built without audit support.
+var ErrNotSupported = errors.New("audit: login user ID not supported")
+
+// readID reads an ID from the file path.
+func readID(path string) (uint32, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotSupported
+	}
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+	return uint32(id), err
+}
+
+// LoginUID returns the login user ID of the current process, Unset if it
+// has not been set.
+func LoginUID() (uint32, error) {
+	return readID(loginUIDFile)
+}
+
+// SessionID returns the audit session ID of the current process, Unset if
+// it is not in a session. The kernel assigns a new one each time the login
+// user ID is set.
+func SessionID() (uint32, error) {
+	return readID(sessionIDFile)
+}
+
+// SetLoginUID sets the login user ID of the current process, which is
+// inherited by the processes it starts, so that the audit records of the
+// commands run on behalf of a user are attributed to them. It is to be
+// called once the session is opened and before executing the user's
+// programs, by a process with CAP_AUDIT_CONTROL; it fails with
+// os.ErrPermission if the login user ID is immutable or if it has already
+// been set and the process does not have that capability.
+func SetLoginUID(uid uint32) error {
+	f, err := os.OpenFile(loginUIDFile, os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotSupported
+	}
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(strconv.FormatUint(uint64(uid), 10))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SetLoginUIDFor sets the login user ID of the current process to the user
+// of the transaction, as pam_loginuid does for the applications it is
+// configured for, see SetLoginUID.
+func SetLoginUIDFor(t pam.TransactionHandle) error {
+	cred, err := t.Credential()
+	if err != nil {
+		return err
+	}
+	return SetLoginUID(cred.Uid)
+}
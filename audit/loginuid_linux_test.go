@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestLoginUID(t *testing.T) {
+	uid, err := LoginUID()
+	if errors.Is(err, ErrNotSupported) {
+		t.Skip("no audit support")
+	}
+	if err != nil {
+		t.Fatalf("loginuid #error: %v", err)
+	}
+	if _, err := SessionID(); err != nil {
+		t.Fatalf("sessionid #error: %v", err)
+	}
+	if uid != Unset {
+		t.Skip("login user ID already set")
+	}
+	if os.Getenv("PAM_TEST_SET_LOGINUID") == "1" {
+		tx, err := pam.StartConfDir("permit-service", "test", nil, "../test-services")
+		if err != nil {
+			t.Fatalf("start #error: %v", err)
+		}
+		defer tx.End()
+		if err := SetLoginUIDFor(tx); err != nil {
+			fmt.Printf("error=%v\n", err)
+			return
+		}
+		uid, _ := LoginUID()
+		fmt.Printf("loginuid=%d\n", uid)
+		return
+	}
+	test, err := user.Lookup("test")
+	if err != nil {
+		t.Skipf("lookup #error: %v", err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLoginUID$")
+	cmd.Env = append(os.Environ(), "PAM_TEST_SET_LOGINUID=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("setloginuid #error: %v: %s", err, out)
+	}
+	if strings.Contains(string(out), "error=") {
+		t.Skipf("setloginuid #not permitted: %s", out)
+	}
+	if expected := "loginuid=" + test.Uid; !strings.Contains(string(out), expected) {
+		t.Fatalf("setloginuid #expected %q, got %q", expected, out)
+	}
+}
@@ -0,0 +1,201 @@
+package audit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/msteinert/pam"
+)
+
+// Event is the type of an audit record.
+type Event uint16
+
+// Audit record types of the PAM operations.
+const (
+	// EventAuth is the record of an authentication.
+	EventAuth Event = 1100
+	// EventAcct is the record of an account check.
+	EventAcct Event = 1101
+	// EventStart is the record of the opening of a session.
+	EventStart Event = 1105
+	// EventEnd is the record of the closing of a session.
+	EventEnd Event = 1106
+)
+
+// netlinkAudit is the netlink protocol of the audit subsystem.
+const netlinkAudit = 9
+
+// String returns the operation name of the event, as pam_unix reports it.
+func (e Event) String() string {
+	switch e {
+	case EventAuth:
+		return "PAM:authentication"
+	case EventAcct:
+		return "PAM:accounting"
+	case EventStart:
+		return "PAM:session_open"
+	case EventEnd:
+		return "PAM:session_close"
+	}
+	return fmt.Sprintf("Event(%d)", uint16(e))
+}
+
+// Logger sends audit records to the kernel, the process needs
+// CAP_AUDIT_WRITE. Its methods can be used from several goroutines.
+type Logger struct {
+	mu  sync.Mutex
+	fd  int
+	seq uint32
+	exe string
+}
+
+// Dial opens the audit netlink socket.
+func Dial() (*Logger, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, netlinkAudit)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "?"
+	}
+	return &Logger{fd: fd, exe: exe}, nil
+}
+
+// Close closes the socket.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fd < 0 {
+		return nil
+	}
+	err := syscall.Close(l.fd)
+	l.fd = -1
+	return err
+}
+
+// Log sends the record of the event ev for the transaction t, using its
+// User, Tty and Rhost items, err being the result of the operation.
+func (l *Logger) Log(ev Event, t pam.TransactionHandle, err error) error {
+	user, _ := t.User()
+	tty, _ := t.Tty()
+	rhost, _ := t.Rhost()
+	return l.send(ev, message(ev, user, l.exe, rhost, tty, err == nil))
+}
+
+// message formats a user record as libaudit does.
+func message(ev Event, user, exe, rhost, tty string, success bool) string {
+	res := "failed"
+	if success {
+		res = "success"
+	}
+	return fmt.Sprintf("op=%s acct=%s exe=%s hostname=%s addr=? terminal=%s res=%s",
+		ev, value(user), value(exe), field(rhost), field(tty), res)
+}
+
+// value encodes an untrusted value, in hexadecimal if it contains special
+// characters, as libaudit does.
+func value(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '"' || c < 0x21 || c > 0x7e {
+			return fmt.Sprintf("%X", s)
+		}
+	}
+	return `"` + s + `"`
+}
+
+// field returns s, with the special characters replaced, or "?" if empty.
+func field(s string) string {
+	if s == "" {
+		return "?"
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 0x21 || r > 0x7e {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// send sends the message msg of type ev and waits for the acknowledgment.
+func (l *Logger) send(ev Event, msg string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fd < 0 {
+		return syscall.EBADF
+	}
+	l.seq++
+	payload := append([]byte(msg), 0)
+	b := make([]byte, syscall.NLMSG_HDRLEN+len(payload))
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(b)))
+	binary.LittleEndian.PutUint16(b[4:6], uint16(ev))
+	binary.LittleEndian.PutUint16(b[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	binary.LittleEndian.PutUint32(b[8:12], l.seq)
+	copy(b[syscall.NLMSG_HDRLEN:], payload)
+	err := syscall.Sendto(l.fd, b, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	if err != nil {
+		return os.NewSyscallError("sendto", err)
+	}
+	buf := make([]byte, syscall.Getpagesize())
+	for {
+		n, _, err := syscall.Recvfrom(l.fd, buf, 0)
+		if err != nil {
+			return os.NewSyscallError("recvfrom", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != l.seq || m.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+			if len(m.Data) < 4 {
+				return errors.New("audit: short acknowledgment")
+			}
+			if errno := int32(binary.LittleEndian.Uint32(m.Data[0:4])); errno != 0 {
+				return os.NewSyscallError("audit", syscall.Errno(-errno))
+			}
+			return nil
+		}
+	}
+}
+
+// Authenticate authenticates the user of t, as Authenticate does, and logs
+// an EventAuth record of the result.
+func (l *Logger) Authenticate(t pam.TransactionHandle, f pam.Flags) error {
+	return l.logged(EventAuth, t, t.Authenticate(f))
+}
+
+// AcctMgmt checks the account of the user of t, as AcctMgmt does, and logs
+// an EventAcct record of the result.
+func (l *Logger) AcctMgmt(t pam.TransactionHandle, f pam.Flags) error {
+	return l.logged(EventAcct, t, t.AcctMgmt(f))
+}
+
+// OpenSession opens the session of t, as OpenSession does, and logs an
+// EventStart record of the result.
+func (l *Logger) OpenSession(t pam.TransactionHandle, f pam.Flags) error {
+	return l.logged(EventStart, t, t.OpenSession(f))
+}
+
+// CloseSession closes the session of t, as CloseSession does, and logs an
+// EventEnd record of the result.
+func (l *Logger) CloseSession(t pam.TransactionHandle, f pam.Flags) error {
+	return l.logged(EventEnd, t, t.CloseSession(f))
+}
+
+// logged logs the record of ev and returns err, joined with the error of
+// the logging if any.
+func (l *Logger) logged(ev Event, t pam.TransactionHandle, err error) error {
+	return errors.Join(err, l.Log(ev, t, err))
+}
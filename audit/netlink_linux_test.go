@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		user, rhost, tty string
+		success          bool
+		expected         string
+	}{
+		{"test", "", "", true,
+			`op=PAM:authentication acct="test" exe="/bin/app" hostname=? addr=? terminal=? res=success`},
+		{"a b", "example.com", "pts/1", false,
+			`op=PAM:authentication acct=612062 exe="/bin/app" hostname=example.com addr=? terminal=pts/1 res=failed`},
+	}
+	for _, tt := range tests {
+		if got := message(EventAuth, tt.user, "/bin/app", tt.rhost, tt.tty, tt.success); got != tt.expected {
+			t.Fatalf("message #expected %q, got %q", tt.expected, got)
+		}
+	}
+	if s := EventEnd.String(); s != "PAM:session_close" {
+		t.Fatalf("string #unexpected value: %v", s)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	l, err := Dial()
+	if err != nil {
+		t.Skipf("dial #error: %v", err)
+	}
+	defer l.Close()
+	tx, err := pam.StartConfDir("deny-service", "test", nil, "../test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	err = l.Authenticate(tx, 0)
+	if !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", pam.ErrAuth, err)
+	}
+	for _, e := range []error{syscall.EPERM, syscall.ECONNREFUSED} {
+		if errors.Is(err, e) {
+			t.Skipf("log #error: %v", err)
+		}
+	}
+	if err := l.Log(EventAcct, tx, nil); err != nil {
+		t.Fatalf("log #error: %v", err)
+	}
+}
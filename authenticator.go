@@ -0,0 +1,78 @@
+package pam
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// serviceDirs are the directories where Linux-PAM looks for the services
+// when no configuration directory is given.
+var serviceDirs = []string{"/etc/pam.d", "/usr/lib/pam.d"}
+
+// Authenticator authenticates users against the first available service of
+// a prioritized list, such as "myapp", then "password-auth", then "other",
+// for applications deployed on systems with different PAM layouts.
+//
+// A service is skipped if it is not defined, or if the modules of its stack
+// can not be loaded (ErrOpen, ErrSymbol, ErrService, ErrModuleUnknown). Any other failure,
+// such as a wrong password, is returned without trying the next services,
+// so that a user does not get several attempts per try.
+type Authenticator struct {
+	// Services are the names of the services, in order of preference.
+	Services []string
+	// ConfDir is the directory where the services are defined, if empty
+	// the system default is used.
+	ConfDir string
+	// Options are used to start the transactions.
+	Options []StartOption
+}
+
+// ErrNoService is returned by Authenticator when none of its services is
+// available.
+var ErrNoService = errors.New("pam: no service available")
+
+// Authenticate checks that password is the password of user and that the
+// account is valid, as the Authenticate function does, and returns the
+// service that was used.
+func (a *Authenticator) Authenticate(user, password string) (string, error) {
+	opts := a.Options
+	if a.ConfDir != "" {
+		opts = append([]StartOption{WithConfDir(a.ConfDir)}, opts...)
+	}
+	for _, service := range a.Services {
+		if !a.defined(service) {
+			continue
+		}
+		err := Authenticate(service, user, password, opts...)
+		if unavailable(err) {
+			continue
+		}
+		return service, err
+	}
+	return "", ErrNoService
+}
+
+// unavailable returns whether err reports a stack that can not be used.
+func unavailable(err error) bool {
+	for _, e := range []Error{ErrOpen, ErrSymbol, ErrService, ErrModuleUnknown} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// defined returns whether service is defined in the configuration.
+func (a *Authenticator) defined(service string) bool {
+	dirs := serviceDirs
+	if a.ConfDir != "" {
+		dirs = []string{a.ConfDir}
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, service)); err == nil {
+			return true
+		}
+	}
+	return false
+}
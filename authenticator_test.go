@@ -0,0 +1,29 @@
+package pam
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAuthenticator(t *testing.T) {
+	a := &Authenticator{
+		Services: []string{"missing-service", "broken-service", "login-service", "deny-service"},
+		ConfDir:  "test-services",
+	}
+	service, err := a.Authenticate("testuser", "secret")
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if service != "login-service" {
+		t.Fatalf("authenticate #expected login-service, got %v", service)
+	}
+	a.Services = []string{"deny-service", "login-service"}
+	service, err = a.Authenticate("testuser", "secret")
+	if !errors.Is(err, ErrAuth) || service != "deny-service" {
+		t.Fatalf("authenticate #expected %v with deny-service, got %v with %v", ErrAuth, err, service)
+	}
+	a.Services = []string{"missing-service"}
+	if _, err := a.Authenticate("testuser", "secret"); !errors.Is(err, ErrNoService) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrNoService, err)
+	}
+}
@@ -0,0 +1,57 @@
+package pam
+
+//#include <security/pam_appl.h>
+//#include <stdlib.h>
+//#include <string.h>
+import "C"
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// SetAuthTok sets the authentication token, so that modules configured to
+// do so (such as pam_unix with use_first_pass) use it instead of prompting.
+// The token is copied into C memory and the tok slice is wiped, whether the
+// call succeeds or not; the C copy is wiped as soon as PAM has stored it.
+//
+// Linux-PAM only allows modules to set the token: applications get
+// ErrBadItem there.
+func (t *Transaction) SetAuthTok(tok []byte) error {
+	return t.setSecretItem(Authtok, tok)
+}
+
+// SetOldAuthTok sets the old authentication token, see SetAuthTok.
+func (t *Transaction) SetOldAuthTok(tok []byte) error {
+	return t.setSecretItem(Oldauthtok, tok)
+}
+
+// setSecretItem sets the item i to the value of tok, wiping it afterwards.
+func (t *Transaction) setSecretItem(i Item, tok []byte) error {
+	defer wipe(tok)
+	if err := t.checkEnded("pam_set_item"); err != nil {
+		return err
+	}
+	if bytes.IndexByte(tok, 0) >= 0 {
+		return &OpError{Op: "pam_set_item", Args: i.String(), Err: ErrInvalidArgument}
+	}
+	cs := (*C.char)(C.malloc(C.size_t(len(tok) + 1)))
+	defer func() {
+		C.memset(unsafe.Pointer(cs), 0, C.size_t(len(tok)+1))
+		C.free(unsafe.Pointer(cs))
+	}()
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(cs)), len(tok)+1)
+	copy(buf, tok)
+	buf[len(tok)] = 0
+	return t.handlePamStatus(t.run(func() C.int {
+		return C.pam_set_item(t.handle, C.int(i), unsafe.Pointer(cs))
+	}),
+		"pam_set_item", i)
+}
+
+// wipe overwrites the content of b with zeroes.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,42 @@
+package pam
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestSetAuthTok(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	for _, set := range []func([]byte) error{tx.SetAuthTok, tx.SetOldAuthTok} {
+		tok := []byte("secret")
+		err = set(tok)
+		if runtime.GOOS == "linux" {
+			// Linux-PAM only allows modules to set the tokens.
+			if !errors.Is(err, ErrBadItem) {
+				t.Fatalf("setauthtok #expected %v, got %v", ErrBadItem, err)
+			}
+		} else if err != nil {
+			t.Fatalf("setauthtok #error: %v", err)
+		}
+		for _, b := range tok {
+			if b != 0 {
+				t.Fatalf("setauthtok #error: token not wiped: %v", tok)
+			}
+		}
+	}
+	tok := []byte("sec\x00ret")
+	err = tx.SetAuthTok(tok)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("setauthtok #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if string(tok) != string(make([]byte, len(tok))) {
+		t.Fatalf("setauthtok #error: token not wiped: %v", tok)
+	}
+}
@@ -0,0 +1,53 @@
+package pam
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+)
+
+// binaryHeaderLen is the size of the header of the Linux-PAM binary prompt
+// format: the total length as a big-endian 32-bit integer, followed by the
+// message type.
+const binaryHeaderLen = 5
+
+// BinaryMaxLen is the largest binary message accepted, as defined by
+// libpamc.
+const BinaryMaxLen = 0x20000
+
+// BinaryDecode parses a binary message in the Linux-PAM binary prompt format,
+// as received by RespondPAMBinary, returning its type and a copy of its
+// payload. Messages whose length is not valid return ErrInvalidArgument.
+func BinaryDecode(p BinaryPointer) (msgType byte, data []byte, err error) {
+	if p == nil {
+		return 0, nil, fmt.Errorf("%w: nil binary message", ErrInvalidArgument)
+	}
+	header := unsafe.Slice((*byte)(p), binaryHeaderLen)
+	n := binary.BigEndian.Uint32(header)
+	if n < binaryHeaderLen || n > BinaryMaxLen {
+		return 0, nil, fmt.Errorf("%w: binary message length %d", ErrInvalidArgument, n)
+	}
+	msg := unsafe.Slice((*byte)(p), n)
+	return header[4], append([]byte{}, msg[binaryHeaderLen:]...), nil
+}
+
+// BinaryEncode returns a binary message of type msgType with the payload
+// data, in the Linux-PAM binary prompt format expected by the modules. It is
+// meant to be returned by RespondPAMBinary. The message is Go memory, not a
+// malloc'd buffer: the conversation always copies the response of
+// RespondPAMBinary into memory allocated with malloc, that the module owns
+// and releases, so handlers never allocate nor free C memory themselves.
+//
+// The conversation does not check the framing of the responses, so that
+// binary protocols using another layout keep working.
+func BinaryEncode(msgType byte, data []byte) ([]byte, error) {
+	n := binaryHeaderLen + len(data)
+	if n > BinaryMaxLen {
+		return nil, fmt.Errorf("%w: binary message length %d", ErrInvalidArgument, n)
+	}
+	msg := make([]byte, n)
+	binary.BigEndian.PutUint32(msg, uint32(n))
+	msg[4] = msgType
+	copy(msg[binaryHeaderLen:], data)
+	return msg, nil
+}
@@ -0,0 +1,53 @@
+package pam
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+)
+
+func TestBinaryDecode(t *testing.T) {
+	msg := []byte{0, 0, 0, 8, 0x42, 'a', 'b', 'c'}
+	typ, data, err := BinaryDecode(BinaryPointer(unsafe.Pointer(&msg[0])))
+	if err != nil {
+		t.Fatalf("binarydecode #error: %v", err)
+	}
+	if typ != 0x42 || string(data) != "abc" {
+		t.Fatalf("binarydecode #error: unexpected %v, %v", typ, data)
+	}
+	msg[3] = 5
+	if _, data, err := BinaryDecode(BinaryPointer(unsafe.Pointer(&msg[0]))); err != nil || len(data) != 0 {
+		t.Fatalf("binarydecode #error: %v, %v", data, err)
+	}
+	for _, n := range []byte{4, 0} {
+		msg[3] = n
+		_, _, err := BinaryDecode(BinaryPointer(unsafe.Pointer(&msg[0])))
+		if !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("binarydecode #expected %v, got %v", ErrInvalidArgument, err)
+		}
+	}
+	msg[0] = 0xff
+	if _, _, err := BinaryDecode(BinaryPointer(unsafe.Pointer(&msg[0]))); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("binarydecode #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if _, _, err := BinaryDecode(nil); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("binarydecode #expected %v, got %v", ErrInvalidArgument, err)
+	}
+}
+
+func TestBinaryEncode(t *testing.T) {
+	msg, err := BinaryEncode(0x42, []byte("abc"))
+	if err != nil {
+		t.Fatalf("binaryencode #error: %v", err)
+	}
+	if len(msg) != 8 || msg[3] != 8 {
+		t.Fatalf("binaryencode #error: unexpected %v", msg)
+	}
+	typ, data, err := BinaryDecode(BinaryPointer(unsafe.Pointer(&msg[0])))
+	if err != nil || typ != 0x42 || string(data) != "abc" {
+		t.Fatalf("binarydecode #error: %v, %v, %v", typ, data, err)
+	}
+	if _, err := BinaryEncode(0, make([]byte, BinaryMaxLen)); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("binaryencode #expected %v, got %v", ErrInvalidArgument, err)
+	}
+}
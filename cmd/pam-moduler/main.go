@@ -0,0 +1,157 @@
+// Command pam-moduler generates the boilerplate of a PAM module written in
+// Go: given the ModuleHandler implementation of a main package, it writes
+// the registration of the handler and the main function, and a version
+// script restricting the symbols exported by the module to the pam_sm_*
+// entry points of the module package. The package can then be built with:
+//
+//	go build -buildmode=c-shared -o pam_name.so \
+//		-ldflags="-extldflags=-Wl,--version-script=$PWD/pam_name.map"
+//
+// It is usually run by go generate, from a comment in the package:
+//
+//	//go:generate go run github.com/msteinert/pam/cmd/pam-moduler -type handler
+//
+// Usage:
+//
+//	pam-moduler -type T [-name pam_name] [-output file] [-no-main] [dir]
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// entryPoints are the symbols exported by a PAM module.
+var entryPoints = []string{
+	"pam_sm_authenticate",
+	"pam_sm_setcred",
+	"pam_sm_acct_mgmt",
+	"pam_sm_open_session",
+	"pam_sm_close_session",
+	"pam_sm_chauthtok",
+}
+
+// config describes the code to generate.
+type config struct {
+	// Type is the name of the ModuleHandler implementation.
+	Type string
+	// Name is the name of the module, such as pam_example.
+	Name string
+	// Output is the name of the generated Go file.
+	Output string
+	// NoMain disables the generation of the main function.
+	NoMain bool
+	// Args are the arguments of the command, for the generated header.
+	Args []string
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("pam-moduler: ")
+	var c config
+	flag.StringVar(&c.Type, "type", "", "name of the ModuleHandler implementation, required")
+	flag.StringVar(&c.Name, "name", "", "name of the module, pam_ followed by the directory name by default")
+	flag.StringVar(&c.Output, "output", "pam_module.go", "name of the generated Go file")
+	flag.BoolVar(&c.NoMain, "no-main", false, "do not generate the main function")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: pam-moduler -type T [flags] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if c.Type == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	c.Args = os.Args[1:]
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	if err := generate(dir, &c); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate writes the files described by c in the package in dir.
+func generate(dir string, c *config) error {
+	if err := checkPackage(dir, c); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		c.Name = "pam_" + strings.ReplaceAll(filepath.Base(abs), "-", "_")
+	}
+	if !token.IsIdentifier(c.Name) {
+		return fmt.Errorf("invalid module name %q", c.Name)
+	}
+	src, err := source(c)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, c.Output), src, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, c.Name+".map"), versionScript(), 0o644)
+}
+
+// checkPackage checks that dir holds a main package declaring c.Type,
+// ignoring the output file.
+func checkPackage(dir string, c *config) error {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return fi.Name() != c.Output && !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return err
+	}
+	pkg, ok := pkgs["main"]
+	if !ok || len(pkgs) != 1 {
+		return errors.New("a module must be built from a main package")
+	}
+	for _, f := range pkg.Files {
+		if obj := f.Scope.Lookup(c.Type); obj != nil && obj.Kind == ast.Typ {
+			return nil
+		}
+	}
+	return fmt.Errorf("type %s not found", c.Type)
+}
+
+// source returns the Go file registering the handler.
+func source(c *config) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by \"pam-moduler %s\"; DO NOT EDIT.\n\n", strings.Join(c.Args, " "))
+	fmt.Fprintf(&b, "// Build the module with:\n//\n")
+	fmt.Fprintf(&b, "//\tgo build -buildmode=c-shared -o %s.so \\\n", c.Name)
+	fmt.Fprintf(&b, "//\t\t-ldflags=\"-extldflags=-Wl,--version-script=$PWD/%s.map\"\n\n", c.Name)
+	fmt.Fprintf(&b, "package main\n\n")
+	fmt.Fprintf(&b, "import \"github.com/msteinert/pam/module\"\n\n")
+	fmt.Fprintf(&b, "func init() {\n\tmodule.Register(&%s{})\n}\n", c.Type)
+	if !c.NoMain {
+		fmt.Fprintf(&b, "\nfunc main() {}\n")
+	}
+	return format.Source(b.Bytes())
+}
+
+// versionScript returns the linker version script of the module.
+func versionScript() []byte {
+	var b bytes.Buffer
+	b.WriteString("{\n\tglobal:\n")
+	for _, sym := range entryPoints {
+		fmt.Fprintf(&b, "\t\t%s;\n", sym)
+	}
+	b.WriteString("\tlocal:\n\t\t*;\n};\n")
+	return b.Bytes()
+}
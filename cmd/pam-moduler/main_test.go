@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+// copyExample copies the example package in a directory of the module, so
+// that it can be built, and returns it.
+func copyExample(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("testdata", "_build")
+	if err != nil {
+		t.Fatalf("mkdirtemp #error: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	src, err := os.ReadFile("testdata/example/handler.go")
+	if err != nil {
+		t.Fatalf("readfile #error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "handler.go"), src, 0o644); err != nil {
+		t.Fatalf("writefile #error: %v", err)
+	}
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	dir := copyExample(t)
+	c := &config{Type: "handler", Name: "pam_example", Output: "pam_module.go", Args: []string{"-type", "handler"}}
+	if err := generate(dir, c); err != nil {
+		t.Fatalf("generate #error: %v", err)
+	}
+	src, err := os.ReadFile(filepath.Join(dir, "pam_module.go"))
+	if err != nil {
+		t.Fatalf("readfile #error: %v", err)
+	}
+	for _, s := range []string{
+		"// Code generated by \"pam-moduler -type handler\"; DO NOT EDIT.",
+		"-ldflags=\"-extldflags=-Wl,--version-script=$PWD/pam_example.map\"",
+		"module.Register(&handler{})",
+		"func main() {}",
+	} {
+		if !strings.Contains(string(src), s) {
+			t.Fatalf("generate #expected %q in:\n%s", s, src)
+		}
+	}
+	so := filepath.Join(t.TempDir(), "pam_example.so")
+	abs, err := filepath.Abs(filepath.Join(dir, "pam_example.map"))
+	if err != nil {
+		t.Fatalf("abs #error: %v", err)
+	}
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", so,
+		"-ldflags=-extldflags=-Wl,--version-script="+abs)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build #error: %v\n%s", err, out)
+	}
+	out, err := exec.Command("nm", "-D", "--defined-only", so).Output()
+	if err != nil {
+		t.Skipf("nm #error: %v", err)
+	}
+	var syms []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if f := strings.Fields(line); len(f) == 3 && f[1] == "T" {
+			syms = append(syms, f[2])
+		}
+	}
+	expected := append([]string(nil), entryPoints...)
+	sort.Strings(expected)
+	if strings.Join(syms, " ") != strings.Join(expected, " ") {
+		t.Fatalf("build #expected exported %v, got %v", entryPoints, syms)
+	}
+
+	conf := filepath.Join(filepath.Dir(so), "example")
+	if err := os.WriteFile(conf, []byte("auth required "+so+" test\n"), 0o644); err != nil {
+		t.Fatalf("writefile #error: %v", err)
+	}
+	tx, err := pam.StartConfDir("example", "test", nil, filepath.Dir(so))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.SetUser("nobody"); err != nil {
+		t.Fatalf("setuser #error: %v", err)
+	}
+	if err := tx.Authenticate(0); !errors.Is(err, pam.ErrUserUnknown) {
+		t.Fatalf("authenticate #expected %v, got %v", pam.ErrUserUnknown, err)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := copyExample(t)
+	if err := generate(dir, &config{Type: "missing", Output: "pam_module.go"}); err == nil {
+		t.Fatalf("generate #expected an error for a missing type")
+	}
+	if err := generate("../../module", &config{Type: "ModuleTransaction", Output: "pam_module.go"}); err == nil {
+		t.Fatalf("generate #expected an error for a non main package")
+	}
+	if err := generate(dir, &config{Type: "handler", Name: "pam-example", Output: "pam_module.go"}); err == nil {
+		t.Fatalf("generate #expected an error for an invalid name")
+	}
+}
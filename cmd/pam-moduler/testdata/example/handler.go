@@ -0,0 +1,42 @@
+// Command example is the module generated by the tests of pam-moduler.
+package main
+
+//go:generate go run github.com/msteinert/pam/cmd/pam-moduler -type handler
+
+import (
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/module"
+)
+
+type handler struct{}
+
+func (*handler) Authenticate(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	user, err := mt.GetUser("")
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 || args[0] != user {
+		return pam.ErrUserUnknown
+	}
+	return nil
+}
+
+func (*handler) SetCred(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	return nil
+}
+
+func (*handler) AcctMgmt(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	return nil
+}
+
+func (*handler) OpenSession(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	return nil
+}
+
+func (*handler) CloseSession(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	return nil
+}
+
+func (*handler) ChangeAuthTok(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	return pam.ErrIgnore
+}
@@ -0,0 +1,70 @@
+package pam
+
+import "context"
+
+// withContext performs the operation op using fn, making its conversations
+// fail once ctx is done, in which case the error of ctx is returned.
+func (t *Transaction) withContext(ctx context.Context, op string, f Flags, fn func(context.Context, Flags) error) error {
+	if err := t.checkEnded(op); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return &OpError{Op: op, Err: err}
+	}
+	err := fn(ctx, f)
+	if err != nil && ctx.Err() != nil {
+		return &OpError{Op: op, Err: ctx.Err()}
+	}
+	return err
+}
+
+// setOpContext makes the conversations fail once ctx is done, until the
+// returned function is called. It is called by the libpam call of the
+// operation, holding the lock of the transaction.
+func (c *conversation) setOpContext(ctx context.Context) func() {
+	c.mu.Lock()
+	prev := c.opCtx
+	c.opCtx = ctx
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		c.opCtx = prev
+		c.mu.Unlock()
+	}
+}
+
+// AuthenticateContext is like Authenticate, but the pending conversation is
+// aborted once ctx is done, and the error of ctx is returned.
+func (t *Transaction) AuthenticateContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, "pam_authenticate", f, t.authenticate)
+}
+
+// SetCredContext is like SetCred, but the pending conversation is aborted
+// once ctx is done, and the error of ctx is returned.
+func (t *Transaction) SetCredContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, "pam_setcred", f, t.setCred)
+}
+
+// AcctMgmtContext is like AcctMgmt, but the pending conversation is aborted
+// once ctx is done, and the error of ctx is returned.
+func (t *Transaction) AcctMgmtContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, "pam_acct_mgmt", f, t.acctMgmt)
+}
+
+// ChangeAuthTokContext is like ChangeAuthTok, but the pending conversation is
+// aborted once ctx is done, and the error of ctx is returned.
+func (t *Transaction) ChangeAuthTokContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, "pam_chauthtok", f, t.changeAuthTok)
+}
+
+// OpenSessionContext is like OpenSession, but the pending conversation is
+// aborted once ctx is done, and the error of ctx is returned.
+func (t *Transaction) OpenSessionContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, "pam_open_session", f, t.openSession)
+}
+
+// CloseSessionContext is like CloseSession, but the pending conversation is
+// aborted once ctx is done, and the error of ctx is returned.
+func (t *Transaction) CloseSessionContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, "pam_close_session", f, t.closeSession)
+}
@@ -0,0 +1,106 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"os/user"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateContext(t *testing.T) {
+	h := NewChannelHandler()
+	tx, err := StartConfDir("succeed-if-user-test", "", h, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = tx.AuthenticateContext(ctx, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("authenticatecontext #expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err := tx.AuthenticateContext(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("authenticatecontext #expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if tx.state.opCtx != nil {
+		t.Fatalf("authenticatecontext #error: operation context not reset")
+	}
+}
+
+func TestAuthenticateContextSuccess(t *testing.T) {
+	tx, err := StartConfDir("succeed-if-user-test", "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			return "testuser", nil
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.AuthenticateContext(context.Background(), 0); err != nil {
+		t.Fatalf("authenticatecontext #error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, op := range []func(context.Context, Flags) error{
+		tx.SetCredContext, tx.AcctMgmtContext, tx.ChangeAuthTokContext,
+		tx.OpenSessionContext, tx.CloseSessionContext,
+	} {
+		if err := op(ctx, 0); !errors.Is(err, context.Canceled) {
+			t.Fatalf("context #expected %v, got %v", context.Canceled, err)
+		}
+	}
+}
+
+func TestAuthenticateContextConcurrent(t *testing.T) {
+	u, _ := user.Current()
+	if u.Uid != "0" {
+		t.Skip("run this test as root")
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finish := make(chan struct{})
+	defer close(finish)
+	var calls int32
+	tx, err := Start("", "test", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			started <- struct{}{}
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-release
+			} else {
+				<-finish
+			}
+			return "secret", nil
+		}))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	first := make(chan error, 1)
+	go func() {
+		first <- tx.AuthenticateContext(context.Background(), 0)
+	}()
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	second := make(chan error, 1)
+	go func() {
+		second <- tx.AuthenticateContext(ctx, 0)
+	}()
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatalf("authenticatecontext #error: %v", err)
+	}
+	<-started
+	cancel()
+	select {
+	case err := <-second:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("authenticatecontext #expected %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("authenticatecontext #error: the second operation was not canceled")
+	}
+}
@@ -0,0 +1,299 @@
+package pam
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PutEnvPairs sets many PAM environment variables at once, such as the ones
+// inherited from a parent process. Either all of the variables are set or,
+// if any of them fails, the environment is left unchanged and the first
+// error is returned.
+func (t *Transaction) PutEnvPairs(env map[string]string) error {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]string, 0, len(env))
+	for _, name := range names {
+		if err := checkEnvName(name); err != nil {
+			return &OpError{Op: "pam_putenv", Args: name, Err: err}
+		}
+		list = append(list, name+"="+env[name])
+	}
+	return t.PutEnvList(list)
+}
+
+// PutEnvList applies many "NAME=value" or "NAME" strings, as accepted by
+// PutEnv, at once. Either all of the changes are applied or, if any of them
+// fails, the environment is left unchanged and the first error is returned.
+func (t *Transaction) PutEnvList(list []string) error {
+	if err := t.checkEnded("pam_putenv"); err != nil {
+		return err
+	}
+	for _, nameval := range list {
+		name := strings.SplitN(nameval, "=", 2)[0]
+		if err := checkEnvName(name); err != nil {
+			return &OpError{Op: "pam_putenv", Args: name, Err: err}
+		}
+		if err := checkCString(nameval); err != nil {
+			return &OpError{Op: "pam_putenv", Args: name, Err: err}
+		}
+	}
+	type saved struct {
+		value string
+		ok    bool
+	}
+	prev := make(map[string]saved)
+	var applied []string
+	for _, nameval := range list {
+		name := strings.SplitN(nameval, "=", 2)[0]
+		if _, ok := prev[name]; !ok {
+			value, ok := t.LookupEnv(name)
+			prev[name] = saved{value, ok}
+		}
+		if !strings.Contains(nameval, "=") {
+			if _, ok := t.LookupEnv(name); !ok {
+				continue
+			}
+		}
+		if err := t.PutEnv(nameval); err != nil {
+			for i := len(applied) - 1; i >= 0; i-- {
+				p := prev[applied[i]]
+				if p.ok {
+					_ = t.PutEnv(applied[i] + "=" + p.value)
+				} else {
+					_ = t.UnsetEnv(applied[i])
+				}
+			}
+			return err
+		}
+		applied = append(applied, name)
+	}
+	return nil
+}
+
+// MergePolicy controls how the PAM environment is merged into an existing
+// environment, when a variable is set in both.
+type MergePolicy int
+
+const (
+	// MergeOverwrite uses the value of the PAM environment.
+	MergeOverwrite MergePolicy = iota
+	// MergeKeepExisting keeps the value of the existing environment.
+	MergeKeepExisting
+	// MergeErrorOnConflict fails with ErrEnvConflict if the values differ.
+	MergeErrorOnConflict
+)
+
+// ErrEnvConflict is returned by MergeErrorOnConflict when a variable has a
+// different value in the PAM environment and in the existing one.
+var ErrEnvConflict = errors.New("pam: conflicting environment variable")
+
+// ApplyEnv merges the PAM environment into the environment of cmd, which is
+// the one of the current process if cmd.Env is nil, according to policy.
+func (t *Transaction) ApplyEnv(cmd *exec.Cmd, policy MergePolicy) error {
+	env, err := t.Environ()
+	if err != nil {
+		return err
+	}
+	base := cmd.Env
+	if base == nil {
+		base = os.Environ()
+	}
+	merged, err := mergeEnv(base, env, policy)
+	if err != nil {
+		return err
+	}
+	cmd.Env = merged
+	return nil
+}
+
+// mergeEnv returns a copy of base with the variables of env merged according
+// to policy.
+func mergeEnv(base, env []string, policy MergePolicy) ([]string, error) {
+	if policy < MergeOverwrite || policy > MergeErrorOnConflict {
+		return nil, ErrInvalidArgument
+	}
+	merged := append([]string(nil), base...)
+	index := make(map[string]int, len(merged))
+	for i, kv := range merged {
+		name, _, _ := strings.Cut(kv, "=")
+		index[name] = i
+	}
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		i, ok := index[name]
+		if !ok {
+			index[name] = len(merged)
+			merged = append(merged, kv)
+			continue
+		}
+		_, old, _ := strings.Cut(merged[i], "=")
+		switch {
+		case old == value || policy == MergeKeepExisting:
+		case policy == MergeOverwrite:
+			merged[i] = kv
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrEnvConflict, name)
+		}
+	}
+	return merged, nil
+}
+
+// ExportEnv sets the PAM environment variables in the environment of the
+// current process according to policy. With MergeErrorOnConflict the process
+// environment is not changed if any variable conflicts.
+func (t *Transaction) ExportEnv(policy MergePolicy) error {
+	env, err := t.Environ()
+	if err != nil {
+		return err
+	}
+	if _, err := mergeEnv(os.Environ(), env, policy); err != nil {
+		return err
+	}
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		if _, ok := os.LookupEnv(name); ok && policy == MergeKeepExisting {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnvSnapshot is a copy of the PAM environment at a given time, as returned
+// by SnapshotEnv.
+type EnvSnapshot map[string]string
+
+// SnapshotEnv returns a copy of the current PAM environment, so that it can
+// be compared with a later one to find out which variables a PAM stage, such
+// as SetCred or OpenSession, added, changed or removed.
+func (t *Transaction) SnapshotEnv() (EnvSnapshot, error) {
+	env, err := t.GetEnvList()
+	if err != nil {
+		return nil, err
+	}
+	return EnvSnapshot(env), nil
+}
+
+// EnvChange describes a variable whose value changed.
+type EnvChange struct {
+	Old, New string
+}
+
+// EnvDiff is the difference between two environment snapshots.
+type EnvDiff struct {
+	Added   map[string]string
+	Changed map[string]EnvChange
+	Removed map[string]string
+}
+
+// Diff returns the changes from the snapshot s to the later snapshot.
+func (s EnvSnapshot) Diff(later EnvSnapshot) EnvDiff {
+	d := EnvDiff{
+		Added:   make(map[string]string),
+		Changed: make(map[string]EnvChange),
+		Removed: make(map[string]string),
+	}
+	for name, value := range later {
+		old, ok := s[name]
+		switch {
+		case !ok:
+			d.Added[name] = value
+		case old != value:
+			d.Changed[name] = EnvChange{Old: old, New: value}
+		}
+	}
+	for name, value := range s {
+		if _, ok := later[name]; !ok {
+			d.Removed[name] = value
+		}
+	}
+	return d
+}
+
+// Empty returns whether the snapshots are equal.
+func (d EnvDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0
+}
+
+// String returns the changes sorted by name, such as
+// "+KRB5CCNAME=FILE:/tmp/krb5cc -MAIL ~PATH=/bin->/usr/bin:/bin".
+func (d EnvDiff) String() string {
+	var changes []string
+	for name, value := range d.Added {
+		changes = append(changes, "+"+name+"="+value)
+	}
+	for name, c := range d.Changed {
+		changes = append(changes, "~"+name+"="+c.Old+"->"+c.New)
+	}
+	for name := range d.Removed {
+		changes = append(changes, "-"+name)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i][1:] < changes[j][1:]
+	})
+	return strings.Join(changes, " ")
+}
+
+// SessionInfo holds the well-known variables that modules such as pam_krb5,
+// pam_systemd and pam_mail export in the PAM environment. Unset variables
+// are left empty.
+type SessionInfo struct {
+	// Krb5CCName is the Kerberos credentials cache, KRB5CCNAME.
+	Krb5CCName string
+	// XDGSessionID is the logind session identifier, XDG_SESSION_ID.
+	XDGSessionID string
+	// XDGRuntimeDir is the user runtime directory, XDG_RUNTIME_DIR.
+	XDGRuntimeDir string
+	// XDGSeat is the seat of the session, XDG_SEAT.
+	XDGSeat string
+	// XDGVTNr is the virtual terminal number of the session, XDG_VTNR, or
+	// zero if it is not set or invalid.
+	XDGVTNr int
+	// XDGSessionType is the type of the session, such as "tty" or
+	// "wayland", XDG_SESSION_TYPE.
+	XDGSessionType string
+	// XDGSessionClass is the class of the session, such as "user" or
+	// "greeter", XDG_SESSION_CLASS.
+	XDGSessionClass string
+	// Mail is the mailbox of the user, MAIL.
+	Mail string
+	// Path is the list of directories of PATH.
+	Path []string
+}
+
+// SessionInfo extracts the well-known session variables from the PAM
+// environment, it is meant to be called after SetCred or OpenSession.
+func (t *Transaction) SessionInfo() (*SessionInfo, error) {
+	env, err := t.GetEnvList()
+	if err != nil {
+		return nil, err
+	}
+	info := &SessionInfo{
+		Krb5CCName:      env["KRB5CCNAME"],
+		XDGSessionID:    env["XDG_SESSION_ID"],
+		XDGRuntimeDir:   env["XDG_RUNTIME_DIR"],
+		XDGSeat:         env["XDG_SEAT"],
+		XDGSessionType:  env["XDG_SESSION_TYPE"],
+		XDGSessionClass: env["XDG_SESSION_CLASS"],
+		Mail:            env["MAIL"],
+	}
+	if vt, err := strconv.Atoi(env["XDG_VTNR"]); err == nil && vt > 0 {
+		info.XDGVTNr = vt
+	}
+	if path := env["PATH"]; path != "" {
+		info.Path = filepath.SplitList(path)
+	}
+	return info, nil
+}
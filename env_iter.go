@@ -0,0 +1,44 @@
+//go:build go1.23
+
+package pam
+
+//#include <security/pam_appl.h>
+//#include <stdlib.h>
+import "C"
+
+import (
+	"iter"
+	"strings"
+	"unsafe"
+)
+
+// Env returns an iterator over the names and values of the PAM environment
+// variables, in the order returned by pam_getenvlist. Unlike GetEnvList, no
+// intermediate map is built. The iterator yields nothing if the transaction
+// has ended or the environment can not be retrieved.
+func (t *Transaction) Env() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		var p **C.char
+		t.do(func() {
+			p = C.pam_getenvlist(t.handle)
+		})
+		if p == nil {
+			return
+		}
+		defer func() {
+			for q := p; *q != nil; q = next(q) {
+				C.free(unsafe.Pointer(*q))
+			}
+			C.free(unsafe.Pointer(p))
+		}()
+		for q := p; *q != nil; q = next(q) {
+			name, value, ok := strings.Cut(C.GoString(*q), "=")
+			if !ok {
+				continue
+			}
+			if !yield(name, value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+//go:build go1.23
+
+package pam
+
+import "testing"
+
+func TestEnvIterator(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.PutEnvList([]string{"VAL1=1", "VAL2=", "VAL3=3"}); err != nil {
+		t.Fatalf("putenvlist #error: %v", err)
+	}
+	var names []string
+	for name, value := range tx.Env() {
+		if tx.GetEnv(name) != value {
+			t.Fatalf("env #error: unexpected value %q for %v", value, name)
+		}
+		names = append(names, name)
+	}
+	if len(names) != 3 || names[0] != "VAL1" || names[2] != "VAL3" {
+		t.Fatalf("env #error: unexpected names %v", names)
+	}
+	for name := range tx.Env() {
+		if name != "VAL1" {
+			t.Fatalf("env #error: unexpected first name %v", name)
+		}
+		break
+	}
+	tx.End()
+	for name := range tx.Env() {
+		t.Fatalf("env #error: unexpected %v after the end", name)
+	}
+}
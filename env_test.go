@@ -0,0 +1,212 @@
+package pam
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestPutEnvPairs(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.SetEnv("KEEP", "old"); err != nil {
+		t.Fatalf("setenv #error: %v", err)
+	}
+	err = tx.PutEnvPairs(map[string]string{"KEEP": "new", "VAL1": "1", "EMPTY": ""})
+	if err != nil {
+		t.Fatalf("putenvpairs #error: %v", err)
+	}
+	m, err := tx.GetEnvList()
+	if err != nil {
+		t.Fatalf("getenvlist #error: %v", err)
+	}
+	if len(m) != 3 || m["KEEP"] != "new" || m["VAL1"] != "1" || m["EMPTY"] != "" {
+		t.Fatalf("putenvpairs #error: unexpected environment %v", m)
+	}
+	err = tx.PutEnvPairs(map[string]string{"VAL2": "2", "A=B": "c"})
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("putenvpairs #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if _, ok := tx.LookupEnv("VAL2"); ok {
+		t.Fatalf("putenvpairs #error: expected VAL2 not to be set")
+	}
+}
+
+func TestPutEnvList(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.PutEnvList([]string{"VAL1=1", "VAL2=2", "VAL1", "UNSET"}); err != nil {
+		t.Fatalf("putenvlist #error: %v", err)
+	}
+	env, err := tx.Environ()
+	if err != nil {
+		t.Fatalf("environ #error: %v", err)
+	}
+	if len(env) != 1 || env[0] != "VAL2=2" {
+		t.Fatalf("putenvlist #error: unexpected environment %v", env)
+	}
+	if err := tx.PutEnvList([]string{"VAL2=3", "=4"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("putenvlist #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if v := tx.GetEnv("VAL2"); v != "2" {
+		t.Fatalf("putenvlist #error: expected 2, got %v", v)
+	}
+	tx.End()
+	if err := tx.PutEnvList(nil); !errors.Is(err, ErrTransactionClosed) {
+		t.Fatalf("putenvlist #expected %v, got %v", ErrTransactionClosed, err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.PutEnvList([]string{"HOME=/home/test", "PAM_ONLY=1"}); err != nil {
+		t.Fatalf("putenvlist #error: %v", err)
+	}
+	tests := []struct {
+		policy   MergePolicy
+		expected string
+		err      error
+	}{
+		{MergeOverwrite, "HOME=/home/test TERM=dumb PAM_ONLY=1", nil},
+		{MergeKeepExisting, "HOME=/root TERM=dumb PAM_ONLY=1", nil},
+		{MergeErrorOnConflict, "", ErrEnvConflict},
+		{MergePolicy(-1), "", ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		cmd := exec.Command("true")
+		cmd.Env = []string{"HOME=/root", "TERM=dumb"}
+		err := tx.ApplyEnv(cmd, tt.policy)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("applyenv #expected %v, got %v", tt.err, err)
+		}
+		if err == nil && strings.Join(cmd.Env, " ") != tt.expected {
+			t.Fatalf("applyenv #error: expected %v, got %v", tt.expected, cmd.Env)
+		}
+	}
+	cmd := exec.Command("true")
+	if err := tx.ApplyEnv(cmd, MergeOverwrite); err != nil {
+		t.Fatalf("applyenv #error: %v", err)
+	}
+	if len(cmd.Env) < 2 {
+		t.Fatalf("applyenv #error: expected the process environment, got %v", cmd.Env)
+	}
+}
+
+func TestExportEnv(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	t.Setenv("PAM_TEST_EXISTING", "old")
+	t.Setenv("PAM_TEST_NEW", "")
+	os.Unsetenv("PAM_TEST_NEW")
+	if err := tx.PutEnvList([]string{"PAM_TEST_EXISTING=new", "PAM_TEST_NEW=1"}); err != nil {
+		t.Fatalf("putenvlist #error: %v", err)
+	}
+	if err := tx.ExportEnv(MergeErrorOnConflict); !errors.Is(err, ErrEnvConflict) {
+		t.Fatalf("exportenv #expected %v, got %v", ErrEnvConflict, err)
+	}
+	if _, ok := os.LookupEnv("PAM_TEST_NEW"); ok {
+		t.Fatalf("exportenv #error: expected PAM_TEST_NEW not to be set")
+	}
+	if err := tx.ExportEnv(MergeKeepExisting); err != nil {
+		t.Fatalf("exportenv #error: %v", err)
+	}
+	if os.Getenv("PAM_TEST_EXISTING") != "old" || os.Getenv("PAM_TEST_NEW") != "1" {
+		t.Fatalf("exportenv #error: unexpected environment %v", os.Environ())
+	}
+	if err := tx.ExportEnv(MergeOverwrite); err != nil {
+		t.Fatalf("exportenv #error: %v", err)
+	}
+	if os.Getenv("PAM_TEST_EXISTING") != "new" {
+		t.Fatalf("exportenv #error: expected new, got %v", os.Getenv("PAM_TEST_EXISTING"))
+	}
+}
+
+func TestEnvDiff(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.PutEnvList([]string{"MAIL=/var/mail/test", "PATH=/bin"}); err != nil {
+		t.Fatalf("putenvlist #error: %v", err)
+	}
+	before, err := tx.SnapshotEnv()
+	if err != nil {
+		t.Fatalf("snapshotenv #error: %v", err)
+	}
+	if d := before.Diff(before); !d.Empty() {
+		t.Fatalf("diff #error: expected no changes, got %v", d)
+	}
+	if err := tx.PutEnvList([]string{"MAIL", "PATH=/usr/bin:/bin", "KRB5CCNAME=FILE:/tmp/krb5cc"}); err != nil {
+		t.Fatalf("putenvlist #error: %v", err)
+	}
+	after, err := tx.SnapshotEnv()
+	if err != nil {
+		t.Fatalf("snapshotenv #error: %v", err)
+	}
+	d := before.Diff(after)
+	if d.Added["KRB5CCNAME"] != "FILE:/tmp/krb5cc" || d.Removed["MAIL"] != "/var/mail/test" ||
+		d.Changed["PATH"] != (EnvChange{"/bin", "/usr/bin:/bin"}) {
+		t.Fatalf("diff #error: unexpected %#v", d)
+	}
+	expected := "+KRB5CCNAME=FILE:/tmp/krb5cc -MAIL ~PATH=/bin->/usr/bin:/bin"
+	if s := d.String(); s != expected {
+		t.Fatalf("diff #error: expected %v, got %v", expected, s)
+	}
+}
+
+func TestSessionInfo(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	info, err := tx.SessionInfo()
+	if err != nil {
+		t.Fatalf("sessioninfo #error: %v", err)
+	}
+	if info.XDGSessionID != "" || info.Path != nil || info.XDGVTNr != 0 {
+		t.Fatalf("sessioninfo #error: expected an empty info, got %+v", info)
+	}
+	err = tx.PutEnvPairs(map[string]string{
+		"KRB5CCNAME":      "FILE:/tmp/krb5cc_1000",
+		"XDG_SESSION_ID":  "3",
+		"XDG_RUNTIME_DIR": "/run/user/1000",
+		"XDG_SEAT":        "seat0",
+		"XDG_VTNR":        "2",
+		"MAIL":            "/var/mail/test",
+		"PATH":            "/usr/bin:/bin",
+	})
+	if err != nil {
+		t.Fatalf("putenvpairs #error: %v", err)
+	}
+	info, err = tx.SessionInfo()
+	if err != nil {
+		t.Fatalf("sessioninfo #error: %v", err)
+	}
+	if info.Krb5CCName != "FILE:/tmp/krb5cc_1000" || info.XDGSessionID != "3" ||
+		info.XDGRuntimeDir != "/run/user/1000" || info.XDGSeat != "seat0" ||
+		info.XDGVTNr != 2 || info.Mail != "/var/mail/test" ||
+		strings.Join(info.Path, " ") != "/usr/bin /bin" {
+		t.Fatalf("sessioninfo #error: unexpected %+v", info)
+	}
+	tx.End()
+	if _, err := tx.SessionInfo(); !errors.Is(err, ErrTransactionClosed) {
+		t.Fatalf("sessioninfo #expected %v, got %v", ErrTransactionClosed, err)
+	}
+}
@@ -0,0 +1,209 @@
+package pam
+
+//#include <security/pam_appl.h>
+import "C"
+
+import (
+	"errors"
+	"strings"
+)
+
+// Error is a PAM return code. Every failing call of the PAM API reports its
+// status as an Error, so that callers can match the failure reason using
+// errors.Is and errors.As.
+type Error int
+
+// PAM return codes.
+const (
+	// ErrOpen indicates a dlopen() failure when dynamically loading a
+	// service module.
+	ErrOpen Error = C.PAM_OPEN_ERR
+	// ErrSymbol indicates a symbol not found.
+	ErrSymbol Error = C.PAM_SYMBOL_ERR
+	// ErrService indicates an error in the service module.
+	ErrService Error = C.PAM_SERVICE_ERR
+	// ErrSystem indicates a system error.
+	ErrSystem Error = C.PAM_SYSTEM_ERR
+	// ErrBuf indicates a memory buffer error.
+	ErrBuf Error = C.PAM_BUF_ERR
+	// ErrPermDenied indicates that permission was denied.
+	ErrPermDenied Error = C.PAM_PERM_DENIED
+	// ErrAuth indicates an authentication failure.
+	ErrAuth Error = C.PAM_AUTH_ERR
+	// ErrCredInsufficient indicates that authentication data can not be
+	// accessed due to insufficient credentials.
+	ErrCredInsufficient Error = C.PAM_CRED_INSUFFICIENT
+	// ErrAuthinfoUnavail indicates that the underlying authentication service
+	// can not retrieve authentication information.
+	ErrAuthinfoUnavail Error = C.PAM_AUTHINFO_UNAVAIL
+	// ErrUserUnknown indicates a user that is not known to the underlying
+	// authentication module.
+	ErrUserUnknown Error = C.PAM_USER_UNKNOWN
+	// ErrMaxTries indicates that an authentication service has maintained a
+	// retry count which has been reached. No further retries should be
+	// attempted.
+	ErrMaxTries Error = C.PAM_MAXTRIES
+	// ErrNewAuthTokRequired indicates that a new authentication token is required.
+	// This is normally returned if the machine security policies require
+	// that the password should be changed because the password is nil or it
+	// has aged.
+	ErrNewAuthTokRequired Error = C.PAM_NEW_AUTHTOK_REQD
+	// ErrAcctExpired indicates that the user account has expired.
+	ErrAcctExpired Error = C.PAM_ACCT_EXPIRED
+	// ErrSession indicates that an entry for the specified session
+	// could not be made or removed.
+	ErrSession Error = C.PAM_SESSION_ERR
+	// ErrCredUnavail indicates that an underlying authentication service
+	// can not retrieve user credentials.
+	ErrCredUnavail Error = C.PAM_CRED_UNAVAIL
+	// ErrCredExpired indicates that the user credentials have expired.
+	ErrCredExpired Error = C.PAM_CRED_EXPIRED
+	// ErrCred indicates a failure setting user credentials.
+	ErrCred Error = C.PAM_CRED_ERR
+	// ErrNoModuleData indicates that no module specific data is present.
+	ErrNoModuleData Error = C.PAM_NO_MODULE_DATA
+	// ErrConv indicates a conversation error.
+	ErrConv Error = C.PAM_CONV_ERR
+	// ErrAuthTok indicates an authentication token manipulation error.
+	ErrAuthTok Error = C.PAM_AUTHTOK_ERR
+	// ErrAuthTokRecovery indicates that authentication information can
+	// not be recovered.
+	ErrAuthTokRecovery Error = C.PAM_AUTHTOK_RECOVERY_ERR
+	// ErrAuthTokLockBusy indicates that the authentication token lock is busy.
+	ErrAuthTokLockBusy Error = C.PAM_AUTHTOK_LOCK_BUSY
+	// ErrAuthTokDisableAging indicates that authentication token aging is
+	// disabled.
+	ErrAuthTokDisableAging Error = C.PAM_AUTHTOK_DISABLE_AGING
+	// ErrTryAgain indicates that a preliminary check by the password
+	// service failed.
+	ErrTryAgain Error = C.PAM_TRY_AGAIN
+	// ErrIgnore indicates to ignore underlying account module regardless
+	// of whether the control flag is required, optional, or sufficient.
+	ErrIgnore Error = C.PAM_IGNORE
+	// ErrAbort indicates a critical error (module fail now request).
+	ErrAbort Error = C.PAM_ABORT
+	// ErrAuthTokExpired indicates that the user's authentication token has
+	// expired.
+	ErrAuthTokExpired Error = C.PAM_AUTHTOK_EXPIRED
+	// ErrModuleUnknown indicates that a module is not known.
+	ErrModuleUnknown Error = C.PAM_MODULE_UNKNOWN
+	// ErrBadItem indicates a bad item passed to pam_*_item().
+	ErrBadItem Error = C.PAM_BAD_ITEM
+	// ErrConvAgain indicates that the conversation function is event
+	// driven and data is not available yet.
+	ErrConvAgain Error = C.PAM_CONV_AGAIN
+	// ErrIncomplete indicates that the function should be called again
+	// to complete the authentication stack. Before calling again, verify that
+	// the conversation is completed.
+	ErrIncomplete Error = C.PAM_INCOMPLETE
+)
+
+// Error returns the error message for the given status, as returned by
+// pam_strerror.
+func (status Error) Error() string {
+	return StrError(status)
+}
+
+// StrError returns the human readable message describing a PAM status, as
+// returned by pam_strerror. It does not require a transaction, so that raw
+// status codes, such as the ones stored in logs, can be rendered.
+func StrError(status Error) string {
+	return C.GoString(C.pam_strerror(nil, C.int(status)))
+}
+
+// OpError is the error returned by the Transaction methods, it describes the
+// PAM operation that failed and wraps its Error.
+type OpError struct {
+	// Op is the name of the PAM function that failed, such as
+	// "pam_acct_mgmt".
+	Op string
+	// Args describes the relevant arguments of the operation, if any.
+	Args string
+	// Err is the error returned by the operation.
+	Err error
+}
+
+func (e *OpError) Error() string {
+	if e.Args == "" {
+		return e.Op + ": " + e.Err.Error()
+	}
+	return e.Op + "(" + e.Args + "): " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error of the operation.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// AuthError is returned by a failing operation when the transaction
+// collects the module messages, see Transaction.CollectMessages.
+type AuthError struct {
+	// Err is the error returned by the operation.
+	Err error
+	// Messages are the ErrorMsg and TextInfo messages that the modules
+	// sent during the operation.
+	Messages []Message
+}
+
+func (e *AuthError) Error() string {
+	msgs := make([]string, 0, len(e.Messages))
+	for _, m := range e.Messages {
+		msgs = append(msgs, m.Msg)
+	}
+	return e.Err.Error() + " (" + strings.Join(msgs, "; ") + ")"
+}
+
+// Unwrap returns the underlying error of the operation.
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidArgument is returned when a value can not be passed to PAM, such
+// as a string containing NUL bytes that would otherwise be silently
+// truncated.
+var ErrInvalidArgument = errors.New("pam: invalid argument")
+
+// checkCString returns ErrInvalidArgument if s can not be converted to a C
+// string without being truncated.
+func checkCString(s string) error {
+	if strings.IndexByte(s, 0) >= 0 {
+		return ErrInvalidArgument
+	}
+	return nil
+}
+
+// FlagsError is returned when an operation is called with flags that it does
+// not accept, it matches ErrInvalidArgument.
+type FlagsError struct {
+	// Flags are the flags that were passed to the operation.
+	Flags Flags
+	// Allowed are the flags accepted by the operation.
+	Allowed Flags
+	// Exclusive are the allowed flags of which at most one can be set.
+	Exclusive Flags
+}
+
+func (e *FlagsError) Error() string {
+	msg := "pam: invalid flags " + e.Flags.String() + ", allowed: " + e.Allowed.String()
+	if e.Exclusive != 0 {
+		msg += " (only one of " + e.Exclusive.String() + ")"
+	}
+	return msg
+}
+
+// Unwrap returns ErrInvalidArgument.
+func (e *FlagsError) Unwrap() error {
+	return ErrInvalidArgument
+}
+
+// ErrTransactionClosed is returned by the methods of a transaction that has
+// already ended.
+var ErrTransactionClosed = errors.New("pam: transaction has ended")
+
+// ErrCallAbandoned is returned by the operations of a transaction that were
+// abandoned, and by any later use of the transaction, see WithAbandonAfter.
+var ErrCallAbandoned = errors.New("pam: call abandoned")
+
+// ErrConcurrentUse is the value of the panic raised when two goroutines use
+// a transaction at the same time, see WithConcurrentUseCheck.
+var ErrConcurrentUse = errors.New("pam: concurrent use of a transaction")
@@ -0,0 +1,45 @@
+package pam
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	for _, e := range []Error{ErrAuth, ErrMaxTries, ErrPermDenied,
+		ErrUserUnknown, ErrNewAuthTokRequired, ErrIncomplete} {
+		if len(e.Error()) == 0 {
+			t.Fatalf("error #expected an error message for %d", e)
+		}
+		wrapped := fmt.Errorf("wrapped: %w", e)
+		if !errors.Is(wrapped, e) {
+			t.Fatalf("error #expected %v to match %v", wrapped, e)
+		}
+		var target Error
+		if !errors.As(wrapped, &target) || target != e {
+			t.Fatalf("error #expected %v to be extracted from %v", e, wrapped)
+		}
+	}
+	if ErrAuth.Error() == ErrMaxTries.Error() {
+		t.Fatalf("error #expected different messages, got %v", ErrAuth)
+	}
+}
+
+func TestStrError(t *testing.T) {
+	if s := StrError(ErrAuth); s != ErrAuth.Error() {
+		t.Fatalf("strerror #error: expected %q, got %q", ErrAuth.Error(), s)
+	}
+	if s := StrError(Error(0)); len(s) == 0 {
+		t.Fatalf("strerror #error: expected a message for success")
+	}
+	tx, err := StartFunc("", "", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if s := tx.StrError(ErrMaxTries); s != StrError(ErrMaxTries) {
+		t.Fatalf("strerror #error: expected %q, got %q", StrError(ErrMaxTries), s)
+	}
+}
@@ -43,6 +43,7 @@ func Example() {
 		fmt.Fprintf(os.Stderr, "start: %s\n", err.Error())
 		os.Exit(1)
 	}
+	defer t.End()
 	err = t.Authenticate(0)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "authenticate: %s\n", err.Error())
@@ -50,3 +51,39 @@ func Example() {
 	}
 	fmt.Println("authentication succeeded!")
 }
+
+// This example validates the user account, requesting a new authentication
+// token if the current one has expired.
+func ExampleTransaction_AcctMgmt() {
+	t, err := pam.StartFunc("", "test", func(s pam.Style, msg string) (string, error) {
+		return "secret", nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start: %s\n", err.Error())
+		os.Exit(1)
+	}
+	err = t.AcctMgmt(0)
+	if errors.Is(err, pam.ErrNewAuthTokRequired) {
+		err = t.ChangeAuthTok(pam.ChangeExpiredAuthtok)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "account: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("account is valid!")
+}
+
+// This example authenticates a user on the terminal.
+func ExampleTTYConversationHandler() {
+	t, err := pam.Start("", "", &pam.TTYConversationHandler{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer t.End()
+	if err := t.Authenticate(0); err != nil {
+		fmt.Fprintf(os.Stderr, "authenticate: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("authentication succeeded!")
+}
@@ -0,0 +1,31 @@
+#include "_cgo_export.h"
+#include <security/pam_appl.h>
+#include <stdint.h>
+
+#ifdef PAM_FAIL_DELAY
+static void cb_pam_fail_delay(int retval, unsigned usec_delay, void *appdata_ptr)
+{
+	cbPAMFailDelay(retval, usec_delay, (uintptr_t)appdata_ptr);
+}
+
+int fail_delay(pam_handle_t *pamh, unsigned int usec)
+{
+	return pam_fail_delay(pamh, usec);
+}
+
+int set_fail_delay_handler(pam_handle_t *pamh, int enable)
+{
+	void (*fn)(int, unsigned, void *) = enable ? cb_pam_fail_delay : NULL;
+	return pam_set_item(pamh, PAM_FAIL_DELAY, (const void *)fn);
+}
+#else
+int fail_delay(pam_handle_t *pamh, unsigned int usec)
+{
+	return PAM_SYSTEM_ERR;
+}
+
+int set_fail_delay_handler(pam_handle_t *pamh, int enable)
+{
+	return PAM_BAD_ITEM;
+}
+#endif
@@ -0,0 +1,86 @@
+package pam
+
+//#include <security/pam_appl.h>
+//#include <stdint.h>
+//
+//int fail_delay(pam_handle_t *pamh, unsigned int usec);
+//int set_fail_delay_handler(pam_handle_t *pamh, int enable);
+import "C"
+
+import (
+	"math"
+	"runtime/cgo"
+	"sync/atomic"
+	"time"
+)
+
+// FailDelayHandler is called by PAM after a failing operation instead of
+// sleeping for the fail delay requested by the application and the modules,
+// so that the delay can be scheduled in a different way.
+type FailDelayHandler func(status Error, delay time.Duration)
+
+// cbPAMFailDelay is a wrapper for the fail delay callback function.
+//
+//export cbPAMFailDelay
+func cbPAMFailDelay(status C.int, usecDelay C.uint, c C.uintptr_t) {
+	if c == 0 {
+		return
+	}
+	state, ok := cgo.Handle(c).Value().(*conversation)
+	if !ok {
+		return
+	}
+	state.mu.Lock()
+	handler := state.failDelay
+	state.mu.Unlock()
+	if handler != nil {
+		defer state.register(&callback{})()
+		atomic.AddInt32(&state.active, 1)
+		defer atomic.AddInt32(&state.active, -1)
+		handler(Error(status), time.Duration(usecDelay)*time.Microsecond)
+	}
+}
+
+// SetFailDelayHandler installs a function, through the PAM_FAIL_DELAY item,
+// that PAM calls instead of blocking the thread for the fail delay. This is
+// useful for event loop based servers to delay the failure response
+// asynchronously. A nil handler restores the default behavior.
+//
+// The handler is only called for transactions using a Go conversation
+// handler. Linux-PAM extension.
+func (t *Transaction) SetFailDelayHandler(handler FailDelayHandler) error {
+	if err := t.checkEnded("pam_set_item"); err != nil {
+		return err
+	}
+	if t.state == nil {
+		return t.handlePamStatus(C.PAM_BAD_ITEM, "pam_set_item", "PAM_FAIL_DELAY")
+	}
+	t.state.mu.Lock()
+	t.state.failDelay = handler
+	t.state.mu.Unlock()
+	enable := C.int(0)
+	if handler != nil {
+		enable = 1
+	}
+	return t.handlePamStatus(t.run(func() C.int {
+		return C.set_fail_delay_handler(t.handle, enable)
+	}),
+		"pam_set_item", "PAM_FAIL_DELAY")
+}
+
+// FailDelay requests that a failing operation is delayed by at least d, as
+// pam_fail_delay does. The longest of the delays requested by the
+// application and the modules is used, PAM may randomize it slightly.
+// Linux-PAM extension.
+func (t *Transaction) FailDelay(d time.Duration) error {
+	if err := t.checkEnded("pam_fail_delay"); err != nil {
+		return err
+	}
+	usec := d / time.Microsecond
+	if usec < 0 || usec > math.MaxUint32 {
+		return &OpError{Op: "pam_fail_delay", Args: d.String(), Err: ErrInvalidArgument}
+	}
+	return t.handlePamStatus(t.run(func() C.int {
+		return C.fail_delay(t.handle, C.uint(usec))
+	}), "pam_fail_delay", d)
+}
@@ -0,0 +1,84 @@
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"testing"
+	"time"
+)
+
+func TestFailDelayHandler(t *testing.T) {
+	u, _ := user.Current()
+	tx, err := StartConfDir("deny-service", u.Username, nil, "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	var statuses []Error
+	err = tx.SetFailDelayHandler(func(status Error, delay time.Duration) {
+		statuses = append(statuses, status)
+	})
+	if err != nil {
+		t.Fatalf("setfaildelayhandler #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrAuth, err)
+	}
+	if len(statuses) != 1 || statuses[0] != ErrAuth {
+		t.Fatalf("faildelay #unexpected calls: %v", statuses)
+	}
+	err = tx.SetFailDelayHandler(nil)
+	if err != nil {
+		t.Fatalf("setfaildelayhandler #error: %v", err)
+	}
+	_ = tx.Authenticate(0)
+	if len(statuses) != 1 {
+		t.Fatalf("faildelay #unexpected calls: %v", statuses)
+	}
+}
+
+func TestFailDelay(t *testing.T) {
+	u, _ := user.Current()
+	tx, err := StartConfDir("deny-service", u.Username, nil, "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	err = tx.FailDelay(-time.Second)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("faildelay #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	err = tx.FailDelay(100 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("faildelay #error: %v", err)
+	}
+	var delay time.Duration
+	err = tx.SetFailDelayHandler(func(status Error, d time.Duration) {
+		delay = d
+	})
+	if err != nil {
+		t.Fatalf("setfaildelayhandler #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrAuth, err)
+	}
+	if delay <= 0 {
+		t.Fatalf("faildelay #expected a delay, got %v", delay)
+	}
+}
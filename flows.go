@@ -0,0 +1,161 @@
+package pam
+
+import (
+	"regexp"
+	"sync"
+)
+
+// TwoFactorHandler is a conversation handler for stacks asking a password
+// and then a second factor, such as pam_unix followed by
+// pam_google_authenticator: the first PromptEchoOff prompt is answered by
+// Password and the following prompts by SecondFactor. A PromptEchoOn prompt
+// received before the password is answered with User.
+type TwoFactorHandler struct {
+	// User is the answer to the user name prompt.
+	User string
+	// Password returns the password, given the prompt.
+	Password func(prompt string) (string, error)
+	// SecondFactor returns the second factor, such as a one-time password,
+	// given the prompt.
+	SecondFactor func(prompt string) (string, error)
+	// Unexpected is called for the prompts that can not be answered, such as
+	// a user name prompt without User or a second factor prompt without
+	// SecondFactor. If nil, they fail with ErrConv.
+	Unexpected func(Style, string) (string, error)
+	// OnMessage is called for the TextInfo and ErrorMsg messages, if not
+	// nil.
+	OnMessage func(Message)
+
+	mu       sync.Mutex
+	password bool
+}
+
+// RespondPAM answers the prompt depending on the step of the flow.
+func (h *TwoFactorHandler) RespondPAM(s Style, msg string) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case s == TextInfo || s == ErrorMsg:
+		if h.OnMessage != nil {
+			h.OnMessage(Message{Style: s, Msg: msg})
+		}
+		return "", nil
+	case !h.password && s == PromptEchoOn && h.User != "":
+		return h.User, nil
+	case !h.password && s == PromptEchoOff && h.Password != nil:
+		h.password = true
+		return h.Password(msg)
+	case h.password && isPrompt(s) && h.SecondFactor != nil:
+		return h.SecondFactor(msg)
+	case h.Unexpected != nil:
+		return h.Unexpected(s, msg)
+	}
+	return "", ErrConv
+}
+
+// Reset restarts the flow, so that the next password prompt is answered by
+// Password again. A transaction uses its own copy of the handler, which
+// Transaction.ResetConversationHandler resets, such as before retrying
+// Authenticate.
+func (h *TwoFactorHandler) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.password = false
+}
+
+// CloneConversationHandler returns a copy of the handler at the start of the
+// flow, so that a single TwoFactorHandler can be shared by transactions.
+func (h *TwoFactorHandler) CloneConversationHandler() ConversationHandler {
+	return &TwoFactorHandler{
+		User:         h.User,
+		Password:     h.Password,
+		SecondFactor: h.SecondFactor,
+		Unexpected:   h.Unexpected,
+		OnMessage:    h.OnMessage,
+	}
+}
+
+// PasswordChangeMatchers recognize the prompts sent by the modules during a
+// password change, they are checked in the order Retype, Current and New.
+type PasswordChangeMatchers struct {
+	Current *regexp.Regexp
+	New     *regexp.Regexp
+	Retype  *regexp.Regexp
+}
+
+// DefaultPasswordChangeMatchers recognize the English prompts of the common
+// modules, such as pam_unix and pam_pwquality:
+// "Current password: ", "New password: " and "Retype new password: ".
+var DefaultPasswordChangeMatchers = PasswordChangeMatchers{
+	Current: regexp.MustCompile(`(?i)(current|old).*password|^password:\s*$`),
+	New:     regexp.MustCompile(`(?i)new.*password`),
+	Retype:  regexp.MustCompile(`(?i)(retype|re-enter|repeat|again|confirm|verify).*password`),
+}
+
+// PasswordChangeHandler is a conversation handler answering the prompts of
+// a password change with the current and the new password.
+type PasswordChangeHandler struct {
+	Old string
+	New string
+	// Matchers recognize the prompts, DefaultPasswordChangeMatchers are
+	// used if nil.
+	Matchers *PasswordChangeMatchers
+	// OnMessage is called for the TextInfo and ErrorMsg messages, such as
+	// the reasons why the new password is rejected, if not nil.
+	OnMessage func(Message)
+}
+
+// NewPasswordChangeHandler returns a PasswordChangeHandler using the
+// default matchers.
+func NewPasswordChangeHandler(old, new string) *PasswordChangeHandler {
+	return &PasswordChangeHandler{Old: old, New: new}
+}
+
+// RespondPAM answers the password prompts, unrecognized prompts fail with
+// ErrConv.
+func (h *PasswordChangeHandler) RespondPAM(s Style, msg string) (string, error) {
+	if s == TextInfo || s == ErrorMsg {
+		if h.OnMessage != nil {
+			h.OnMessage(Message{Style: s, Msg: msg})
+		}
+		return "", nil
+	}
+	m := h.Matchers
+	if m == nil {
+		m = &DefaultPasswordChangeMatchers
+	}
+	if s != PromptEchoOff {
+		return "", ErrConv
+	}
+	switch {
+	case m.Retype != nil && m.Retype.MatchString(msg):
+		return h.New, nil
+	case m.Current != nil && m.Current.MatchString(msg):
+		return h.Old, nil
+	case m.New != nil && m.New.MatchString(msg):
+		return h.New, nil
+	}
+	return "", ErrConv
+}
+
+// ChangeAuthTok changes the authentication token of the user of the
+// transaction using the handler. The previous conversation handler, with the
+// state of its conversation, is restored afterwards, the error restoring it
+// is returned if the change succeeded.
+func (h *PasswordChangeHandler) ChangeAuthTok(t *Transaction, f Flags) (err error) {
+	var prev ConversationHandler
+	if t.state != nil {
+		t.state.mu.Lock()
+		prev = t.state.handler
+		t.state.mu.Unlock()
+	}
+	if err := t.SetConversationHandler(h); err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := t.setConversationHandler(prev); err == nil {
+			err = rerr
+		}
+	}()
+	return t.ChangeAuthTok(f)
+}
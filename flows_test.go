@@ -0,0 +1,139 @@
+package pam
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestTwoFactorHandler(t *testing.T) {
+	var infos []string
+	h := &TwoFactorHandler{
+		User: "test",
+		Password: func(prompt string) (string, error) {
+			return "secret", nil
+		},
+		SecondFactor: func(prompt string) (string, error) {
+			return "123456", nil
+		},
+		OnMessage: func(m Message) {
+			infos = append(infos, m.Msg)
+		},
+	}
+	steps := []struct {
+		style    Style
+		msg      string
+		expected string
+	}{
+		{PromptEchoOn, "login: ", "test"},
+		{PromptEchoOff, "Password: ", "secret"},
+		{TextInfo, "Check your phone", ""},
+		{PromptEchoOff, "Verification code: ", "123456"},
+		{PromptEchoOn, "Verification code: ", "123456"},
+	}
+	for _, st := range steps {
+		r, err := h.RespondPAM(st.style, st.msg)
+		if err != nil || r != st.expected {
+			t.Fatalf("respondpam #error: expected %q, got %q, %v", st.expected, r, err)
+		}
+	}
+	if len(infos) != 1 {
+		t.Fatalf("respondpam #unexpected messages: %v", infos)
+	}
+	h.Reset()
+	if r, err := h.RespondPAM(PromptEchoOff, "Password: "); err != nil || r != "secret" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+}
+
+func TestTwoFactorHandlerUnexpected(t *testing.T) {
+	h := &TwoFactorHandler{Password: func(string) (string, error) { return "secret", nil }}
+	if _, err := h.RespondPAM(PromptEchoOn, "login: "); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %v", ErrConv, err)
+	}
+	if _, err := h.RespondPAM(PromptEchoOff, "Password: "); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if _, err := h.RespondPAM(PromptEchoOff, "Verification code: "); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %v", ErrConv, err)
+	}
+	h.Unexpected = func(s Style, msg string) (string, error) {
+		return "fallback", nil
+	}
+	if r, err := h.RespondPAM(PromptEchoOff, "PIN: "); err != nil || r != "fallback" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+}
+
+func TestPasswordChangeHandler(t *testing.T) {
+	h := NewPasswordChangeHandler("old", "new")
+	tests := []struct {
+		msg      string
+		expected string
+	}{
+		{"(current) UNIX password: ", "old"},
+		{"Current password: ", "old"},
+		{"Password: ", "old"},
+		{"New password: ", "new"},
+		{"Retype new password: ", "new"},
+		{"Enter new UNIX password: ", "new"},
+		{"Retype new UNIX password: ", "new"},
+	}
+	for _, tt := range tests {
+		r, err := h.RespondPAM(PromptEchoOff, tt.msg)
+		if err != nil || r != tt.expected {
+			t.Fatalf("respondpam #error: %q: expected %q, got %q, %v", tt.msg, tt.expected, r, err)
+		}
+	}
+	if _, err := h.RespondPAM(PromptEchoOff, "Verification code: "); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %v", ErrConv, err)
+	}
+	h.Matchers = &PasswordChangeMatchers{
+		Current: regexp.MustCompile(`^Mot de passe actuel`),
+		New:     regexp.MustCompile(`^Nouveau mot de passe`),
+		Retype:  regexp.MustCompile(`^Retapez le nouveau`),
+	}
+	if r, err := h.RespondPAM(PromptEchoOff, "Mot de passe actuel : "); err != nil || r != "old" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+	if r, err := h.RespondPAM(PromptEchoOff, "Retapez le nouveau mot de passe : "); err != nil || r != "new" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+}
+
+func TestPasswordChangeHandlerChangeAuthTok(t *testing.T) {
+	prev := ConversationFunc(func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	tx, err := StartConfDir("password-permit-service", "test", prev, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := NewPasswordChangeHandler("old", "new").ChangeAuthTok(tx, 0); err != nil {
+		t.Fatalf("changeauthtok #error: %v", err)
+	}
+	if _, ok := tx.state.handler.(ConversationFunc); !ok {
+		t.Fatalf("changeauthtok #error: handler not restored: %v", tx.state.handler)
+	}
+}
+
+func TestPasswordChangeHandlerRestoresState(t *testing.T) {
+	tx, err := StartConfDir("password-permit-service", "test", &TwoFactorHandler{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	prev := tx.state.handler.(*TwoFactorHandler)
+	prev.password = true
+	if err := NewPasswordChangeHandler("old", "new").ChangeAuthTok(tx, 0); err != nil {
+		t.Fatalf("changeauthtok #error: %v", err)
+	}
+	if h, ok := tx.state.handler.(*TwoFactorHandler); !ok || h != prev || !h.password {
+		t.Fatalf("changeauthtok #error: handler state not restored: %v", tx.state.handler)
+	}
+	tx.ResetConversationHandler()
+	if prev.password {
+		t.Fatalf("resetconversationhandler #error: flow not restarted")
+	}
+}
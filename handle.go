@@ -0,0 +1,82 @@
+package pam
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// TransactionHandle is the set of Transaction methods that libraries built
+// on this package need, so that they can accept either a Transaction or a
+// fake one, such as pamtest.MockTransaction.
+//
+// The helpers implemented on top of these methods (ApplyEnv, SnapshotEnv,
+// SessionInfo, the Result methods...) and the methods exposing the native
+// handle or platform specific features are not part of it. The helper
+// packages of this module, such as accounting and logind, accept it.
+type TransactionHandle interface {
+	Authenticate(f Flags) error
+	SetCred(f Flags) error
+	AcctMgmt(f Flags) error
+	ChangeAuthTok(f Flags) error
+	OpenSession(f Flags) error
+	CloseSession(f Flags) error
+	AuthenticateContext(ctx context.Context, f Flags) error
+	SetCredContext(ctx context.Context, f Flags) error
+	AcctMgmtContext(ctx context.Context, f Flags) error
+	ChangeAuthTokContext(ctx context.Context, f Flags) error
+	OpenSessionContext(ctx context.Context, f Flags) error
+	CloseSessionContext(ctx context.Context, f Flags) error
+	Resume() error
+	End() error
+	EndWithFlags(f Flags) error
+
+	Status() Error
+	StrError(status Error) string
+	String() string
+	History() []HistoryEntry
+	CollectMessages(enable bool)
+	SetConversationHandler(handler ConversationHandler) error
+	CancelConversation()
+	SetAppData(v any)
+	AppData() any
+	FailDelay(d time.Duration) error
+	Credential() (*syscall.Credential, error)
+
+	GetItem(i Item) (string, error)
+	GetItemBytes(i Item) ([]byte, error)
+	SetItem(i Item, item string) error
+	GetUser(prompt string) (string, error)
+	Service() (string, error)
+	SetService(service string) error
+	User() (string, error)
+	SetUser(user string) error
+	Tty() (string, error)
+	SetTty(tty string) error
+	Rhost() (string, error)
+	SetRhost(rhost string) error
+	Ruser() (string, error)
+	SetRuser(ruser string) error
+	UserPrompt() (string, error)
+	SetUserPrompt(prompt string) error
+	XDisplay() (string, error)
+	SetXDisplay(display string) error
+	AuthtokType() (string, error)
+	SetAuthtokType(authtokType string) error
+	SetAuthTok(tok []byte) error
+	SetOldAuthTok(tok []byte) error
+	GetXAuthData() (name string, data []byte, err error)
+	SetXAuthData(name string, data []byte) error
+
+	PutEnv(nameval string) error
+	SetEnv(name, value string) error
+	UnsetEnv(name string) error
+	GetEnv(name string) string
+	LookupEnv(name string) (string, bool)
+	GetEnvList() (map[string]string, error)
+	Environ() ([]string, error)
+	PutEnvList(list []string) error
+	PutEnvPairs(env map[string]string) error
+}
+
+var _ TransactionHandle = (*Transaction)(nil)
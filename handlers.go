@@ -0,0 +1,277 @@
+package pam
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sync"
+)
+
+// PromptHandler is implemented by the handlers of a Dispatcher that answer
+// prompts. echo reports whether the response can be displayed.
+type PromptHandler interface {
+	OnPrompt(msg string, echo bool) (string, error)
+}
+
+// InfoHandler is implemented by the handlers of a Dispatcher that display
+// TextInfo messages.
+type InfoHandler interface {
+	OnInfo(msg string) error
+}
+
+// ErrorHandler is implemented by the handlers of a Dispatcher that display
+// ErrorMsg messages.
+type ErrorHandler interface {
+	OnError(msg string) error
+}
+
+// RadioHandler is implemented by the handlers of a Dispatcher that answer
+// RadioType prompts.
+type RadioHandler interface {
+	OnRadio(msg string) (string, error)
+}
+
+// BinaryHandler is implemented by the handlers of a Dispatcher that support
+// the binary protocol.
+type BinaryHandler interface {
+	OnBinary(BinaryPointer) ([]byte, error)
+}
+
+// Dispatcher is a conversation handler that dispatches each message to the
+// method of Handler matching its style, so that only the callbacks of
+// interest need to be implemented. Messages without a callback are logged,
+// prompts fail with ErrConv and binary prompts with ErrAuthinfoUnavail, see
+// BinaryDispatcher.
+type Dispatcher struct {
+	// Handler implements any of PromptHandler, InfoHandler, ErrorHandler
+	// and RadioHandler.
+	Handler any
+	// Logger is used to log the messages that have no callback, the
+	// standard logger is used if nil.
+	Logger *log.Logger
+}
+
+// Dispatch returns a Dispatcher for the handler h.
+func Dispatch(h any) *Dispatcher {
+	return &Dispatcher{Handler: h}
+}
+
+// RespondPAM dispatches the message to the handler.
+func (d *Dispatcher) RespondPAM(s Style, msg string) (string, error) {
+	switch s {
+	case PromptEchoOff, PromptEchoOn:
+		if h, ok := d.Handler.(PromptHandler); ok {
+			return h.OnPrompt(msg, s == PromptEchoOn)
+		}
+		return "", ErrConv
+	case RadioType:
+		if h, ok := d.Handler.(RadioHandler); ok {
+			return h.OnRadio(msg)
+		}
+		return "", ErrConv
+	case TextInfo:
+		if h, ok := d.Handler.(InfoHandler); ok {
+			return "", h.OnInfo(msg)
+		}
+	case ErrorMsg:
+		if h, ok := d.Handler.(ErrorHandler); ok {
+			return "", h.OnError(msg)
+		}
+	default:
+		return "", ErrConv
+	}
+	d.logf("pam: %v: %s", s, msg)
+	return "", nil
+}
+
+func (d *Dispatcher) logf(format string, v ...any) {
+	if d.Logger != nil {
+		d.Logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// BinaryDispatcher is a Dispatcher that also dispatches the binary prompts
+// to its Handler, which implements BinaryHandler. As a
+// BinaryConversationHandler, it can only be used on the platforms supporting
+// the binary protocol, see CheckPamHasBinaryProtocol.
+type BinaryDispatcher struct {
+	Dispatcher
+}
+
+// DispatchBinary returns a BinaryDispatcher for the handler h.
+func DispatchBinary(h BinaryHandler) *BinaryDispatcher {
+	return &BinaryDispatcher{Dispatcher{Handler: h}}
+}
+
+// RespondPAMBinary dispatches the binary message to the handler.
+func (d *BinaryDispatcher) RespondPAMBinary(p BinaryPointer) ([]byte, error) {
+	if h, ok := d.Handler.(BinaryHandler); ok {
+		return h.OnBinary(p)
+	}
+	return nil, ErrAuthinfoUnavail
+}
+
+// CredentialsHandler is a conversation handler answering the prompts with
+// credentials that the application already holds: PromptEchoOn with User,
+// the first PromptEchoOff with Password and the second one with OTP, if it
+// is set. Any other prompt fails with ErrConv. Reset, such as through
+// Transaction.ResetConversationHandler, restarts the counting of the
+// prompts for another operation.
+//
+// The Password and OTP slices are zeroed when the transaction ends, also
+// when the handler is wrapped by Chain or by the middlewares of the package,
+// so the handler must not be shared between transactions. This does not
+// wipe every copy of the secrets: the responses are passed to the modules
+// as strings, which can not be wiped.
+type CredentialsHandler struct {
+	User     string
+	Password []byte
+	OTP      []byte
+
+	mu      sync.Mutex
+	prompts int
+}
+
+// RespondPAM answers the prompts with the credentials.
+func (c *CredentialsHandler) RespondPAM(s Style, msg string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch s {
+	case PromptEchoOn:
+		return c.User, nil
+	case PromptEchoOff:
+		c.prompts++
+		switch {
+		case c.prompts == 1 && c.Password != nil:
+			return string(c.Password), nil
+		case c.prompts == 2 && c.OTP != nil:
+			return string(c.OTP), nil
+		}
+		return "", ErrConv
+	case TextInfo, ErrorMsg:
+		return "", nil
+	}
+	return "", ErrConv
+}
+
+// Reset makes the next PromptEchoOff prompt be answered with Password again.
+func (c *CredentialsHandler) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prompts = 0
+}
+
+// Wipe zeroes the Password and OTP slices of the handler, the copies already
+// sent to the modules are not affected.
+func (c *CredentialsHandler) Wipe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wipe(c.Password)
+	wipe(c.OTP)
+	c.Password, c.OTP = nil, nil
+	c.prompts = 0
+}
+
+// AnswerRule is a rule of an AnswerProvider.
+type AnswerRule struct {
+	// Pattern is matched against the text of the prompts.
+	Pattern *regexp.Regexp
+	// Answer is the response to the matching prompts, unless Func is set.
+	Answer string
+	// Func returns the response to a matching prompt.
+	Func func(msg string) (string, error)
+}
+
+// AnswerProvider is a conversation handler answering the prompts using the
+// first of its rules whose pattern matches the prompt. Prompts that match no
+// rule fail with ErrConv, TextInfo and ErrorMsg messages are ignored.
+type AnswerProvider struct {
+	Rules []AnswerRule
+}
+
+// Answer adds a rule answering the prompts matching re with answer.
+func (p *AnswerProvider) Answer(re *regexp.Regexp, answer string) *AnswerProvider {
+	p.Rules = append(p.Rules, AnswerRule{Pattern: re, Answer: answer})
+	return p
+}
+
+// AnswerFunc adds a rule answering the prompts matching re with the result
+// of f.
+func (p *AnswerProvider) AnswerFunc(re *regexp.Regexp, f func(msg string) (string, error)) *AnswerProvider {
+	p.Rules = append(p.Rules, AnswerRule{Pattern: re, Func: f})
+	return p
+}
+
+// RespondPAM answers the prompt using the rules.
+func (p *AnswerProvider) RespondPAM(s Style, msg string) (string, error) {
+	if s == TextInfo || s == ErrorMsg {
+		return "", nil
+	}
+	if !isPrompt(s) {
+		return "", ErrConv
+	}
+	for _, r := range p.Rules {
+		if !r.Pattern.MatchString(msg) {
+			continue
+		}
+		if r.Func != nil {
+			return r.Func(msg)
+		}
+		return r.Answer, nil
+	}
+	return "", ErrConv
+}
+
+// ChannelResponse is the response sent to a ChannelHandler.
+type ChannelResponse struct {
+	Resp string
+	Err  error
+}
+
+// ChannelHandler is a conversation handler that sends each message on
+// Messages and waits for its response on Responses, including for TextInfo
+// and ErrorMsg messages. It allows event loop based programs to handle the
+// conversation in their main goroutine, while the PAM operation is running
+// in another one.
+type ChannelHandler struct {
+	Messages  chan Message
+	Responses chan ChannelResponse
+}
+
+// NewChannelHandler returns a ChannelHandler using unbuffered channels.
+func NewChannelHandler() *ChannelHandler {
+	return &ChannelHandler{
+		Messages:  make(chan Message),
+		Responses: make(chan ChannelResponse),
+	}
+}
+
+// RespondPAM sends the message and waits for its response.
+func (h *ChannelHandler) RespondPAM(s Style, msg string) (string, error) {
+	return h.RespondPAMContext(context.Background(), s, msg)
+}
+
+// RespondPAMContext is like RespondPAM, but gives up with ErrConv once ctx
+// is done, so that no goroutine is left blocked on the channels after the
+// conversation is canceled or times out. The application must then not
+// expect its response to be received.
+func (h *ChannelHandler) RespondPAMContext(ctx context.Context, s Style, msg string) (string, error) {
+	select {
+	case h.Messages <- Message{Style: s, Msg: msg}:
+	case <-ctx.Done():
+		return "", ErrConv
+	}
+	select {
+	case r := <-h.Responses:
+		return r.Resp, r.Err
+	case <-ctx.Done():
+		return "", ErrConv
+	}
+}
+
+// isPrompt returns whether a message of the style expects a response.
+func isPrompt(style Style) bool {
+	return style == PromptEchoOff || style == PromptEchoOn || style == RadioType
+}
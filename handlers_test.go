@@ -0,0 +1,291 @@
+package pam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type promptOnly struct {
+	prompts []string
+}
+
+func (p *promptOnly) OnPrompt(msg string, echo bool) (string, error) {
+	p.prompts = append(p.prompts, msg)
+	if echo {
+		return "test", nil
+	}
+	return "secret", nil
+}
+
+type infoOnly struct {
+	infos []string
+}
+
+func (i *infoOnly) OnInfo(msg string) error {
+	i.infos = append(i.infos, msg)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	var buf bytes.Buffer
+	p := &promptOnly{}
+	d := &Dispatcher{Handler: p, Logger: log.New(&buf, "", 0)}
+	if r, err := d.RespondPAM(PromptEchoOn, "login: "); err != nil || r != "test" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+	if r, err := d.RespondPAM(PromptEchoOff, "Password: "); err != nil || r != "secret" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+	if _, err := d.RespondPAM(ErrorMsg, "Sorry"); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "ErrorMsg: Sorry") {
+		t.Fatalf("respondpam #error: message not logged: %q", buf.String())
+	}
+	if _, ok := ConversationHandler(d).(BinaryConversationHandler); ok {
+		t.Fatalf("dispatcher #error: unexpected binary handler")
+	}
+	if _, err := respondMessage(context.Background(), d, Message{Style: BinaryPrompt}); !errors.Is(err, ErrAuthinfoUnavail) {
+		t.Fatalf("respondpambinary #expected %v, got %v", ErrAuthinfoUnavail, err)
+	}
+	i := &infoOnly{}
+	d = Dispatch(i)
+	if _, err := d.RespondPAM(TextInfo, "Welcome"); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if len(i.infos) != 1 || i.infos[0] != "Welcome" {
+		t.Fatalf("respondpam #unexpected infos: %v", i.infos)
+	}
+	if _, err := d.RespondPAM(PromptEchoOff, "Password: "); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestCredentialsHandler(t *testing.T) {
+	c := &CredentialsHandler{User: "test", Password: []byte("secret"), OTP: []byte("123456")}
+	if s, err := c.RespondPAM(PromptEchoOn, "login: "); err != nil || s != "test" {
+		t.Fatalf("respondpam #error: %q, %v", s, err)
+	}
+	if _, err := c.RespondPAM(TextInfo, "Welcome"); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if s, err := c.RespondPAM(PromptEchoOff, "Password: "); err != nil || s != "secret" {
+		t.Fatalf("respondpam #error: %q, %v", s, err)
+	}
+	if s, err := c.RespondPAM(PromptEchoOff, "Verification code: "); err != nil || s != "123456" {
+		t.Fatalf("respondpam #error: %q, %v", s, err)
+	}
+	if _, err := c.RespondPAM(PromptEchoOff, "Password: "); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %v", ErrConv, err)
+	}
+	c.Reset()
+	if s, err := c.RespondPAM(PromptEchoOff, "Password: "); err != nil || s != "secret" {
+		t.Fatalf("respondpam #error after reset: %q, %v", s, err)
+	}
+	password := c.Password
+	c.Wipe()
+	if c.Password != nil || !bytes.Equal(password, make([]byte, len(password))) {
+		t.Fatalf("wipe #error: password not zeroed: %v", password)
+	}
+}
+
+func TestCredentialsHandlerEnd(t *testing.T) {
+	c := &CredentialsHandler{User: "test", Password: []byte("secret")}
+	tx, err := StartConfDir("permit-service", "", c, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	password := c.Password
+	if err := tx.End(); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	if c.Password != nil || string(password) == "secret" {
+		t.Fatalf("end #error: password not zeroed: %v", password)
+	}
+}
+
+func TestCredentialsHandlerChainEnd(t *testing.T) {
+	c := &CredentialsHandler{User: "test", Password: []byte("secret")}
+	h := Chain(c, LogMessages(log.New(io.Discard, "", 0)))
+	tx, err := StartConfDir("permit-service", "", h, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	password := c.Password
+	if err := tx.End(); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	if c.Password != nil || string(password) == "secret" {
+		t.Fatalf("end #error: password not zeroed: %v", password)
+	}
+}
+
+func TestAnswerProvider(t *testing.T) {
+	p := (&AnswerProvider{}).
+		Answer(regexp.MustCompile(`^Password: $`), "secret").
+		AnswerFunc(regexp.MustCompile(`(?i)verification code`), func(msg string) (string, error) {
+			return "123456", nil
+		}).
+		Answer(regexp.MustCompile(`.`), "fallback")
+	tests := []struct {
+		style    Style
+		msg      string
+		expected string
+	}{
+		{PromptEchoOff, "Password: ", "secret"},
+		{PromptEchoOn, "Verification code: ", "123456"},
+		{PromptEchoOff, "PIN: ", "fallback"},
+		{TextInfo, "Password: ", ""},
+	}
+	for _, tt := range tests {
+		s, err := p.RespondPAM(tt.style, tt.msg)
+		if err != nil || s != tt.expected {
+			t.Fatalf("respondpam #error: expected %q, got %q, %v", tt.expected, s, err)
+		}
+	}
+	if _, err := p.RespondPAM(PromptEchoOff, ""); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestChannelHandler(t *testing.T) {
+	h := NewChannelHandler()
+	tx, err := StartConfDir("succeed-if-user-test", "", h, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	done := make(chan error)
+	go func() {
+		done <- tx.Authenticate(0)
+	}()
+	m := <-h.Messages
+	if m.Style != PromptEchoOn {
+		t.Fatalf("channelhandler #error: unexpected message %v", m)
+	}
+	h.Responses <- ChannelResponse{Resp: "testuser"}
+	if err := <-done; err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+}
+
+type ctxKey struct{}
+
+func TestContextConversationHandler(t *testing.T) {
+	parent := context.WithValue(context.Background(), ctxKey{}, "value")
+	var got context.Context
+	var gotErr error
+	h := ContextConversationFunc(func(ctx context.Context, s Style, msg string) (string, error) {
+		got, gotErr = ctx, ctx.Err()
+		return "testuser", nil
+	})
+	tx, err := StartWithOptions("succeed-if-user-test", "", h,
+		WithConfDir("test-services"), WithContext(parent))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if got == nil || got.Value(ctxKey{}) != "value" {
+		t.Fatalf("respondpamcontext #error: unexpected context %v", got)
+	}
+	if gotErr != nil {
+		t.Fatalf("respondpamcontext #error: context canceled during the conversation")
+	}
+	tx.End()
+	if !errors.Is(got.Err(), context.Canceled) {
+		t.Fatalf("end #expected %v, got %v", context.Canceled, got.Err())
+	}
+	if s, err := h.RespondPAM(PromptEchoOn, ""); err != nil || s != "testuser" {
+		t.Fatalf("respondpam #error: %q, %v", s, err)
+	}
+}
+
+func TestCancelConversation(t *testing.T) {
+	h := NewChannelHandler()
+	tx, err := StartConfDir("succeed-if-user-test", "", h, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	done := make(chan error)
+	go func() {
+		done <- tx.Authenticate(0)
+	}()
+	<-h.Messages
+	tx.CancelConversation()
+	if err := <-done; !errors.Is(err, ErrConv) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestCancelConversationNext(t *testing.T) {
+	h := NewChannelHandler()
+	tx := &Transaction{state: newConversation(nil, h)}
+	msgs := []Message{{Style: PromptEchoOn, Msg: "login: "}}
+	tx.CancelConversation()
+	tx.CancelConversation()
+	if _, err := tx.state.respond(msgs); !errors.Is(err, ErrConv) {
+		t.Fatalf("respond #expected %v, got %v", ErrConv, err)
+	}
+	done := make(chan error)
+	go func() {
+		r, err := tx.state.respond(msgs)
+		if err == nil && r[0].Resp != "test" {
+			err = errors.New("unexpected response " + r[0].Resp)
+		}
+		done <- err
+	}()
+	<-h.Messages
+	h.Responses <- ChannelResponse{Resp: "test"}
+	if err := <-done; err != nil {
+		t.Fatalf("respond #error: %v", err)
+	}
+}
+
+type radioOnly struct{}
+
+func (radioOnly) OnRadio(msg string) (string, error) {
+	return "yes", nil
+}
+
+type binaryOnly struct{}
+
+func (binaryOnly) OnBinary(p BinaryPointer) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func TestBinaryDispatcher(t *testing.T) {
+	if err := checkHandler(Dispatch(&promptOnly{})); err != nil {
+		t.Fatalf("checkhandler #error: %v", err)
+	}
+	d := DispatchBinary(binaryOnly{})
+	if b, err := d.RespondPAMBinary(nil); err != nil || len(b) != 1 {
+		t.Fatalf("respondpambinary #error: %v, %v", b, err)
+	}
+	if _, err := d.RespondPAM(PromptEchoOff, "Password: "); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestDispatcherRadio(t *testing.T) {
+	if !CheckPamHasRadioType() {
+		t.Skip("PAM_RADIO_TYPE is not supported")
+	}
+	if r, err := Dispatch(radioOnly{}).RespondPAM(RadioType, "Use the token?"); err != nil || r != "yes" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+	if _, err := Dispatch(&promptOnly{}).RespondPAM(RadioType, "Use the token?"); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %v", ErrConv, err)
+	}
+}
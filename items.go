@@ -0,0 +1,191 @@
+package pam
+
+//#include <security/pam_appl.h>
+//#include <security/pam_modules.h>
+//#include <stdlib.h>
+//#include <string.h>
+import "C"
+
+import (
+	"context"
+	"unsafe"
+)
+
+// ItemSupported returns whether the item i is supported by the PAM
+// implementation in use, so that applications can detect optional and
+// implementation specific items instead of failing with ErrBadItem.
+func ItemSupported(i Item) bool {
+	switch i {
+	case Service, User, Tty, Rhost, Authtok, Oldauthtok, Ruser, UserPrompt:
+		return true
+	case XDisplay, XAuthData, AuthtokType:
+		return CheckPamHasExtendedItems()
+	}
+	for _, p := range platformItems {
+		if p == i {
+			return true
+		}
+	}
+	return false
+}
+
+// Service returns the name of the PAM service of the transaction.
+func (t *Transaction) Service() (string, error) {
+	return t.GetItem(Service)
+}
+
+// SetService sets the name of the PAM service of the transaction.
+func (t *Transaction) SetService(service string) error {
+	return t.SetItem(Service, service)
+}
+
+// User returns the user name the transaction refers to.
+func (t *Transaction) User() (string, error) {
+	return t.GetItem(User)
+}
+
+// SetUser sets the user name the transaction refers to.
+func (t *Transaction) SetUser(user string) error {
+	return t.SetItem(User, user)
+}
+
+// Tty returns the terminal name.
+func (t *Transaction) Tty() (string, error) {
+	return t.GetItem(Tty)
+}
+
+// SetTty sets the terminal name.
+func (t *Transaction) SetTty(tty string) error {
+	return t.SetItem(Tty, tty)
+}
+
+// Rhost returns the requesting host name.
+func (t *Transaction) Rhost() (string, error) {
+	return t.GetItem(Rhost)
+}
+
+// SetRhost sets the requesting host name.
+func (t *Transaction) SetRhost(rhost string) error {
+	return t.SetItem(Rhost, rhost)
+}
+
+// Ruser returns the requesting user name.
+func (t *Transaction) Ruser() (string, error) {
+	return t.GetItem(Ruser)
+}
+
+// SetRuser sets the requesting user name.
+func (t *Transaction) SetRuser(ruser string) error {
+	return t.SetItem(Ruser, ruser)
+}
+
+// UserPrompt returns the string used to prompt for a user name.
+func (t *Transaction) UserPrompt() (string, error) {
+	return t.GetItem(UserPrompt)
+}
+
+// SetUserPrompt sets the string used to prompt for a user name.
+func (t *Transaction) SetUserPrompt(prompt string) error {
+	return t.SetItem(UserPrompt, prompt)
+}
+
+// unsetItem clears a string item, unlike setting it to an empty string, so
+// that pam_get_user prompts for the user name again once User is unset.
+// Linux-PAM dereferences the value of the other items, such as Service and
+// XAuthData, so only the items it copies with a NULL check are accepted.
+func (t *Transaction) unsetItem(i Item) error {
+	switch i {
+	case User, Tty, Rhost, Ruser, UserPrompt, XDisplay, AuthtokType:
+	default:
+		return &OpError{Op: "pam_set_item", Args: i.String(), Err: ErrInvalidArgument}
+	}
+	if err := t.checkEnded("pam_set_item"); err != nil {
+		return err
+	}
+	return t.handlePamStatus(t.run(func() C.int {
+		return C.pam_set_item(t.handle, C.int(i), nil)
+	}), "pam_set_item", i)
+}
+
+// GetUser returns the user name the transaction refers to, prompting for it
+// through the conversation if it has not been set yet, as pam_get_user does.
+// If prompt is empty, the UserPrompt item or the PAM default prompt is used.
+func (t *Transaction) GetUser(prompt string) (string, error) {
+	if err := checkCString(prompt); err != nil {
+		return "", &OpError{Op: "pam_get_user", Err: err}
+	}
+	var p *C.char
+	if prompt != "" {
+		p = C.CString(prompt)
+		defer C.free(unsafe.Pointer(p))
+	}
+	var user *C.char
+	err := t.call(context.Background(), "pam_get_user", 0, 0, func() C.int {
+		return C.pam_get_user(t.handle, &user, p)
+	})
+	if err != nil {
+		return "", err
+	}
+	return C.GoString(user), nil
+}
+
+// XDisplay returns the name of the X display.
+func (t *Transaction) XDisplay() (string, error) {
+	return t.GetItem(XDisplay)
+}
+
+// SetXDisplay sets the name of the X display.
+func (t *Transaction) SetXDisplay(display string) error {
+	return t.SetItem(XDisplay, display)
+}
+
+// AuthtokType returns the word used by the modules to refer to the
+// authentication token in prompts.
+func (t *Transaction) AuthtokType() (string, error) {
+	return t.GetItem(AuthtokType)
+}
+
+// SetAuthtokType sets the word used by the modules to refer to the
+// authentication token in prompts.
+func (t *Transaction) SetAuthtokType(authtokType string) error {
+	return t.SetItem(AuthtokType, authtokType)
+}
+
+// GetItemPointer returns the raw value of a PAM information item, this can
+// be used for items whose layout is implementation specific. The pointer is
+// owned by PAM and is only valid until the item is changed or the
+// transaction ends.
+func (t *Transaction) GetItemPointer(i Item) (unsafe.Pointer, error) {
+	if err := t.checkEnded("pam_get_item"); err != nil {
+		return nil, err
+	}
+	var p unsafe.Pointer
+	err := t.handlePamStatus(t.run(func() C.int {
+		return C.pam_get_item(t.handle, C.int(i), &p)
+	}), "pam_get_item", i)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetItemBytes returns a copy of the value of a PAM information item as
+// bytes: for string items these are the bytes of the string, for XAuthData
+// the authentication data. An item whose layout is not known returns
+// ErrInvalidArgument, GetItemPointer must be used in that case.
+func (t *Transaction) GetItemBytes(i Item) ([]byte, error) {
+	switch i {
+	case XAuthData:
+		_, data, err := t.GetXAuthData()
+		return data, err
+	case Service, User, Tty, Rhost, Authtok, Oldauthtok, Ruser, UserPrompt,
+		XDisplay, AuthtokType:
+	default:
+		return nil, &OpError{Op: "pam_get_item", Args: i.String(), Err: ErrInvalidArgument}
+	}
+	p, err := t.GetItemPointer(i)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return C.GoBytes(p, C.int(C.strlen((*C.char)(p)))), nil
+}
@@ -0,0 +1,35 @@
+//go:build darwin || dragonfly || freebsd || netbsd
+
+package pam
+
+//#include <security/pam_appl.h>
+import "C"
+
+// OpenPAM specific PAM Item types.
+const (
+	// Repository is the name of the repository the user information is
+	// stored in.
+	Repository Item = C.PAM_REPOSITORY
+	// AuthtokPrompt is the string used to prompt for the authentication
+	// token.
+	AuthtokPrompt Item = C.PAM_AUTHTOK_PROMPT
+	// OldauthtokPrompt is the string used to prompt for the old
+	// authentication token.
+	OldauthtokPrompt Item = C.PAM_OLDAUTHTOK_PROMPT
+	// Host is the name of the host the application runs on.
+	Host Item = C.PAM_HOST
+)
+
+var platformItems = []Item{Repository, AuthtokPrompt, OldauthtokPrompt, Host}
+
+func init() {
+	itemNames = append(itemNames, []struct {
+		item Item
+		name string
+	}{
+		{Repository, "Repository"},
+		{AuthtokPrompt, "AuthtokPrompt"},
+		{OldauthtokPrompt, "OldauthtokPrompt"},
+		{Host, "Host"},
+	}...)
+}
@@ -0,0 +1,5 @@
+//go:build !(darwin || dragonfly || freebsd || netbsd || solaris || illumos)
+
+package pam
+
+var platformItems []Item
@@ -0,0 +1,30 @@
+//go:build solaris || illumos
+
+package pam
+
+//#include <security/pam_appl.h>
+import "C"
+
+// Solaris specific PAM Item types.
+const (
+	// Repository identifies the repository the user information is stored
+	// in. It is a struct pam_repository, not a string.
+	Repository Item = C.PAM_REPOSITORY
+	// Auser is the authenticated user name.
+	Auser Item = C.PAM_AUSER
+	// Resource is the resource the user is accessing.
+	Resource Item = C.PAM_RESOURCE
+)
+
+var platformItems = []Item{Repository, Auser, Resource}
+
+func init() {
+	itemNames = append(itemNames, []struct {
+		item Item
+		name string
+	}{
+		{Repository, "Repository"},
+		{Auser, "Auser"},
+		{Resource, "Resource"},
+	}...)
+}
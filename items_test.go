@@ -0,0 +1,267 @@
+package pam
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTypedItems(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+
+	items := []struct {
+		name string
+		set  func(string) error
+		get  func() (string, error)
+	}{
+		{"service", tx.SetService, tx.Service},
+		{"user", tx.SetUser, tx.User},
+		{"tty", tx.SetTty, tx.Tty},
+		{"rhost", tx.SetRhost, tx.Rhost},
+		{"ruser", tx.SetRuser, tx.Ruser},
+		{"userprompt", tx.SetUserPrompt, tx.UserPrompt},
+	}
+	for _, i := range items {
+		value := "value-" + i.name
+		if err := i.set(value); err != nil {
+			t.Fatalf("set %s #error: %v", i.name, err)
+		}
+		s, err := i.get()
+		if err != nil {
+			t.Fatalf("get %s #error: %v", i.name, err)
+		}
+		if s != value {
+			t.Fatalf("get %s #error: expected %v, got %v", i.name, value, s)
+		}
+	}
+
+	s, err := tx.GetItem(User)
+	if err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+	if s != "value-user" {
+		t.Fatalf("getitem #error: expected value-user, got %v", s)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	var prompts []string
+	tx, err := StartFunc("passwd", "", func(s Style, msg string) (string, error) {
+		if s != PromptEchoOn {
+			return "", errors.New("unexpected")
+		}
+		prompts = append(prompts, msg)
+		return "test", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	user, err := tx.GetUser("Who are you? ")
+	if err != nil {
+		t.Fatalf("getuser #error: %v", err)
+	}
+	if user != "test" {
+		t.Fatalf("getuser #error: expected test, got %v", user)
+	}
+	// The user is now set, so no further prompt is performed.
+	user, err = tx.GetUser("")
+	if err != nil {
+		t.Fatalf("getuser #error: %v", err)
+	}
+	if user != "test" {
+		t.Fatalf("getuser #error: expected test, got %v", user)
+	}
+	if len(prompts) != 1 || prompts[0] != "Who are you? " {
+		t.Fatalf("getuser #unexpected prompts: %v", prompts)
+	}
+}
+
+func TestUnsetItem(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	for _, i := range []Item{Service, Authtok, XAuthData} {
+		if err := tx.unsetItem(i); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("unsetitem %v #expected %v, got %v", i, ErrInvalidArgument, err)
+		}
+	}
+	if s, err := tx.Service(); err != nil || s != "passwd" {
+		t.Fatalf("service #error: %q, %v", s, err)
+	}
+	if err := tx.unsetItem(User); err != nil {
+		t.Fatalf("unsetitem #error: %v", err)
+	}
+	if u, err := tx.User(); err != nil || u != "" {
+		t.Fatalf("user #error: %q, %v", u, err)
+	}
+}
+
+func TestGetUser_NoHandler(t *testing.T) {
+	tx, err := Start("passwd", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	_, err = tx.GetUser("")
+	if err == nil {
+		t.Fatalf("getuser #expected an error")
+	}
+}
+
+func TestExtendedItems(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	err = tx.SetXDisplay(":0")
+	if !CheckPamHasExtendedItems() {
+		if err == nil {
+			t.Fatalf("setxdisplay #expected an error")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("setxdisplay #error: %v", err)
+	}
+	s, err := tx.XDisplay()
+	if err != nil {
+		t.Fatalf("xdisplay #error: %v", err)
+	}
+	if s != ":0" {
+		t.Fatalf("xdisplay #error: expected :0, got %v", s)
+	}
+	err = tx.SetAuthtokType("LDAP")
+	if err != nil {
+		t.Fatalf("setauthtoktype #error: %v", err)
+	}
+	s, err = tx.AuthtokType()
+	if err != nil {
+		t.Fatalf("authtoktype #error: %v", err)
+	}
+	if s != "LDAP" {
+		t.Fatalf("authtoktype #error: expected LDAP, got %v", s)
+	}
+}
+
+func TestXAuthData(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	cookie := []byte{0x00, 0x01, 0x02, 0xff, 0x00, 0x10}
+	err = tx.SetXAuthData("MIT-MAGIC-COOKIE-1", cookie)
+	if !CheckPamHasExtendedItems() {
+		if err == nil {
+			t.Fatalf("setxauthdata #expected an error")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("setxauthdata #error: %v", err)
+	}
+	name, data, err := tx.GetXAuthData()
+	if err != nil {
+		t.Fatalf("getxauthdata #error: %v", err)
+	}
+	if name != "MIT-MAGIC-COOKIE-1" {
+		t.Fatalf("getxauthdata #error: expected MIT-MAGIC-COOKIE-1, got %v", name)
+	}
+	if string(data) != string(cookie) {
+		t.Fatalf("getxauthdata #error: expected %v, got %v", cookie, data)
+	}
+	err = tx.SetXAuthData("bad\x00name", nil)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("setxauthdata #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if err := tx.SetItem(XAuthData, "abcdefgh"); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("setitem #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if _, err := tx.GetItem(XAuthData); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("getitem #expected %v, got %v", ErrInvalidArgument, err)
+	}
+}
+
+func TestItemSupported(t *testing.T) {
+	for _, i := range []Item{Service, User, Tty, Rhost, Authtok, Oldauthtok, Ruser, UserPrompt} {
+		if !ItemSupported(i) {
+			t.Fatalf("itemsupported #error: expected %v to be supported", i)
+		}
+	}
+	for _, i := range []Item{XDisplay, XAuthData, AuthtokType} {
+		if ItemSupported(i) != CheckPamHasExtendedItems() {
+			t.Fatalf("itemsupported #error: unexpected support for %v", i)
+		}
+	}
+	for _, i := range platformItems {
+		if !ItemSupported(i) {
+			t.Fatalf("itemsupported #error: expected %v to be supported", i)
+		}
+	}
+	if ItemSupported(Item(-1)) {
+		t.Fatalf("itemsupported #error: expected invalid item not to be supported")
+	}
+}
+
+func TestGetItemBytes(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	b, err := tx.GetItemBytes(User)
+	if err != nil {
+		t.Fatalf("getitembytes #error: %v", err)
+	}
+	if string(b) != "test" {
+		t.Fatalf("getitembytes #error: expected test, got %v", b)
+	}
+	b, err = tx.GetItemBytes(Tty)
+	if err != nil {
+		t.Fatalf("getitembytes #error: %v", err)
+	}
+	if b != nil {
+		t.Fatalf("getitembytes #error: expected nil, got %v", b)
+	}
+	p, err := tx.GetItemPointer(Service)
+	if err != nil {
+		t.Fatalf("getitempointer #error: %v", err)
+	}
+	if p == nil {
+		t.Fatalf("getitempointer #error: expected a pointer")
+	}
+	_, err = tx.GetItemBytes(Item(-1))
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("getitembytes #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if CheckPamHasExtendedItems() {
+		cookie := []byte{0x00, 0x01, 0x00}
+		if err := tx.SetXAuthData("MIT-MAGIC-COOKIE-1", cookie); err != nil {
+			t.Fatalf("setxauthdata #error: %v", err)
+		}
+		b, err = tx.GetItemBytes(XAuthData)
+		if err != nil {
+			t.Fatalf("getitembytes #error: %v", err)
+		}
+		if string(b) != string(cookie) {
+			t.Fatalf("getitembytes #error: expected %v, got %v", cookie, b)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package pam
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// keyctl operations and special keyrings, see keyctl(2).
+const (
+	keyctlGetKeyringID       = 0
+	keyctlJoinSessionKeyring = 1
+	keySpecSessionKeyring    = -3
+)
+
+// sessionKeyring returns the special session keyring ID as an argument.
+func sessionKeyring() uintptr {
+	spec := keySpecSessionKeyring
+	return uintptr(spec)
+}
+
+// keyctl performs a keyctl system call.
+func keyctl(op int, arg2, arg3 uintptr) (int32, error) {
+	r, _, errno := syscall.Syscall(syscall.SYS_KEYCTL, uintptr(op), arg2, arg3)
+	if errno != 0 {
+		return 0, os.NewSyscallError("keyctl", errno)
+	}
+	return int32(r), nil
+}
+
+// OpenSessionKeyring joins a new session keyring and opens the session, as
+// OpenSession does, on the thread running the libpam calls of the
+// transaction, so that the modules relying on pam_keyinit semantics store
+// their keys, such as Kerberos tickets, in the new keyring. The keyring is
+// named name, it is anonymous if name is empty. Its serial number is
+// returned.
+//
+// The keyrings of a process are per thread: the transaction must be pinned
+// to a thread using WithLockedOSThread, otherwise ErrInvalidArgument is
+// returned. The other threads of the process keep their session keyring.
+func (t *Transaction) OpenSessionKeyring(f Flags, name string) (int32, error) {
+	if err := t.checkEnded("pam_open_session"); err != nil {
+		return 0, err
+	}
+	if t.exec == nil {
+		return 0, &OpError{Op: "keyctl", Args: "KEYCTL_JOIN_SESSION_KEYRING", Err: ErrInvalidArgument}
+	}
+	if err := checkCString(name); err != nil {
+		return 0, &OpError{Op: "keyctl", Args: "KEYCTL_JOIN_SESSION_KEYRING", Err: err}
+	}
+	var p *byte
+	if name != "" {
+		b := append([]byte(name), 0)
+		p = &b[0]
+	}
+	var id int32
+	err := error(&OpError{Op: "keyctl", Args: "KEYCTL_JOIN_SESSION_KEYRING", Err: ErrTransactionClosed})
+	t.do(func() {
+		// The pointer is converted in the call expression, so that the
+		// name is kept alive until the system call returns.
+		r, _, errno := syscall.Syscall(syscall.SYS_KEYCTL, keyctlJoinSessionKeyring,
+			uintptr(unsafe.Pointer(p)), 0)
+		id, err = int32(r), nil
+		if errno != 0 {
+			id, err = 0, os.NewSyscallError("keyctl", errno)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, t.OpenSession(f)
+}
+
+// SessionKeyring returns the serial number of the session keyring of the
+// thread running the libpam calls of the transaction, see
+// OpenSessionKeyring. As for OpenSessionKeyring, the transaction must be
+// pinned to a thread, otherwise ErrInvalidArgument is returned.
+func (t *Transaction) SessionKeyring() (int32, error) {
+	if err := t.checkEnded("keyctl"); err != nil {
+		return 0, err
+	}
+	if t.exec == nil {
+		return 0, &OpError{Op: "keyctl", Args: "KEYCTL_GET_KEYRING_ID", Err: ErrInvalidArgument}
+	}
+	var id int32
+	err := error(&OpError{Op: "keyctl", Args: "KEYCTL_GET_KEYRING_ID", Err: ErrTransactionClosed})
+	t.do(func() {
+		id, err = keyctl(keyctlGetKeyringID, sessionKeyring(), 0)
+	})
+	return id, err
+}
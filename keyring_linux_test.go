@@ -0,0 +1,47 @@
+package pam
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestOpenSessionKeyring(t *testing.T) {
+	tx, err := StartWithOptions("login-service", "testuser", nil,
+		WithConfDir("test-services"), WithLockedOSThread())
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	id, err := tx.OpenSessionKeyring(0, "pam-test")
+	if err != nil {
+		t.Skipf("opensessionkeyring #error: %v", err)
+	}
+	if got, err := tx.SessionKeyring(); err != nil || got != id {
+		t.Fatalf("sessionkeyring #expected %v, got %v, %v", id, got, err)
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if own, err := keyctl(keyctlGetKeyringID, sessionKeyring(), 0); err == nil && own == id {
+		t.Fatalf("sessionkeyring #error: keyring joined by the calling thread")
+	}
+	if err := tx.CloseSession(0); err != nil {
+		t.Fatalf("closesession #error: %v", err)
+	}
+
+	plain, err := StartConfDir("login-service", "testuser", nil, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer plain.End()
+	if _, err := plain.OpenSessionKeyring(0, ""); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("opensessionkeyring #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if _, err := plain.SessionKeyring(); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("sessionkeyring #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	tx.End()
+	if _, err := tx.SessionKeyring(); !errors.Is(err, ErrTransactionClosed) {
+		t.Fatalf("sessionkeyring #expected %v, got %v", ErrTransactionClosed, err)
+	}
+}
@@ -0,0 +1,64 @@
+package pam
+
+import (
+	"sync"
+)
+
+// limits holds the semaphores set by SetConcurrencyLimit.
+var limits struct {
+	sync.RWMutex
+	services map[string]chan struct{}
+}
+
+// SetConcurrencyLimit limits to n the number of transactions of service that
+// may be in a libpam call at the same time, across all handles. This is
+// meant for module stacks that are not reentrant, such as pam_krb5 using a
+// shared credentials cache: a limit of 1 serializes the transactions of the
+// service. An empty service sets a limit for all the transactions, it is
+// applied in addition to the limit of their service. A limit of zero or less
+// removes it.
+//
+// The limit applies to the calls started after it is set. The service of a
+// transaction is the one it was started with. The conversation handlers of
+// a limited transaction must not perform operations on other transactions
+// limited in the same way, they would wait forever.
+func SetConcurrencyLimit(service string, n int) {
+	limits.Lock()
+	defer limits.Unlock()
+	if n <= 0 {
+		delete(limits.services, service)
+		return
+	}
+	if limits.services == nil {
+		limits.services = make(map[string]chan struct{})
+	}
+	limits.services[service] = make(chan struct{}, n)
+}
+
+// acquireLimits waits for the concurrency limits of service and returns the
+// function releasing them.
+func acquireLimits(service string) func() {
+	limits.RLock()
+	all, svc := limits.services[""], limits.services[service]
+	limits.RUnlock()
+	if service == "" {
+		svc = nil
+	}
+	if all == nil && svc == nil {
+		return func() {}
+	}
+	if all != nil {
+		all <- struct{}{}
+	}
+	if svc != nil {
+		svc <- struct{}{}
+	}
+	return func() {
+		if svc != nil {
+			<-svc
+		}
+		if all != nil {
+			<-all
+		}
+	}
+}
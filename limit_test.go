@@ -0,0 +1,58 @@
+package pam
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetConcurrencyLimit(t *testing.T) {
+	const service = "succeed-if-user-test"
+	SetConcurrencyLimit(service, 1)
+	defer SetConcurrencyLimit(service, 0)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	first, err := StartWithOptions(service, "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			close(entered)
+			<-release
+			return "testuser", nil
+		}), WithConfDir("test-services"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer first.End()
+	prompted := make(chan struct{})
+	second, err := StartWithOptions(service, "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			close(prompted)
+			return "testuser", nil
+		}), WithConfDir("test-services"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer second.End()
+	errs := make(chan error, 2)
+	go func() {
+		errs <- first.Authenticate(0)
+	}()
+	<-entered
+	go func() {
+		errs <- second.Authenticate(0)
+	}()
+	select {
+	case <-prompted:
+		t.Fatalf("authenticate #error: limit not enforced")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("authenticate #error: %v", err)
+		}
+	}
+	select {
+	case <-prompted:
+	default:
+		t.Fatalf("authenticate #error: second transaction not prompted")
+	}
+}
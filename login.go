@@ -0,0 +1,216 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Authenticate checks that password is the password of user for service and
+// that the account is valid, as Authenticate and AcctMgmt of a transaction
+// do. The transaction is ended before returning, which wipes the []byte copy
+// of the password held by its handler; the copies sent to the modules and
+// the password string itself can not be wiped. opts configure the
+// transaction, see StartWithOptions.
+func Authenticate(service, user, password string, opts ...StartOption) error {
+	t, err := StartWithOptions(service, user, &CredentialsHandler{
+		User:     user,
+		Password: []byte(password),
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	if err := checkAccount(t); err != nil {
+		t.End()
+		return err
+	}
+	return t.End()
+}
+
+// checkAccount authenticates the user of t and checks its account.
+func checkAccount(t *Transaction) error {
+	if err := t.Authenticate(0); err != nil {
+		return err
+	}
+	return t.AcctMgmt(0)
+}
+
+// Login runs the steps of a user login in order: Authenticate, AcctMgmt,
+// optionally changing the authentication token if it has expired, SetCred
+// with EstablishCred and OpenSession. If a step fails, the previous ones are
+// undone and the transaction is ended.
+type Login struct {
+	// Service is the name of the PAM service.
+	Service string
+	// User is the user name, it can be empty if the modules have to ask
+	// for it.
+	User string
+	// Handler is the conversation handler, it also answers the prompts of
+	// the token change if the token has expired.
+	Handler ConversationHandler
+	// Options are used to start the transaction.
+	Options []StartOption
+	// Flags are passed to the operations: Silent, and DisallowNullAuthtok
+	// which is only passed to Authenticate and AcctMgmt.
+	Flags Flags
+	// ChangeExpiredAuthtok enables the expired token flow: when AcctMgmt
+	// returns ErrNewAuthTokRequired the token is changed and AcctMgmt is
+	// called again, as login and sshd do. Otherwise the error is returned.
+	ChangeExpiredAuthtok bool
+	// ChangeExpired changes the expired authentication token, if nil the
+	// token is changed with ChangeAuthTok and ChangeExpiredAuthtok, using
+	// Handler.
+	ChangeExpired func(*Transaction) error
+}
+
+// Session is a user session opened by Login. Its methods can be used from
+// several goroutines.
+type Session struct {
+	t      *Transaction
+	flags  Flags
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+}
+
+// Run performs the login and returns the opened session.
+func (l *Login) Run() (*Session, error) {
+	t, err := StartWithOptions(l.Service, l.User, l.Handler, l.Options...)
+	if err != nil {
+		return nil, err
+	}
+	silent := l.Flags & Silent
+	if err := t.Authenticate(l.Flags); err != nil {
+		t.End()
+		return nil, err
+	}
+	if err := l.acctMgmt(t); err != nil {
+		t.End()
+		return nil, err
+	}
+	if err := t.SetCred(silent | EstablishCred); err != nil {
+		t.End()
+		return nil, err
+	}
+	if err := t.OpenSession(silent); err != nil {
+		t.SetCred(silent | DeleteCred)
+		t.End()
+		return nil, err
+	}
+	return &Session{t: t, flags: silent, done: make(chan struct{})}, nil
+}
+
+// acctMgmt checks the account, changing the expired token if enabled.
+func (l *Login) acctMgmt(t *Transaction) error {
+	err := t.AcctMgmt(l.Flags)
+	if !l.ChangeExpiredAuthtok || !errors.Is(err, ErrNewAuthTokRequired) {
+		return err
+	}
+	if l.ChangeExpired != nil {
+		err = l.ChangeExpired(t)
+	} else {
+		err = t.ChangeAuthTok(l.Flags&Silent | ChangeExpiredAuthtok)
+	}
+	if err != nil {
+		return err
+	}
+	return t.AcctMgmt(l.Flags)
+}
+
+// Transaction returns the transaction of the session, to access its items
+// and environment. It must not be ended directly, Close does it.
+func (s *Session) Transaction() *Transaction {
+	return s.t
+}
+
+// Close closes the session, deletes the credentials and ends the
+// transaction. All the steps are performed even if one fails, the errors
+// are joined. Closing a closed session does nothing.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	defer close(s.done)
+	return errors.Join(
+		s.t.CloseSession(s.flags),
+		s.t.SetCred(s.flags|DeleteCred),
+		s.t.End(),
+	)
+}
+
+// Done returns a channel that is closed once the session is closed.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// CloseOnDone closes the session once ctx is done or one of the signals,
+// SIGTERM if none is given, is received, so that daemons exiting early do not
+// leak sessions. When closing on a signal, the signal is sent again to the
+// process once the session is closed, so that its default behavior, such as
+// terminating the process, applies. The returned function stops watching.
+func (s *Session) CloseOnDone(ctx context.Context, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	stopped := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(stopped)
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+			s.Close()
+		case sig := <-ch:
+			stop()
+			s.Close()
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				_ = p.Signal(sig)
+			}
+		case <-s.done:
+			stop()
+		case <-stopped:
+		}
+	}()
+	return stop
+}
+
+// ChangePassword changes the password of user for service from oldPassword
+// to newPassword, answering the prompts of the modules with a
+// PasswordChangeHandler. The transaction is ended before returning; opts
+// configure it, see StartWithOptions.
+func ChangePassword(service, user, oldPassword, newPassword string, opts ...StartOption) error {
+	return changePassword(service, user, oldPassword, newPassword, 0, opts)
+}
+
+// ChangeExpiredPassword is like ChangePassword, but the password is only
+// changed if it has expired, as ChangeExpiredAuthtok requests.
+func ChangeExpiredPassword(service, user, oldPassword, newPassword string, opts ...StartOption) error {
+	return changePassword(service, user, oldPassword, newPassword, ChangeExpiredAuthtok, opts)
+}
+
+// changePassword implements ChangePassword and ChangeExpiredPassword.
+func changePassword(service, user, oldPassword, newPassword string, f Flags, opts []StartOption) error {
+	h := NewPasswordChangeHandler(oldPassword, newPassword)
+	t, err := StartWithOptions(service, user, h, opts...)
+	if err != nil {
+		return err
+	}
+	if err := t.ChangeAuthTok(f); err != nil {
+		t.End()
+		return err
+	}
+	return t.End()
+}
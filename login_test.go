@@ -0,0 +1,171 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"os/user"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	u, _ := user.Current()
+	if u.Uid != "0" {
+		t.Skip("run this test as root")
+	}
+	if err := Authenticate("", "test", "secret"); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := Authenticate("", "test", "wrong"); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrAuth, err)
+	}
+	err := Authenticate("deny-service", "test", "secret", WithConfDir("test-services"))
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrAuth, err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	l := &Login{
+		Service: "login-service",
+		User:    "testuser",
+		Options: []StartOption{WithConfDir("test-services")},
+		Flags:   Silent,
+	}
+	s, err := l.Run()
+	if err != nil {
+		t.Fatalf("run #error: %v", err)
+	}
+	tx := s.Transaction()
+	if err := s.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	var ops []string
+	for _, e := range tx.History() {
+		ops = append(ops, e.Op)
+	}
+	expected := "pam_start pam_authenticate pam_acct_mgmt pam_setcred pam_open_session " +
+		"pam_close_session pam_setcred pam_end"
+	if got := strings.Join(ops, " "); got != expected {
+		t.Fatalf("history #expected %q, got %q", expected, got)
+	}
+}
+
+func TestLoginFailure(t *testing.T) {
+	l := &Login{
+		Service: "deny-service",
+		User:    "testuser",
+		Options: []StartOption{WithConfDir("test-services")},
+	}
+	if _, err := l.Run(); !errors.Is(err, ErrAuth) {
+		t.Fatalf("run #expected %v, got %v", ErrAuth, err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	for _, change := range []func(string, string, string, string, ...StartOption) error{
+		ChangePassword, ChangeExpiredPassword,
+	} {
+		err := change("password-permit-service", "testuser", "old", "new",
+			WithConfDir("test-services"))
+		if err != nil {
+			t.Fatalf("changepassword #error: %v", err)
+		}
+		err = change("deny-service", "testuser", "old", "new", WithConfDir("test-services"))
+		if err == nil {
+			t.Fatalf("changepassword #expected an error")
+		}
+	}
+}
+
+func TestSessionCloseOnDone(t *testing.T) {
+	l := &Login{
+		Service: "login-service",
+		User:    "testuser",
+		Options: []StartOption{WithConfDir("test-services")},
+	}
+	s, err := l.Run()
+	if err != nil {
+		t.Fatalf("run #error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer s.CloseOnDone(ctx)()
+	cancel()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("closeondone #error: session not closed")
+	}
+	h := s.Transaction().History()
+	if last := h[len(h)-1]; last.Op != "pam_end" {
+		t.Fatalf("history #error: unexpected entry %v", last)
+	}
+
+	s, err = l.Run()
+	if err != nil {
+		t.Fatalf("run #error: %v", err)
+	}
+	// Receives the signal sent again, instead of the default behavior.
+	resent := make(chan os.Signal, 2)
+	signal.Notify(resent, syscall.SIGUSR1)
+	defer signal.Stop(resent)
+	s.CloseOnDone(context.Background(), syscall.SIGUSR1)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatalf("kill #error: %v", err)
+	}
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("closeondone #error: session not closed on signal")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-resent:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("closeondone #error: signal not sent again")
+		}
+	}
+}
+
+func TestLoginExpired(t *testing.T) {
+	l := &Login{
+		Service: "expired-service",
+		User:    "testuser",
+		Options: []StartOption{WithConfDir("test-services")},
+	}
+	if _, err := l.Run(); !errors.Is(err, ErrNewAuthTokRequired) {
+		t.Fatalf("run #expected %v, got %v", ErrNewAuthTokRequired, err)
+	}
+	l.ChangeExpiredAuthtok = true
+	// The default flow changes the token, but the stack keeps requiring it.
+	if _, err := l.Run(); !errors.Is(err, ErrNewAuthTokRequired) {
+		t.Fatalf("run #expected %v, got %v", ErrNewAuthTokRequired, err)
+	}
+	l.ChangeExpired = func(tx *Transaction) error {
+		if err := tx.ChangeAuthTok(ChangeExpiredAuthtok); err != nil {
+			return err
+		}
+		return tx.SetTty("changed")
+	}
+	s, err := l.Run()
+	if err != nil {
+		t.Fatalf("run #error: %v", err)
+	}
+	defer s.Close()
+	var ops []string
+	for _, e := range s.Transaction().History() {
+		ops = append(ops, e.Op)
+	}
+	expected := "pam_start pam_authenticate pam_acct_mgmt pam_chauthtok pam_set_item " +
+		"pam_acct_mgmt pam_setcred pam_open_session"
+	if got := strings.Join(ops, " "); got != expected {
+		t.Fatalf("history #expected %q, got %q", expected, got)
+	}
+}
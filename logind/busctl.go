@@ -0,0 +1,58 @@
+package logind
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// busctlPath is the busctl command, it is replaced by the tests.
+var busctlPath = "busctl"
+
+// value is a D-Bus value as printed by busctl in JSON.
+type value struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// busctl runs busctl with the JSON output and args, returning the values
+// it prints, one per line.
+func busctl(args ...string) ([]value, error) {
+	return busctlAs(nil, nil, args...)
+}
+
+// busctlAs is busctl, running the command with the identity cred and the
+// environment env if they are not nil.
+func busctlAs(cred *syscall.Credential, env []string, args ...string) ([]value, error) {
+	cmd := exec.Command(busctlPath, append([]string{"--json=short"}, args...)...)
+	cmd.Env = env
+	if cred != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("busctl %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("busctl %s: %w", args[0], err)
+	}
+	var values []value
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var v value
+		if err := json.Unmarshal(s.Bytes(), &v); err != nil {
+			return nil, fmt.Errorf("busctl %s: %w", args[0], err)
+		}
+		values = append(values, v)
+	}
+	return values, s.Err()
+}
@@ -0,0 +1,6 @@
+// Package logind integrates PAM sessions with systemd: it describes the
+// session to pam_systemd, queries systemd-logind about the session it
+// registered and passes the PAM environment to the user manager. It talks
+// to D-Bus through the busctl tool, which must be installed. It is only
+// useful on Linux systems running systemd.
+package logind
@@ -0,0 +1,82 @@
+package logind
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/msteinert/pam"
+)
+
+// PushEnvironment sets variables of the PAM environment of t in the systemd
+// user manager of the user of t, through its SetEnvironment D-Bus call, so
+// that the services it starts see the variables exported by the PAM
+// modules. It must be called after OpenSession, once pam_systemd has
+// started the user manager. Only the variables in names that are set in
+// the PAM environment are pushed, all of them if names is empty.
+//
+// The user bus is found through XDG_RUNTIME_DIR, as set by pam_systemd, or
+// /run/user/UID. busctl runs with the identity of the user, so the calling
+// process must be allowed to change its identity unless it is the user.
+func PushEnvironment(t pam.TransactionHandle, names ...string) error {
+	pamEnv, err := t.GetEnvList()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		for name := range pamEnv {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var assignments []string
+	for _, name := range names {
+		if value, ok := pamEnv[name]; ok {
+			assignments = append(assignments, name+"="+value)
+		}
+	}
+	if len(assignments) == 0 {
+		return nil
+	}
+	cred, err := t.Credential()
+	if err != nil {
+		return err
+	}
+	dir := pamEnv["XDG_RUNTIME_DIR"]
+	if dir == "" {
+		dir = "/run/user/" + strconv.FormatUint(uint64(cred.Uid), 10)
+	}
+	env := []string{
+		"XDG_RUNTIME_DIR=" + dir,
+		"DBUS_SESSION_BUS_ADDRESS=unix:path=" + escapeAddress(dir) + "/bus",
+	}
+	if path, ok := os.LookupEnv("PATH"); ok {
+		env = append(env, "PATH="+path)
+	}
+	if uint64(cred.Uid) == uint64(os.Getuid()) {
+		cred = nil
+	}
+	args := []string{"--user", "call", "org.freedesktop.systemd1",
+		"/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager",
+		"SetEnvironment", "as", strconv.Itoa(len(assignments))}
+	_, err = busctlAs(cred, env, append(args, assignments...)...)
+	return err
+}
+
+// escapeAddress escapes s for use in a D-Bus address.
+func escapeAddress(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			strings.IndexByte("-_/.\\*", c) >= 0:
+			b = append(b, c)
+		default:
+			b = append(b, fmt.Sprintf("%%%02x", c)...)
+		}
+	}
+	return string(b)
+}
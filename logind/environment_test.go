@@ -0,0 +1,55 @@
+package logind
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestPushEnvironment(t *testing.T) {
+	busctlPath = "testdata/busctl-user"
+	defer func() { busctlPath = "busctl" }()
+	dir := t.TempDir()
+	tx, err := pam.StartConfDir("permit-service", "root", nil, "../test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := PushEnvironment(tx, "LANG"); err != nil {
+		t.Fatalf("pushenvironment #error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "calls")); !os.IsNotExist(err) {
+		t.Fatalf("pushenvironment #unexpected call: %v", err)
+	}
+	if err := tx.PutEnvList([]string{"XDG_RUNTIME_DIR=" + dir, "LANG=C.UTF-8"}); err != nil {
+		t.Fatalf("putenvlist #error: %v", err)
+	}
+	if err := PushEnvironment(tx, "LANG", "TZ"); err != nil {
+		t.Fatalf("pushenvironment #error: %v", err)
+	}
+	calls, err := os.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		t.Fatalf("readfile #error: %v", err)
+	}
+	expected := "unix:path=" + dir + "/bus\n" +
+		"--json=short --user call org.freedesktop.systemd1 /org/freedesktop/systemd1 " +
+		"org.freedesktop.systemd1.Manager SetEnvironment as 1 LANG=C.UTF-8\n"
+	if string(calls) != expected {
+		t.Fatalf("pushenvironment #expected %q, got %q", expected, calls)
+	}
+	if err := PushEnvironment(tx); err != nil {
+		t.Fatalf("pushenvironment #error: %v", err)
+	}
+	calls, err = os.ReadFile(filepath.Join(dir, "calls"))
+	if err != nil {
+		t.Fatalf("readfile #error: %v", err)
+	}
+	expected = "unix:path=" + dir + "/bus\n" +
+		"--json=short --user call org.freedesktop.systemd1 /org/freedesktop/systemd1 " +
+		"org.freedesktop.systemd1.Manager SetEnvironment as 2 LANG=C.UTF-8 XDG_RUNTIME_DIR=" + dir + "\n"
+	if string(calls) != expected {
+		t.Fatalf("pushenvironment #expected %q, got %q", expected, calls)
+	}
+}
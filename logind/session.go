@@ -0,0 +1,110 @@
+package logind
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/msteinert/pam"
+)
+
+// ErrNoSession is returned by SessionFor when the PAM environment has no
+// XDG_SESSION_ID, pam_systemd did not register the session.
+var ErrNoSession = errors.New("logind: no session registered")
+
+// Session describes a session known to systemd-logind.
+type Session struct {
+	// ID is the session identifier, as in XDG_SESSION_ID.
+	ID string
+	// Path is the D-Bus object path of the session.
+	Path string
+	// User is the name of the user, UID its identifier.
+	User string
+	UID  uint32
+	// Seat is the seat of the session, empty if it has none.
+	Seat string
+	// VTNr is the virtual terminal number, zero if none.
+	VTNr uint32
+	// TTY and Display are the terminal and X11 display of the session.
+	TTY     string
+	Display string
+	// Remote tells whether the session is remote, RemoteHost and
+	// RemoteUser then describe the origin.
+	Remote     bool
+	RemoteHost string
+	RemoteUser string
+	// Service is the PAM service that registered the session.
+	Service string
+	// Type is the session type, such as "tty", "x11" or "wayland".
+	Type string
+	// Class is the session class, such as "user" or "greeter".
+	Class string
+	// State is the session state, "online", "active" or "closing".
+	State string
+	// Leader is the process identifier of the session leader.
+	Leader uint32
+}
+
+// SessionFor returns the logind session of the transaction t, found using
+// the XDG_SESSION_ID variable set by pam_systemd in its environment once
+// the session is opened.
+func SessionFor(t pam.TransactionHandle) (*Session, error) {
+	id, ok := t.LookupEnv("XDG_SESSION_ID")
+	if !ok || id == "" {
+		return nil, ErrNoSession
+	}
+	return LookupSession(id)
+}
+
+// LookupSession returns the logind session id.
+func LookupSession(id string) (*Session, error) {
+	values, err := busctl("--system", "call", "org.freedesktop.login1",
+		"/org/freedesktop/login1", "org.freedesktop.login1.Manager",
+		"GetSession", "s", id)
+	if err != nil {
+		return nil, err
+	}
+	var path []string
+	if len(values) != 1 || json.Unmarshal(values[0].Data, &path) != nil || len(path) != 1 {
+		return nil, fmt.Errorf("logind: unexpected GetSession reply")
+	}
+	s := &Session{Path: path[0]}
+	props := []struct {
+		name string
+		dest any
+	}{
+		{"Id", &s.ID},
+		{"Name", &s.User},
+		{"User", &[]any{&s.UID, new(string)}},
+		{"Seat", &[]any{&s.Seat, new(string)}},
+		{"VTNr", &s.VTNr},
+		{"TTY", &s.TTY},
+		{"Display", &s.Display},
+		{"Remote", &s.Remote},
+		{"RemoteHost", &s.RemoteHost},
+		{"RemoteUser", &s.RemoteUser},
+		{"Service", &s.Service},
+		{"Type", &s.Type},
+		{"Class", &s.Class},
+		{"State", &s.State},
+		{"Leader", &s.Leader},
+	}
+	args := []string{"--system", "get-property", "org.freedesktop.login1", s.Path,
+		"org.freedesktop.login1.Session"}
+	for _, p := range props {
+		args = append(args, p.name)
+	}
+	values, err = busctl(args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(props) {
+		return nil, fmt.Errorf("logind: unexpected properties of session %s", id)
+	}
+	for i, p := range props {
+		if err := json.Unmarshal(values[i].Data, p.dest); err != nil {
+			return nil, fmt.Errorf("logind: property %s: %w", p.name, err)
+		}
+	}
+	return s, nil
+}
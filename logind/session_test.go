@@ -0,0 +1,51 @@
+package logind
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestLookupSession(t *testing.T) {
+	busctlPath = "testdata/busctl"
+	defer func() { busctlPath = "busctl" }()
+	s, err := LookupSession("31")
+	if err != nil {
+		t.Fatalf("lookupsession #error: %v", err)
+	}
+	expected := Session{
+		ID: "31", Path: "/org/freedesktop/login1/session/_331", User: "test", UID: 1000,
+		Seat: "seat0", VTNr: 2, TTY: "tty2", Service: "login", Type: "tty",
+		Class: "user", State: "active", Leader: 4242,
+	}
+	if *s != expected {
+		t.Fatalf("lookupsession #expected %+v, got %+v", expected, *s)
+	}
+	if _, err := LookupSession("32"); err == nil {
+		t.Fatalf("lookupsession #expected an error")
+	}
+}
+
+func TestSessionFor(t *testing.T) {
+	busctlPath = "testdata/busctl"
+	defer func() { busctlPath = "busctl" }()
+	tx, err := pam.StartConfDir("permit-service", "test", nil, "../test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if _, err := SessionFor(tx); !errors.Is(err, ErrNoSession) {
+		t.Fatalf("sessionfor #expected %v, got %v", ErrNoSession, err)
+	}
+	if err := tx.PutEnv("XDG_SESSION_ID=31"); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	s, err := SessionFor(tx)
+	if err != nil {
+		t.Fatalf("sessionfor #error: %v", err)
+	}
+	if s.ID != "31" || s.Seat != "seat0" {
+		t.Fatalf("sessionfor #unexpected session: %+v", s)
+	}
+}
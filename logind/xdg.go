@@ -0,0 +1,113 @@
+package logind
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/msteinert/pam"
+)
+
+// ErrInvalidSessionEnv is returned when a variable of a SessionEnv would be
+// rejected or misinterpreted by pam_systemd.
+var ErrInvalidSessionEnv = errors.New("logind: invalid session environment")
+
+// sessionTypes and sessionClasses are the values known to pam_systemd.
+var (
+	sessionTypes   = []string{"unspecified", "tty", "x11", "wayland", "mir", "web"}
+	sessionClasses = []string{"user", "user-early", "user-incomplete", "user-light",
+		"greeter", "lock-screen", "background", "background-light",
+		"manager", "manager-early"}
+)
+
+// SessionEnv is the description of the session that the application passes
+// to pam_systemd through the PAM environment, as display managers and
+// greeters do before OpenSession. Empty fields are not set, pam_systemd
+// then derives them from the PAM items.
+type SessionEnv struct {
+	// Type is XDG_SESSION_TYPE, such as "tty", "x11" or "wayland".
+	Type string
+	// Class is XDG_SESSION_CLASS, such as "user" or "greeter".
+	Class string
+	// Desktop is XDG_SESSION_DESKTOP, such as "gnome" or "sway".
+	Desktop string
+	// Seat is XDG_SEAT, such as "seat0".
+	Seat string
+	// VTNr is XDG_VTNR, the virtual terminal of the session. It is only
+	// meaningful on seat0, or if Seat is empty.
+	VTNr uint32
+}
+
+// Validate checks the values of e the way pam_systemd does, so that a
+// mistake is reported instead of pam_systemd silently ignoring the value
+// or registering the session with the wrong type.
+func (e *SessionEnv) Validate() error {
+	if e.Type != "" && !contains(sessionTypes, e.Type) {
+		return fmt.Errorf("%w: XDG_SESSION_TYPE %q", ErrInvalidSessionEnv, e.Type)
+	}
+	if e.Class != "" && !contains(sessionClasses, e.Class) {
+		return fmt.Errorf("%w: XDG_SESSION_CLASS %q", ErrInvalidSessionEnv, e.Class)
+	}
+	if e.Desktop != "" && !validName(e.Desktop, "-_.:") {
+		return fmt.Errorf("%w: XDG_SESSION_DESKTOP %q", ErrInvalidSessionEnv, e.Desktop)
+	}
+	if e.Seat != "" && (!strings.HasPrefix(e.Seat, "seat") || len(e.Seat) > 255 || !validName(e.Seat, "-_")) {
+		return fmt.Errorf("%w: XDG_SEAT %q", ErrInvalidSessionEnv, e.Seat)
+	}
+	if e.VTNr > 63 {
+		return fmt.Errorf("%w: XDG_VTNR %d", ErrInvalidSessionEnv, e.VTNr)
+	}
+	if e.VTNr != 0 && e.Seat != "" && e.Seat != "seat0" {
+		return fmt.Errorf("%w: XDG_VTNR %d on %s", ErrInvalidSessionEnv, e.VTNr, e.Seat)
+	}
+	return nil
+}
+
+// Apply validates e and sets its variables in the PAM environment of t, it
+// must be called before OpenSession. Either all of the variables are set or
+// none of them is.
+func (e *SessionEnv) Apply(t pam.TransactionHandle) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	env := make(map[string]string)
+	for name, value := range map[string]string{
+		"XDG_SESSION_TYPE":    e.Type,
+		"XDG_SESSION_CLASS":   e.Class,
+		"XDG_SESSION_DESKTOP": e.Desktop,
+		"XDG_SEAT":            e.Seat,
+	} {
+		if value != "" {
+			env[name] = value
+		}
+	}
+	if e.VTNr != 0 {
+		env["XDG_VTNR"] = strconv.FormatUint(uint64(e.VTNr), 10)
+	}
+	return t.PutEnvPairs(env)
+}
+
+// contains returns whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validName returns whether s only has ASCII letters, digits and the
+// characters of extra.
+func validName(s, extra string) bool {
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c < 0x80 && strings.ContainsRune(extra, c):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package logind
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/pamtest"
+)
+
+func TestSessionEnvValidate(t *testing.T) {
+	tests := []struct {
+		env   SessionEnv
+		valid bool
+	}{
+		{SessionEnv{}, true},
+		{SessionEnv{Type: "wayland", Class: "greeter", Desktop: "gnome", Seat: "seat0", VTNr: 1}, true},
+		{SessionEnv{Type: "x11", Desktop: "KDE:plasma", VTNr: 7}, true},
+		{SessionEnv{Type: "Wayland"}, false},
+		{SessionEnv{Class: "admin"}, false},
+		{SessionEnv{Desktop: "my desktop"}, false},
+		{SessionEnv{Seat: "0"}, false},
+		{SessionEnv{Seat: "seat/1"}, false},
+		{SessionEnv{VTNr: 64}, false},
+		{SessionEnv{Seat: "seat1", VTNr: 1}, false},
+	}
+	for _, tt := range tests {
+		err := tt.env.Validate()
+		if tt.valid && err != nil {
+			t.Fatalf("validate #error: %+v: %v", tt.env, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidSessionEnv) {
+			t.Fatalf("validate #expected %v for %+v, got %v", ErrInvalidSessionEnv, tt.env, err)
+		}
+	}
+}
+
+func TestSessionEnvApply(t *testing.T) {
+	tx, err := pam.StartConfDir("permit-service", "test", nil, "../test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := (&SessionEnv{Type: "wayland", Seat: "seat1", VTNr: 2}).Apply(tx); err == nil {
+		t.Fatalf("apply #expected an error")
+	}
+	if _, ok := tx.LookupEnv("XDG_SESSION_TYPE"); ok {
+		t.Fatalf("apply #unexpected XDG_SESSION_TYPE")
+	}
+	if err := (&SessionEnv{Type: "wayland", Class: "greeter", Seat: "seat0", VTNr: 2}).Apply(tx); err != nil {
+		t.Fatalf("apply #error: %v", err)
+	}
+	env, err := tx.GetEnvList()
+	if err != nil {
+		t.Fatalf("getenvlist #error: %v", err)
+	}
+	expected := map[string]string{
+		"XDG_SESSION_TYPE": "wayland", "XDG_SESSION_CLASS": "greeter",
+		"XDG_SEAT": "seat0", "XDG_VTNR": "2",
+	}
+	if len(env) != len(expected) {
+		t.Fatalf("apply #expected %v, got %v", expected, env)
+	}
+	for k, v := range expected {
+		if env[k] != v {
+			t.Fatalf("apply #expected %v, got %v", expected, env)
+		}
+	}
+}
+
+func TestSessionEnvApplyMock(t *testing.T) {
+	m := pamtest.NewMockTransaction("login", "test", nil)
+	if err := (&SessionEnv{Type: "tty", Seat: "seat0", VTNr: 3}).Apply(m); err != nil {
+		t.Fatalf("apply #error: %v", err)
+	}
+	if v := m.Env["XDG_VTNR"]; v != "3" {
+		t.Fatalf("apply #expected 3, got %q", v)
+	}
+	if n := m.Called("PutEnvList"); n != 1 {
+		t.Fatalf("apply #expected 1 call, got %d", n)
+	}
+}
@@ -0,0 +1,196 @@
+package pam
+
+import (
+	"context"
+	"log"
+)
+
+// Middleware decorates a conversation handler, such as to log, translate or
+// record the messages before passing them to the next handler. The handlers
+// returned by the middlewares of this package forward the optional
+// interfaces implemented by the next handler, such as
+// ContextConversationHandler.
+type Middleware func(next ConversationHandler) ConversationHandler
+
+// Chain returns the handler h decorated by the middlewares, the first one
+// being the outermost. Binary prompts are passed to h directly, unless a
+// middleware returns a BinaryConversationHandler.
+func Chain(h ConversationHandler, m ...Middleware) ConversationHandler {
+	next := h
+	for i := len(m) - 1; i >= 0; i-- {
+		next = m[i](next)
+	}
+	if b, ok := h.(BinaryConversationHandler); ok {
+		if _, ok := next.(BinaryConversationHandler); !ok {
+			return binaryChain{next, b}
+		}
+	}
+	return next
+}
+
+// binaryChain is a chained handler that passes the binary prompts to the
+// innermost handler.
+type binaryChain struct {
+	ConversationHandler
+	binary BinaryConversationHandler
+}
+
+func (c binaryChain) RespondPAMBinary(p BinaryPointer) ([]byte, error) {
+	return c.binary.RespondPAMBinary(p)
+}
+
+func (c binaryChain) Wipe() {
+	if w, ok := c.ConversationHandler.(ConversationHandlerWiper); ok {
+		w.Wipe()
+	}
+}
+
+// LogMessages returns a middleware logging the messages and the responses
+// to l, or to the standard logger if nil. The responses to PromptEchoOff
+// messages are redacted.
+func LogMessages(l *log.Logger) Middleware {
+	logf := log.Printf
+	if l != nil {
+		logf = l.Printf
+	}
+	return func(next ConversationHandler) ConversationHandler {
+		return decorate(next, nil, func(m Message, r Response, err error) {
+			switch {
+			case err != nil:
+				logf("pam: %v %q: %v", m.Style, m.Msg, err)
+			case m.Style == PromptEchoOff:
+				logf("pam: %v %q: <redacted>", m.Style, m.Msg)
+			case m.Style == PromptEchoOn:
+				logf("pam: %v %q: %q", m.Style, m.Msg, r.Resp)
+			default:
+				logf("pam: %v %q", m.Style, m.Msg)
+			}
+		})
+	}
+}
+
+// TranslateMessages returns a middleware replacing the text of the messages
+// with the one returned by translate, such as a localized prompt.
+func TranslateMessages(translate func(Style, string) string) Middleware {
+	return func(next ConversationHandler) ConversationHandler {
+		return decorate(next, func(m Message) Message {
+			m.Msg = translate(m.Style, m.Msg)
+			return m
+		}, nil)
+	}
+}
+
+// decorator is a handler passing the messages to before and the responses
+// to after before and after passing them to next, if they are not nil.
+// Binary prompts are passed to next as is.
+type decorator struct {
+	next   ConversationHandler
+	before func(Message) Message
+	after  func(Message, Response, error)
+}
+
+// decorate returns next decorated by before and after, the returned handler
+// forwards the optional interfaces implemented by next, so that a
+// ContextConversationHandler is still canceled, a ConversationsHandler still
+// receives all the messages at once and a ConversationHandlerCloner is still
+// copied for each transaction.
+func decorate(next ConversationHandler, before func(Message) Message, after func(Message, Response, error)) ConversationHandler {
+	d := &decorator{next: next, before: before, after: after}
+	_, binary := next.(BinaryConversationHandler)
+	_, conversations := next.(ConversationsHandler)
+	switch {
+	case binary && conversations:
+		return binaryConversationsDecorator{d}
+	case binary:
+		return binaryDecorator{d}
+	case conversations:
+		return conversationsDecorator{d}
+	}
+	return d
+}
+
+func (d *decorator) RespondPAM(s Style, msg string) (string, error) {
+	return d.RespondPAMContext(context.Background(), s, msg)
+}
+
+func (d *decorator) RespondPAMContext(ctx context.Context, s Style, msg string) (string, error) {
+	m := d.in(Message{Style: s, Msg: msg})
+	r, err := respondMessage(ctx, d.next, m)
+	d.out(m, r, err)
+	return r.Resp, err
+}
+
+func (d *decorator) CloneConversationHandler() ConversationHandler {
+	return decorate(cloneHandler(d.next), d.before, d.after)
+}
+
+func (d *decorator) Reset() {
+	if r, ok := d.next.(ConversationHandlerResetter); ok {
+		r.Reset()
+	}
+}
+
+func (d *decorator) Wipe() {
+	if w, ok := d.next.(ConversationHandlerWiper); ok {
+		w.Wipe()
+	}
+}
+
+// in returns the message passed to next.
+func (d *decorator) in(m Message) Message {
+	if d.before == nil || m.Style == BinaryPrompt {
+		return m
+	}
+	return d.before(m)
+}
+
+// out passes the response of next to m to after.
+func (d *decorator) out(m Message, r Response, err error) {
+	if d.after != nil && m.Style != BinaryPrompt {
+		d.after(m, r, err)
+	}
+}
+
+// respondBinary passes the binary prompt to next.
+func (d *decorator) respondBinary(p BinaryPointer) ([]byte, error) {
+	return d.next.(BinaryConversationHandler).RespondPAMBinary(p)
+}
+
+// respondConversations passes all the messages to next at once.
+func (d *decorator) respondConversations(msgs []Message) ([]Response, error) {
+	in := make([]Message, len(msgs))
+	for i, m := range msgs {
+		in[i] = d.in(m)
+	}
+	responses, err := d.next.(ConversationsHandler).RespondPAMConversations(in)
+	for i, m := range in {
+		var r Response
+		if err == nil && i < len(responses) {
+			r = responses[i]
+		}
+		d.out(m, r, err)
+	}
+	return responses, err
+}
+
+type binaryDecorator struct{ *decorator }
+
+func (d binaryDecorator) RespondPAMBinary(p BinaryPointer) ([]byte, error) {
+	return d.respondBinary(p)
+}
+
+type conversationsDecorator struct{ *decorator }
+
+func (d conversationsDecorator) RespondPAMConversations(msgs []Message) ([]Response, error) {
+	return d.respondConversations(msgs)
+}
+
+type binaryConversationsDecorator struct{ *decorator }
+
+func (d binaryConversationsDecorator) RespondPAMBinary(p BinaryPointer) ([]byte, error) {
+	return d.respondBinary(p)
+}
+
+func (d binaryConversationsDecorator) RespondPAMConversations(msgs []Message) ([]Response, error) {
+	return d.respondConversations(msgs)
+}
@@ -0,0 +1,123 @@
+package pam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+type binaryEcho struct {
+	ConversationFunc
+}
+
+func (binaryEcho) RespondPAMBinary(p BinaryPointer) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next ConversationHandler) ConversationHandler {
+			return ConversationFunc(func(s Style, msg string) (string, error) {
+				order = append(order, name)
+				return next.RespondPAM(s, msg)
+			})
+		}
+	}
+	h := ConversationFunc(func(s Style, msg string) (string, error) {
+		return msg, nil
+	})
+	r, err := Chain(h, trace("a"), trace("b")).RespondPAM(PromptEchoOn, "x")
+	if err != nil || r != "x" {
+		t.Fatalf("chain #error: %q, %v", r, err)
+	}
+	if strings.Join(order, "") != "ab" {
+		t.Fatalf("chain #error: unexpected order %v", order)
+	}
+	if Chain(h) == nil {
+		t.Fatalf("chain #error: expected the handler")
+	}
+	c := Chain(binaryEcho{h}, trace("a"))
+	b, ok := c.(BinaryConversationHandler)
+	if !ok {
+		t.Fatalf("chain #error: expected a binary handler")
+	}
+	if d, err := b.RespondPAMBinary(nil); err != nil || len(d) != 1 {
+		t.Fatalf("chain #error: %v, %v", d, err)
+	}
+}
+
+func TestLogMessages(t *testing.T) {
+	var buf bytes.Buffer
+	var got []string
+	h := Chain(ConversationFunc(func(s Style, msg string) (string, error) {
+		got = append(got, msg)
+		return "response", nil
+	}), LogMessages(log.New(&buf, "", 0)), TranslateMessages(func(s Style, msg string) string {
+		if msg == "Password: " {
+			return "Mot de passe : "
+		}
+		return msg
+	}))
+	if _, err := h.RespondPAM(PromptEchoOff, "Password: "); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if _, err := h.RespondPAM(PromptEchoOn, "login: "); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if strings.Join(got, "|") != "Mot de passe : |login: " {
+		t.Fatalf("translatemessages #error: unexpected messages %v", got)
+	}
+	out := buf.String()
+	expected := "pam: PromptEchoOff \"Password: \": <redacted>\npam: PromptEchoOn \"login: \": \"response\"\n"
+	if out != expected {
+		t.Fatalf("logmessages #error: expected %q, got %q", expected, out)
+	}
+}
+
+func TestMiddlewareInterfaces(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	h, ok := Chain(NewChannelHandler(), LogMessages(logger)).(ContextConversationHandler)
+	if !ok {
+		t.Fatalf("chain #error: expected a context handler")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := h.RespondPAMContext(ctx, PromptEchoOn, "login: "); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpamcontext #expected %v, got %v", ErrConv, err)
+	}
+
+	translate := TranslateMessages(func(s Style, msg string) string {
+		return strings.ToUpper(msg)
+	})
+	c := Chain(ConversationsFunc(func(msgs []Message) ([]Response, error) {
+		r := make([]Response, len(msgs))
+		for i, m := range msgs {
+			r[i].Resp = m.Msg
+		}
+		return r, nil
+	}), LogMessages(logger), translate)
+	cs, ok := c.(ConversationsHandler)
+	if !ok {
+		t.Fatalf("chain #error: expected a conversations handler")
+	}
+	r, err := cs.RespondPAMConversations([]Message{{Style: TextInfo, Msg: "a"}, {Style: PromptEchoOn, Msg: "b"}})
+	if err != nil || len(r) != 2 || r[1].Resp != "B" {
+		t.Fatalf("respondpamconversations #error: %v, %v", r, err)
+	}
+
+	two := &TwoFactorHandler{Password: func(string) (string, error) { return "secret", nil }}
+	tx, err := StartConfDir("permit-service", "testuser", Chain(two, translate), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	d, ok := tx.state.handler.(*decorator)
+	if !ok || d.next == ConversationHandler(two) {
+		t.Fatalf("start #error: expected a copy of the handler, got %v", tx.state.handler)
+	}
+}
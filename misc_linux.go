@@ -0,0 +1,74 @@
+//go:build linux && pam_misc
+
+// The pam_misc wrappers are only built with the pam_misc build tag, so that
+// the users of the package do not have to link with libpam_misc.
+
+package pam
+
+//#cgo LDFLAGS: -lpam_misc
+//#include <security/pam_appl.h>
+//#include <security/pam_misc.h>
+//#include <stdlib.h>
+import "C"
+
+import (
+	"strings"
+	"unsafe"
+)
+
+// MiscPasteEnv copies the "NAME=value" strings of env, such as the ones
+// returned by os.Environ, into the PAM environment using pam_misc_paste_env,
+// as login and su do. It requires the pam_misc build tag.
+func (t *Transaction) MiscPasteEnv(env []string) error {
+	if err := t.checkEnded("pam_misc_paste_env"); err != nil {
+		return err
+	}
+	for _, kv := range env {
+		if err := checkCString(kv); err != nil {
+			return &OpError{Op: "pam_misc_paste_env", Args: strings.SplitN(kv, "=", 2)[0], Err: err}
+		}
+	}
+	list := (**C.char)(C.calloc(C.size_t(len(env)+1), C.size_t(unsafe.Sizeof((*C.char)(nil)))))
+	if list == nil {
+		return t.handlePamStatus(C.PAM_BUF_ERR, "pam_misc_paste_env")
+	}
+	entries := unsafe.Slice(list, len(env)+1)
+	defer func() {
+		for _, p := range entries {
+			C.free(unsafe.Pointer(p))
+		}
+		C.free(unsafe.Pointer(list))
+	}()
+	for i, kv := range env {
+		entries[i] = C.CString(kv)
+	}
+	return t.handlePamStatus(t.run(func() C.int {
+		return C.pam_misc_paste_env(t.handle, list)
+	}), "pam_misc_paste_env")
+}
+
+// MiscSetEnv sets a PAM environment variable using pam_misc_setenv. If
+// readonly is true an existing variable is not overwritten, and ErrPermDenied
+// is returned instead. It requires the pam_misc build tag.
+func (t *Transaction) MiscSetEnv(name, value string, readonly bool) error {
+	if err := t.checkEnded("pam_misc_setenv"); err != nil {
+		return err
+	}
+	if err := checkEnvName(name); err != nil {
+		return &OpError{Op: "pam_misc_setenv", Args: name, Err: err}
+	}
+	if err := checkCString(value); err != nil {
+		return &OpError{Op: "pam_misc_setenv", Args: name, Err: err}
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cvalue := C.CString(value)
+	defer C.free(unsafe.Pointer(cvalue))
+	var ro C.int
+	if readonly {
+		ro = 1
+	}
+	return t.handlePamStatus(t.run(func() C.int {
+		return C.pam_misc_setenv(t.handle, cname, cvalue, ro)
+	}), "pam_misc_setenv", name)
+}
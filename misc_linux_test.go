@@ -0,0 +1,51 @@
+//go:build linux && pam_misc
+
+package pam
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMiscPasteEnv(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.MiscPasteEnv([]string{"VAL1=1", "VAL2=a=b"}); err != nil {
+		t.Fatalf("miscpasteenv #error: %v", err)
+	}
+	if tx.GetEnv("VAL1") != "1" || tx.GetEnv("VAL2") != "a=b" {
+		t.Fatalf("miscpasteenv #error: unexpected environment")
+	}
+	if err := tx.MiscPasteEnv(nil); err != nil {
+		t.Fatalf("miscpasteenv #error: %v", err)
+	}
+	if err := tx.MiscPasteEnv([]string{"VAL3=\x00"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("miscpasteenv #expected %v, got %v", ErrInvalidArgument, err)
+	}
+}
+
+func TestMiscSetEnv(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.MiscSetEnv("VAL1", "1", true); err != nil {
+		t.Fatalf("miscsetenv #error: %v", err)
+	}
+	if err := tx.MiscSetEnv("VAL1", "2", true); !errors.Is(err, ErrPermDenied) {
+		t.Fatalf("miscsetenv #expected %v, got %v", ErrPermDenied, err)
+	}
+	if err := tx.MiscSetEnv("VAL1", "3", false); err != nil {
+		t.Fatalf("miscsetenv #error: %v", err)
+	}
+	if v := tx.GetEnv("VAL1"); v != "3" {
+		t.Fatalf("miscsetenv #error: expected 3, got %v", v)
+	}
+	if err := tx.MiscSetEnv("A=B", "", false); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("miscsetenv #expected %v, got %v", ErrInvalidArgument, err)
+	}
+}
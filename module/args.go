@@ -0,0 +1,165 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"log/syslog"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArgError reports an argument of the module that can not be parsed.
+type ArgError struct {
+	// Arg is the argument, as given in the PAM configuration.
+	Arg string
+	// Err is the reason.
+	Err error
+}
+
+func (e *ArgError) Error() string {
+	return fmt.Sprintf("module: invalid argument %q: %v", e.Arg, e.Err)
+}
+
+func (e *ArgError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownArgsError reports the arguments of the module that do not match
+// an option.
+type UnknownArgsError struct {
+	Args []string
+}
+
+func (e *UnknownArgsError) Error() string {
+	return fmt.Sprintf("module: unknown arguments: %s", strings.Join(e.Args, " "))
+}
+
+// errMissingValue is returned for an option requiring a value given alone.
+var errMissingValue = errors.New("missing value")
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ParseArgs parses the arguments given to the module in the PAM
+// configuration into the struct pointed to by v, whose exported fields are
+// the options. The name of an option is given by the pam field tag, or is
+// the lower case name of the field; the tag "-" ignores the field.
+//
+// An argument is either "name" or "name=value". A bool option can be given
+// alone to be set to true, the other ones need a value: strings, integers,
+// and durations which are either parsed by time.ParseDuration or a number
+// of seconds, as C modules usually take them. A []string option collects
+// the values of all its occurrences.
+//
+// All the arguments are parsed, the first invalid value is returned as an
+// ArgError; otherwise the arguments that do not match an option, if any,
+// are returned in an UnknownArgsError.
+func ParseArgs(args []string, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("module: ParseArgs of non struct pointer %T", v)
+	}
+	fields := make(map[string]reflect.Value)
+	st := rv.Elem().Type()
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		name := f.Tag.Get("pam")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = rv.Elem().Field(i)
+	}
+	var first error
+	var unknown []string
+	for _, a := range args {
+		name, value, hasValue := strings.Cut(a, "=")
+		f, ok := fields[name]
+		if !ok {
+			unknown = append(unknown, a)
+			continue
+		}
+		if err := setArg(f, value, hasValue); err != nil && first == nil {
+			first = &ArgError{Arg: a, Err: err}
+		}
+	}
+	if first != nil {
+		return first
+	}
+	if len(unknown) > 0 {
+		return &UnknownArgsError{Args: unknown}
+	}
+	return nil
+}
+
+// setArg sets the option f to value.
+func setArg(f reflect.Value, value string, hasValue bool) error {
+	if f.Kind() == reflect.Bool {
+		if !hasValue {
+			f.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+		return nil
+	}
+	if !hasValue {
+		return errMissingValue
+	}
+	switch {
+	case f.Type() == durationType:
+		d, err := parseDuration(value)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+	case f.Kind() == reflect.String:
+		f.SetString(value)
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+		f.Set(reflect.Append(f, reflect.ValueOf(value).Convert(f.Type().Elem())))
+	case f.CanInt():
+		n, err := strconv.ParseInt(value, 0, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case f.CanUint():
+		n, err := strconv.ParseUint(value, 0, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported option type %s", f.Type())
+	}
+	return nil
+}
+
+// parseDuration parses a duration or a number of seconds.
+func parseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ParseArgs parses args into v as the ParseArgs function does, but the
+// unknown arguments are logged with Logf instead of failing, as C modules
+// do.
+func (mt *ModuleTransaction) ParseArgs(args []string, v any) error {
+	err := ParseArgs(args, v)
+	var u *UnknownArgsError
+	if errors.As(err, &u) {
+		for _, a := range u.Args {
+			mt.Logf(syslog.LOG_ERR, "unknown option: %s", a)
+		}
+		return nil
+	}
+	return err
+}
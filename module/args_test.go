@@ -0,0 +1,65 @@
+package module
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type options struct {
+	Debug    bool
+	Retry    int           `pam:"retry"`
+	Timeout  time.Duration `pam:"timeout"`
+	Prompt   string        `pam:"prompt"`
+	Mode     uint32        `pam:"mode"`
+	Groups   []string      `pam:"group"`
+	NoDelay  bool          `pam:"nodelay"`
+	Internal string        `pam:"-"`
+}
+
+func TestParseArgs(t *testing.T) {
+	var opts options
+	err := ParseArgs([]string{"debug", "retry=3", "timeout=30", "prompt=Code: ",
+		"mode=0700", "group=wheel", "group=adm", "nodelay=false", "Internal=x", "use_first_pass"}, &opts)
+	var u *UnknownArgsError
+	if !errors.As(err, &u) || !reflect.DeepEqual(u.Args, []string{"Internal=x", "use_first_pass"}) {
+		t.Fatalf("parseargs #unexpected error: %v", err)
+	}
+	expected := options{Debug: true, Retry: 3, Timeout: 30 * time.Second, Prompt: "Code: ",
+		Mode: 0700, Groups: []string{"wheel", "adm"}}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("parseargs #expected %+v, got %+v", expected, opts)
+	}
+	if err := ParseArgs([]string{"timeout=1m30s"}, &opts); err != nil || opts.Timeout != 90*time.Second {
+		t.Fatalf("parseargs #error: %v, %v", opts.Timeout, err)
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		arg string
+		err error
+	}{
+		{"retry", errMissingValue},
+		{"retry=three", strconv.ErrSyntax},
+		{"mode=-1", strconv.ErrSyntax},
+		{"debug=maybe", strconv.ErrSyntax},
+		{"timeout=soon", nil},
+	}
+	for _, tt := range tests {
+		var opts options
+		err := ParseArgs([]string{"unknown", tt.arg}, &opts)
+		var ae *ArgError
+		if !errors.As(err, &ae) || ae.Arg != tt.arg {
+			t.Fatalf("parseargs #expected an ArgError for %q, got %v", tt.arg, err)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Fatalf("parseargs #expected %v, got %v", tt.err, err)
+		}
+	}
+	if err := ParseArgs(nil, options{}); err == nil {
+		t.Fatalf("parseargs #expected an error for a non pointer")
+	}
+}
@@ -0,0 +1,73 @@
+package module
+
+//#include <security/pam_modules.h>
+//#include <security/pam_ext.h>
+//#include <stdlib.h>
+//#include <string.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/msteinert/pam"
+)
+
+// GetAuthTok returns the authentication token i, pam.Authtok or
+// pam.Oldauthtok, as pam_get_authtok does: the token set by a previous
+// module is used if the module arguments have try_first_pass,
+// use_first_pass or use_authtok, otherwise the user is prompted for it and
+// the item is set. During ChangeAuthTok, the new token is asked twice to
+// be confirmed. If prompt is empty, the PAM default prompt is used.
+// Linux-PAM extension.
+func (mt *ModuleTransaction) GetAuthTok(i pam.Item, prompt string) (string, error) {
+	return mt.getAuthTok("pam_get_authtok", i, prompt, func(tok **C.char, p *C.char) C.int {
+		return C.pam_get_authtok(mt.handle, C.int(i), tok, p)
+	})
+}
+
+// GetAuthTokNoVerify returns the new authentication token during
+// ChangeAuthTok without asking for its confirmation, as
+// pam_get_authtok_noverify does, GetAuthTokVerify confirms it afterwards.
+// Linux-PAM extension.
+func (mt *ModuleTransaction) GetAuthTokNoVerify(prompt string) (string, error) {
+	return mt.getAuthTok("pam_get_authtok_noverify", pam.Authtok, prompt, func(tok **C.char, p *C.char) C.int {
+		return C.pam_get_authtok_noverify(mt.handle, tok, p)
+	})
+}
+
+// GetAuthTokVerify asks for the confirmation of the new authentication
+// token tok returned by GetAuthTokNoVerify, as pam_get_authtok_verify does.
+// The Authtok item is set if both match, otherwise it is cleared and
+// pam.ErrTryAgain is returned. If prompt is not empty, the user is asked to
+// "Retype" it. Linux-PAM extension.
+func (mt *ModuleTransaction) GetAuthTokVerify(tok, prompt string) (string, error) {
+	if err := checkCString(tok); err != nil {
+		return "", &pam.OpError{Op: "pam_get_authtok_verify", Args: pam.Authtok.String(), Err: err}
+	}
+	ctok := C.CString(tok)
+	defer func() {
+		C.memset(unsafe.Pointer(ctok), 0, C.size_t(len(tok)))
+		C.free(unsafe.Pointer(ctok))
+	}()
+	return mt.getAuthTok("pam_get_authtok_verify", pam.Authtok, prompt, func(tok **C.char, p *C.char) C.int {
+		*tok = ctok
+		return C.pam_get_authtok_verify(mt.handle, tok, p)
+	})
+}
+
+// getAuthTok calls the pam_get_authtok function fn with prompt.
+func (mt *ModuleTransaction) getAuthTok(op string, i pam.Item, prompt string, fn func(**C.char, *C.char) C.int) (string, error) {
+	if err := checkCString(prompt); err != nil {
+		return "", &pam.OpError{Op: op, Args: i.String(), Err: err}
+	}
+	var p *C.char
+	if prompt != "" {
+		p = C.CString(prompt)
+		defer C.free(unsafe.Pointer(p))
+	}
+	var tok *C.char
+	if err := opError(fn(&tok, p), op, i); err != nil {
+		return "", err
+	}
+	return C.GoString(tok), nil
+}
@@ -0,0 +1,41 @@
+package module
+
+//#include <security/pam_modules.h>
+//#include <stdlib.h>
+//
+//int module_binary_prompt(pam_handle_t *pamh, const void *msg, void **response);
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/msteinert/pam"
+)
+
+// BinaryPrompt sends a binary message of type msgType with payload to the
+// application through its conversation function, in the Linux-PAM binary
+// prompt format, and returns the payload of its binary reply. It is used by
+// modules implementing a protocol with a client: Go applications without a
+// pam.BinaryConversationHandler reply with pam.ErrAuthinfoUnavail.
+// Linux-PAM extension.
+func (mt *ModuleTransaction) BinaryPrompt(msgType byte, payload []byte) ([]byte, error) {
+	msg, err := pam.BinaryEncode(msgType, payload)
+	if err != nil {
+		return nil, &pam.OpError{Op: "pam_conv", Args: pam.BinaryPrompt.String(), Err: err}
+	}
+	cmsg := C.CBytes(msg)
+	defer C.free(cmsg)
+	var resp unsafe.Pointer
+	if err := opError(C.module_binary_prompt(mt.handle, cmsg, &resp), "pam_conv", pam.BinaryPrompt); err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, &pam.OpError{Op: "pam_conv", Args: pam.BinaryPrompt.String(), Err: pam.ErrConv}
+	}
+	defer C.free(resp)
+	_, data, err := pam.BinaryDecode(pam.BinaryPointer(resp))
+	if err != nil {
+		return nil, &pam.OpError{Op: "pam_conv", Args: pam.BinaryPrompt.String(), Err: err}
+	}
+	return data, nil
+}
@@ -0,0 +1,84 @@
+package module
+
+//#include <security/pam_modules.h>
+//#include <stdint.h>
+//#include <stdlib.h>
+//
+//int set_data(pam_handle_t *pamh, const char *name, uintptr_t handle);
+//int get_data(pam_handle_t *pamh, const char *name, uintptr_t *handle);
+import "C"
+
+import (
+	"errors"
+	"runtime/cgo"
+	"unsafe"
+
+	"github.com/msteinert/pam"
+)
+
+// DataReplace is passed to DataCleaner when the data is replaced by a new
+// call to SetData with the same key, rather than removed by pam_end.
+const DataReplace pam.Flags = C.PAM_DATA_REPLACE
+
+// ErrForeignData is returned by GetData when the data was set under key by
+// another module, it can not be read as a Go value.
+var ErrForeignData = errors.New("module: data not set by this module")
+
+// DataCleaner is implemented by the values given to SetData that release
+// resources once PAM removes them. status is the status passed to pam_end;
+// flags can have DataReplace and pam.DataSilent, in which case the value is
+// removed in a process that shares the transaction and must not release
+// shared resources, such as a session.
+type DataCleaner interface {
+	CleanupData(status pam.Error, flags pam.Flags)
+}
+
+// cbCleanupData is the cleanup callback of the data set by SetData.
+//
+//export cbCleanupData
+func cbCleanupData(h C.uintptr_t, status C.int) {
+	v := cgo.Handle(h)
+	defer v.Delete()
+	if c, ok := v.Value().(DataCleaner); ok {
+		flags := pam.Flags(status) & (DataReplace | pam.DataSilent)
+		c.CleanupData(pam.Error(status)&^pam.Error(flags), flags)
+	}
+}
+
+// SetData stores v under key, as pam_set_data does, so that it can be
+// retrieved by GetData in a later call of the module during the same
+// transaction, such as SetCred after Authenticate. The value replaces the
+// one previously stored under key and is kept until the transaction ends,
+// DataCleaner is called when it is removed.
+func (mt *ModuleTransaction) SetData(key string, v any) error {
+	if err := checkCString(key); err != nil {
+		return &pam.OpError{Op: "pam_set_data", Args: key, Err: err}
+	}
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	h := cgo.NewHandle(v)
+	if err := opError(C.set_data(mt.handle, ckey, C.uintptr_t(h)), "pam_set_data", key); err != nil {
+		h.Delete()
+		return err
+	}
+	return nil
+}
+
+// GetData returns the value stored under key by SetData, as pam_get_data
+// does. It returns pam.ErrNoModuleData if nothing is stored under key.
+func (mt *ModuleTransaction) GetData(key string) (any, error) {
+	if err := checkCString(key); err != nil {
+		return nil, &pam.OpError{Op: "pam_get_data", Args: key, Err: err}
+	}
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	var h C.uintptr_t
+	status := C.get_data(mt.handle, ckey, &h)
+	if status == -1 {
+		return nil, &pam.OpError{Op: "pam_get_data", Args: key, Err: ErrForeignData}
+	}
+	if err := opError(status, "pam_get_data", key); err != nil {
+		return nil, err
+	}
+	return cgo.Handle(h).Value(), nil
+}
@@ -0,0 +1,24 @@
+// Package module provides a wrapper for the PAM module API, so that PAM
+// modules can be written in Go.
+//
+// A module is a main package registering its ModuleHandler from an init
+// function and built as a shared object, which exports the pam_sm_* entry
+// points defined by this package:
+//
+//	package main
+//
+//	import "github.com/msteinert/pam/module"
+//
+//	func init() {
+//		module.Register(&handler{})
+//	}
+//
+//	func main() {}
+//
+//	go build -buildmode=c-shared -o pam_example.so
+//
+// The resulting module is referenced by its path in the PAM configuration.
+// The pam-moduler command generates this boilerplate, along with a version
+// script restricting the exported symbols to the entry points.
+// The statuses, items and flags are the ones of the pam package.
+package module
@@ -0,0 +1,127 @@
+package module
+
+//#include <security/pam_modules.h>
+//#include "module.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/msteinert/pam"
+)
+
+// ModuleHandler implements the operations of a PAM module, each of them is
+// called by the pam_sm_* entry point of the same name with the module
+// transaction, the flags and the arguments given in the PAM configuration.
+//
+// If the returned error is (or wraps) a pam.Error, such as pam.ErrIgnore or
+// pam.ErrUserUnknown, that status is returned to PAM. Any other error is
+// reported as pam.ErrSystem, and so is a panic of the handler, which would
+// otherwise take down the application.
+type ModuleHandler interface {
+	// Authenticate is pam_sm_authenticate.
+	Authenticate(mt *ModuleTransaction, flags pam.Flags, args []string) error
+	// SetCred is pam_sm_setcred.
+	SetCred(mt *ModuleTransaction, flags pam.Flags, args []string) error
+	// AcctMgmt is pam_sm_acct_mgmt.
+	AcctMgmt(mt *ModuleTransaction, flags pam.Flags, args []string) error
+	// OpenSession is pam_sm_open_session.
+	OpenSession(mt *ModuleTransaction, flags pam.Flags, args []string) error
+	// CloseSession is pam_sm_close_session.
+	CloseSession(mt *ModuleTransaction, flags pam.Flags, args []string) error
+	// ChangeAuthTok is pam_sm_chauthtok, it is called twice: with
+	// PrelimCheck and then with UpdateAuthtok.
+	ChangeAuthTok(mt *ModuleTransaction, flags pam.Flags, args []string) error
+}
+
+// Flags passed to ChangeAuthTok in addition to the pam flags.
+const (
+	// PrelimCheck indicates the first pass, in which the module checks
+	// that the token can be changed without changing it.
+	PrelimCheck pam.Flags = C.PAM_PRELIM_CHECK
+	// UpdateAuthtok indicates the second pass, in which the module
+	// changes the token.
+	UpdateAuthtok pam.Flags = C.PAM_UPDATE_AUTHTOK
+)
+
+var (
+	handlerMu sync.Mutex
+	handler   ModuleHandler
+)
+
+// Register sets the handler of the module, it is usually called from an
+// init function of the main package. Until a handler is registered, the
+// entry points return pam.ErrService.
+func Register(h ModuleHandler) {
+	handlerMu.Lock()
+	handler = h
+	handlerMu.Unlock()
+}
+
+// registered returns the handler of the module.
+func registered() ModuleHandler {
+	handlerMu.Lock()
+	defer handlerMu.Unlock()
+	return handler
+}
+
+// cbModule is the entry point of the pam_sm_* functions, op tells which one
+// was called.
+//
+//export cbModule
+func cbModule(op C.int, pamh *C.pam_handle_t, flags C.int, argc C.int, argv **C.char) C.int {
+	h := registered()
+	if h == nil {
+		return C.int(pam.ErrService)
+	}
+	var args []string
+	if argc > 0 && argv != nil {
+		for _, a := range unsafe.Slice(argv, int(argc)) {
+			args = append(args, C.GoString(a))
+		}
+	}
+	mt := &ModuleTransaction{handle: pamh}
+	var fn func(*ModuleTransaction, pam.Flags, []string) error
+	switch op {
+	case C.OP_AUTHENTICATE:
+		fn = h.Authenticate
+	case C.OP_SETCRED:
+		fn = h.SetCred
+	case C.OP_ACCT_MGMT:
+		fn = h.AcctMgmt
+	case C.OP_OPEN_SESSION:
+		fn = h.OpenSession
+	case C.OP_CLOSE_SESSION:
+		fn = h.CloseSession
+	case C.OP_CHAUTHTOK:
+		fn = h.ChangeAuthTok
+	default:
+		return C.int(pam.ErrService)
+	}
+	return status(invoke(fn, mt, pam.Flags(flags), args))
+}
+
+// invoke calls fn, turning a panic into an error.
+func invoke(fn func(*ModuleTransaction, pam.Flags, []string) error, mt *ModuleTransaction, flags pam.Flags, args []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("module: panic: %v", r)
+		}
+	}()
+	return fn(mt, flags, args)
+}
+
+// status returns the PAM status reporting err.
+func status(err error) C.int {
+	if err == nil {
+		return C.PAM_SUCCESS
+	}
+	var e pam.Error
+	if errors.As(err, &e) {
+		return C.int(e)
+	}
+	return C.int(pam.ErrSystem)
+}
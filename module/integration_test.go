@@ -0,0 +1,115 @@
+package module
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/module/moduletest"
+)
+
+// roundTripHandler answers the prompts of the example module.
+type roundTripHandler struct {
+	messages []string
+}
+
+func (h *roundTripHandler) RespondPAM(s pam.Style, msg string) (string, error) {
+	h.messages = append(h.messages, s.String()+": "+msg)
+	switch s {
+	case pam.PromptEchoOff:
+		return "secret", nil
+	case pam.PromptEchoOn:
+		return "1234", nil
+	}
+	return "", nil
+}
+
+func (h *roundTripHandler) RespondPAMBinary(p pam.BinaryPointer) ([]byte, error) {
+	msgType, data, err := pam.BinaryDecode(p)
+	if err != nil {
+		return nil, err
+	}
+	h.messages = append(h.messages, pam.BinaryPrompt.String()+": "+string(data))
+	return pam.BinaryEncode(msgType+1, []byte(strings.ToUpper(string(data))))
+}
+
+// TestRoundTrip runs a whole login against the example module, going through
+// the conversation, the items, the module data, the environment and the
+// binary prompts.
+func TestRoundTrip(t *testing.T) {
+	u, err := user.Lookup("test")
+	if err != nil {
+		t.Skipf("lookup #error: %v", err)
+	}
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		t.Fatalf("lookupgroupid #error: %v", err)
+	}
+	cleanup := filepath.Join(t.TempDir(), "cleanup")
+	so := moduletest.Build(t, "./testdata/example")
+	dir := moduletest.ConfDir(t, map[string]string{
+		"roundtrip": moduletest.Service(so, "user=test", "password=secret", "code=1234",
+			"binary=ping", "group="+g.Name, "cleanup="+cleanup),
+	})
+	h := &roundTripHandler{}
+	tx, err := pam.StartConfDir("roundtrip", "test", h, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.SetRhost("client.example"); err != nil {
+		t.Fatalf("setrhost #error: %v", err)
+	}
+	if err := tx.PutEnv("EXAMPLE_IN=hello"); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	expected := []string{
+		pam.PromptEchoOff.String() + ": Password: ",
+		pam.TextInfo.String() + ": Welcome test",
+		pam.PromptEchoOn.String() + ": Code: ",
+		pam.BinaryPrompt.String() + ": ping",
+	}
+	if strings.Join(h.messages, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("conversation #expected %q, got %q", expected, h.messages)
+	}
+	if ruser, err := tx.Ruser(); err != nil || ruser != "test@client.example" {
+		t.Fatalf("ruser #error: %q, %v", ruser, err)
+	}
+	if err := tx.AcctMgmt(0); err != nil {
+		t.Fatalf("acctmgmt #error: %v", err)
+	}
+	if err := tx.SetCred(pam.EstablishCred); err != nil {
+		t.Fatalf("setcred #error: %v", err)
+	}
+	if err := tx.OpenSession(0); err != nil {
+		t.Fatalf("opensession #error: %v", err)
+	}
+	env, err := tx.GetEnvList()
+	if err != nil {
+		t.Fatalf("getenvlist #error: %v", err)
+	}
+	for k, v := range map[string]string{
+		"EXAMPLE_DATA":    "test",
+		"EXAMPLE_OUT":     "HELLO",
+		"EXAMPLE_ACCOUNT": u.Uid + ":" + g.Gid,
+	} {
+		if env[k] != v {
+			t.Fatalf("getenvlist #expected %s=%q, got %v", k, v, env)
+		}
+	}
+	if err := tx.CloseSession(0); err != nil {
+		t.Fatalf("closesession #error: %v", err)
+	}
+	if err := tx.End(); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	if _, err := os.Stat(cleanup); err != nil {
+		t.Fatalf("cleanupdata #error: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+#define _DEFAULT_SOURCE
+#include "_cgo_export.h"
+#include <security/pam_modules.h>
+#include <security/pam_ext.h>
+#include <security/pam_modutil.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+int pam_sm_authenticate(pam_handle_t *pamh, int flags, int argc, const char **argv)
+{
+	return cbModule(OP_AUTHENTICATE, pamh, flags, argc, (char **)argv);
+}
+
+int pam_sm_setcred(pam_handle_t *pamh, int flags, int argc, const char **argv)
+{
+	return cbModule(OP_SETCRED, pamh, flags, argc, (char **)argv);
+}
+
+int pam_sm_acct_mgmt(pam_handle_t *pamh, int flags, int argc, const char **argv)
+{
+	return cbModule(OP_ACCT_MGMT, pamh, flags, argc, (char **)argv);
+}
+
+int pam_sm_open_session(pam_handle_t *pamh, int flags, int argc, const char **argv)
+{
+	return cbModule(OP_OPEN_SESSION, pamh, flags, argc, (char **)argv);
+}
+
+int pam_sm_close_session(pam_handle_t *pamh, int flags, int argc, const char **argv)
+{
+	return cbModule(OP_CLOSE_SESSION, pamh, flags, argc, (char **)argv);
+}
+
+int pam_sm_chauthtok(pam_handle_t *pamh, int flags, int argc, const char **argv)
+{
+	return cbModule(OP_CHAUTHTOK, pamh, flags, argc, (char **)argv);
+}
+
+// data_tag identifies the data set by this module, its address is unique
+// to the shared object.
+static const char data_tag;
+
+struct go_data {
+	const void *tag;
+	uintptr_t handle;
+};
+
+static void cleanup_data(pam_handle_t *pamh, void *data, int error_status)
+{
+	struct go_data *d = data;
+
+	cbCleanupData(d->handle, error_status);
+	free(d);
+}
+
+int set_data(pam_handle_t *pamh, const char *name, uintptr_t handle)
+{
+	struct go_data *d;
+	int ret;
+
+	d = malloc(sizeof(*d));
+	if (d == NULL)
+		return PAM_BUF_ERR;
+	d->tag = &data_tag;
+	d->handle = handle;
+	ret = pam_set_data(pamh, name, d, cleanup_data);
+	if (ret != PAM_SUCCESS)
+		free(d);
+	return ret;
+}
+
+int get_data(pam_handle_t *pamh, const char *name, uintptr_t *handle)
+{
+	const void *data;
+	const struct go_data *d;
+	int ret;
+
+	ret = pam_get_data(pamh, name, &data);
+	if (ret != PAM_SUCCESS)
+		return ret;
+	d = data;
+	if (d == NULL || d->tag != &data_tag)
+		return -1;
+	*handle = d->handle;
+	return PAM_SUCCESS;
+}
+
+void module_syslog(pam_handle_t *pamh, int priority, const char *msg)
+{
+	pam_syslog(pamh, priority, "%s", msg);
+}
+
+int module_prompt(pam_handle_t *pamh, int style, char **response, const char *msg)
+{
+	return pam_prompt(pamh, style, response, "%s", msg);
+}
+
+int module_binary_prompt(pam_handle_t *pamh, const void *msg, void **response)
+{
+#ifdef PAM_BINARY_PROMPT
+	const struct pam_conv *conv;
+	struct pam_message m = { PAM_BINARY_PROMPT, msg };
+	const struct pam_message *msgs = &m;
+	struct pam_response *resp = NULL;
+	int ret;
+
+	ret = pam_get_item(pamh, PAM_CONV, (const void **)&conv);
+	if (ret != PAM_SUCCESS)
+		return ret;
+	if (conv == NULL || conv->conv == NULL)
+		return PAM_CONV_ERR;
+	ret = conv->conv(1, &msgs, &resp, conv->appdata_ptr);
+	if (ret != PAM_SUCCESS) {
+		if (resp != NULL) {
+			free(resp->resp);
+			free(resp);
+		}
+		return ret;
+	}
+	if (resp == NULL)
+		return PAM_CONV_ERR;
+	*response = resp->resp;
+	free(resp);
+	return PAM_SUCCESS;
+#else
+	return PAM_CONV_ERR;
+#endif
+}
+
+struct pam_modutil_privs *privs_new(void)
+{
+	struct pam_modutil_privs *p;
+
+	p = calloc(1, sizeof(*p) + PAM_MODUTIL_NGROUPS * sizeof(gid_t));
+	if (p == NULL)
+		return NULL;
+	p->grplist = (gid_t *)(p + 1);
+	p->number_of_groups = PAM_MODUTIL_NGROUPS;
+	p->old_gid = -1;
+	p->old_uid = -1;
+	return p;
+}
+
+extern char **environ;
+
+pid_t module_start_helper(pam_handle_t *pamh, const char *path, char **argv, char **envp, int in, int out, int err)
+{
+	pid_t pid;
+
+	pid = fork();
+	if (pid != 0)
+		return pid;
+	if (pam_modutil_sanitize_helper_fds(pamh, in, out, err) != PAM_SUCCESS)
+		_exit(127);
+	execve(path, argv, envp != NULL ? envp : environ);
+	_exit(127);
+}
@@ -0,0 +1,13 @@
+#ifndef MODULE_H
+#define MODULE_H
+
+enum {
+	OP_AUTHENTICATE,
+	OP_SETCRED,
+	OP_ACCT_MGMT,
+	OP_OPEN_SESSION,
+	OP_CLOSE_SESSION,
+	OP_CHAUTHTOK,
+};
+
+#endif
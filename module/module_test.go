@@ -0,0 +1,314 @@
+package module
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/module/moduletest"
+)
+
+// buildExample builds the example module and returns a configuration
+// directory with a service using it with args.
+func buildExample(t *testing.T, args string) string {
+	t.Helper()
+	so := moduletest.Build(t, "./testdata/example")
+	return moduletest.ConfDir(t, map[string]string{
+		"example": moduletest.Service(so, strings.Fields(args)...),
+	})
+}
+
+func TestModule(t *testing.T) {
+	dir := buildExample(t, "user=test panic=")
+	tx, err := pam.StartConfDir("example", "test", nil, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(pam.Silent); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if v := tx.GetEnv("EXAMPLE_FLAGS"); v != pam.Silent.String() {
+		t.Fatalf("getenv #expected %q, got %q", pam.Silent.String(), v)
+	}
+	if err := tx.SetCred(pam.EstablishCred); err != nil {
+		t.Fatalf("setcred #error: %v", err)
+	}
+	if err := tx.AcctMgmt(0); !errors.Is(err, pam.ErrSystem) {
+		t.Fatalf("acctmgmt #expected %v, got %v", pam.ErrSystem, err)
+	}
+	if err := tx.CloseSession(0); err != nil {
+		t.Fatalf("closesession #error: %v", err)
+	}
+	if rhost, err := tx.GetItem(pam.Rhost); err != nil || rhost != "closed" {
+		t.Fatalf("getitem #error: %q, %v", rhost, err)
+	}
+	if err := tx.OpenSession(0); !errors.Is(err, pam.ErrSystem) {
+		t.Fatalf("opensession #expected %v, got %v", pam.ErrSystem, err)
+	}
+	if err := tx.ChangeAuthTok(0); !errors.Is(err, pam.ErrAuthTokLockBusy) {
+		t.Fatalf("changeauthtok #expected %v, got %v", pam.ErrAuthTokLockBusy, err)
+	}
+
+	tx2, err := pam.StartConfDir("example", "nobody", nil, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx2.End()
+	if err := tx2.Authenticate(0); !errors.Is(err, pam.ErrUserUnknown) {
+		t.Fatalf("authenticate #expected %v, got %v", pam.ErrUserUnknown, err)
+	}
+}
+
+func TestGetAuthTok(t *testing.T) {
+	dir := buildExample(t, "user=test password=secret")
+	var prompts []string
+	newTok := "newsecret"
+	handler := pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+		prompts = append(prompts, msg)
+		switch {
+		case strings.HasPrefix(msg, "New"):
+			return "newsecret", nil
+		case strings.HasPrefix(msg, "Retype"):
+			return newTok, nil
+		}
+		return "secret", nil
+	})
+	tx, err := pam.StartConfDir("example", "test", handler, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.ChangeAuthTok(0); err != nil {
+		t.Fatalf("changeauthtok #error: %v", err)
+	}
+	if v := tx.GetEnv("EXAMPLE_AUTHTOK"); v != "newsecret" {
+		t.Fatalf("getenv #expected %q, got %q", "newsecret", v)
+	}
+	if len(prompts) != 4 {
+		t.Fatalf("conversation #unexpected prompts: %q", prompts)
+	}
+	newTok = "mismatch"
+	if err := tx.ChangeAuthTok(0); !errors.Is(err, pam.ErrTryAgain) {
+		t.Fatalf("changeauthtok #expected %v, got %v", pam.ErrTryAgain, err)
+	}
+}
+
+func TestData(t *testing.T) {
+	cleanup := filepath.Join(t.TempDir(), "cleanup")
+	dir := buildExample(t, "user=test cleanup="+cleanup)
+	tx, err := pam.StartConfDir("example", "test", nil, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.SetCred(pam.EstablishCred); !errors.Is(err, pam.ErrNoModuleData) {
+		t.Fatalf("setcred #expected %v, got %v", pam.ErrNoModuleData, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := tx.Authenticate(0); err != nil {
+			t.Fatalf("authenticate #error: %v", err)
+		}
+	}
+	if b, err := os.ReadFile(cleanup); err != nil || string(b) != fmt.Sprintf("0 %d", DataReplace) {
+		t.Fatalf("cleanupdata #error: %q, %v", b, err)
+	}
+	if err := tx.SetCred(pam.EstablishCred); err != nil {
+		t.Fatalf("setcred #error: %v", err)
+	}
+	if v := tx.GetEnv("EXAMPLE_DATA"); v != "test" {
+		t.Fatalf("getenv #expected %q, got %q", "test", v)
+	}
+	if err := tx.EndWithFlags(pam.DataSilent); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	if b, err := os.ReadFile(cleanup); err != nil || string(b) != fmt.Sprintf("0 %d", pam.DataSilent) {
+		t.Fatalf("cleanupdata #error: %q, %v", b, err)
+	}
+}
+
+func TestLogf(t *testing.T) {
+	if _, err := os.Stat("/dev/log"); !os.IsNotExist(err) {
+		t.Skipf("/dev/log is in use")
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: "/dev/log", Net: "unixgram"})
+	if err != nil {
+		t.Skipf("listen #error: %v", err)
+	}
+	defer os.Remove("/dev/log")
+	defer conn.Close()
+	dir := buildExample(t, "user=test log=")
+	tx, err := pam.StartConfDir("example", "test", nil, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	priority := fmt.Sprintf("<%d>", syslog.LOG_AUTHPRIV|syslog.LOG_NOTICE)
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read #error: %v", err)
+		}
+		msg := string(buf[:n])
+		if strings.HasSuffix(msg, "(example:auth): authenticated test") {
+			if !strings.HasPrefix(msg, priority) {
+				t.Fatalf("logf #unexpected priority: %q", msg)
+			}
+			break
+		}
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	dir := buildExample(t, "user=test code=1234")
+	var messages []string
+	code := "1234"
+	handler := pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+		messages = append(messages, s.String()+": "+msg)
+		return code, nil
+	})
+	tx, err := pam.StartConfDir("example", "test", handler, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	code = "0000"
+	if err := tx.Authenticate(0); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", pam.ErrAuth, err)
+	}
+	expected := []string{
+		pam.TextInfo.String() + ": Welcome test",
+		pam.PromptEchoOn.String() + ": Code: ",
+		pam.TextInfo.String() + ": Welcome test",
+		pam.PromptEchoOn.String() + ": Code: ",
+		pam.ErrorMsg.String() + ": Wrong code",
+	}
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("conversation #expected %q, got %q", expected, messages)
+	}
+}
+
+// binaryHandler replies to the binary prompts of the example module.
+type binaryHandler struct {
+	types []byte
+}
+
+func (h *binaryHandler) RespondPAM(s pam.Style, msg string) (string, error) {
+	return "", pam.ErrConv
+}
+
+func (h *binaryHandler) RespondPAMBinary(p pam.BinaryPointer) ([]byte, error) {
+	msgType, data, err := pam.BinaryDecode(p)
+	if err != nil {
+		return nil, err
+	}
+	h.types = append(h.types, msgType)
+	return pam.BinaryEncode(2, bytes.ToUpper(data))
+}
+
+func TestBinaryPrompt(t *testing.T) {
+	dir := buildExample(t, "user=test binary=ping")
+	h := &binaryHandler{}
+	tx, err := pam.StartConfDir("example", "test", h, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if string(h.types) != "\x01" {
+		t.Fatalf("conversation #unexpected types: %v", h.types)
+	}
+	tx2, err := pam.StartConfDir("example", "test", pam.ConversationFunc(h.RespondPAM), dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx2.End()
+	if err := tx2.Authenticate(0); !errors.Is(err, pam.ErrAuthinfoUnavail) {
+		t.Fatalf("authenticate #expected %v, got %v", pam.ErrAuthinfoUnavail, err)
+	}
+}
+
+func TestModutil(t *testing.T) {
+	u, err := user.Lookup("test")
+	if err != nil {
+		t.Skipf("lookup #error: %v", err)
+	}
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		t.Fatalf("lookupgroupid #error: %v", err)
+	}
+	tmp, err := os.MkdirTemp("", "modutil")
+	if err != nil {
+		t.Fatalf("mkdirtemp #error: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0o777); err != nil {
+		t.Fatalf("chmod #error: %v", err)
+	}
+	file := filepath.Join(tmp, "file")
+	dir := buildExample(t, "user=test group="+g.Name+" file="+file+" helper=/bin/true")
+	tx, err := pam.StartConfDir("example", "test", nil, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.AcctMgmt(0); err != nil {
+		t.Fatalf("acctmgmt #error: %v", err)
+	}
+	if v := tx.GetEnv("EXAMPLE_ACCOUNT"); v != u.Uid+":"+g.Gid {
+		t.Fatalf("getenv #expected %q, got %q", u.Uid+":"+g.Gid, v)
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("stat #error: %v", err)
+	}
+	if uid := fi.Sys().(*syscall.Stat_t).Uid; strconv.FormatUint(uint64(uid), 10) != u.Uid {
+		t.Fatalf("dropprivileges #expected owner %s, got %d", u.Uid, uid)
+	}
+	if os.Geteuid() != 0 {
+		t.Fatalf("regainprivileges #expected root, got %d", os.Geteuid())
+	}
+
+	dir = buildExample(t, "user=test group=root")
+	tx2, err := pam.StartConfDir("example", "test", nil, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx2.End()
+	if err := tx2.AcctMgmt(0); !errors.Is(err, pam.ErrPermDenied) {
+		t.Fatalf("acctmgmt #expected %v, got %v", pam.ErrPermDenied, err)
+	}
+	dir = buildExample(t, "user=test group="+g.Name+" helper=/bin/false")
+	tx3, err := pam.StartConfDir("example", "test", nil, dir)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx3.End()
+	if err := tx3.AcctMgmt(0); !errors.Is(err, pam.ErrSystem) {
+		t.Fatalf("acctmgmt #expected %v, got %v", pam.ErrSystem, err)
+	}
+}
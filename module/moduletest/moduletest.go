@@ -0,0 +1,53 @@
+// Package moduletest builds PAM modules written with the module package and
+// installs them in temporary PAM configurations, so that they can be
+// tested end to end by applications using pam.StartConfDir.
+package moduletest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Build builds the module of the main package pkg, a path as accepted by
+// go build, in a temporary directory removed when the test ends, and
+// returns the path of the shared object. The go command must be available.
+func Build(t testing.TB, pkg string) string {
+	t.Helper()
+	path, err := exec.LookPath("go")
+	if err != nil {
+		t.Skipf("moduletest: go command not found: %v", err)
+	}
+	so := filepath.Join(t.TempDir(), "pam_"+filepath.Base(pkg)+".so")
+	out, err := exec.Command(path, "build", "-buildmode=c-shared", "-o", so, pkg).CombinedOutput()
+	if err != nil {
+		t.Fatalf("moduletest: build %s #error: %v\n%s", pkg, err, out)
+	}
+	return so
+}
+
+// Service returns the PAM configuration of a service using only the module
+// so with args, for all the module types.
+func Service(so string, args ...string) string {
+	var b strings.Builder
+	for _, kind := range []string{"auth", "account", "password", "session"} {
+		b.WriteString(kind + " required " + strings.Join(append([]string{so}, args...), " ") + "\n")
+	}
+	return b.String()
+}
+
+// ConfDir writes the configurations of services, by name, in a temporary
+// directory removed when the test ends, and returns it to be given to
+// pam.StartConfDir.
+func ConfDir(t testing.TB, services map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, conf := range services {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(conf), 0o644); err != nil {
+			t.Fatalf("moduletest: writefile #error: %v", err)
+		}
+	}
+	return dir
+}
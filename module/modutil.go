@@ -0,0 +1,239 @@
+package module
+
+//#include <security/pam_modules.h>
+//#include <security/pam_modutil.h>
+//#include <stdlib.h>
+//
+//struct pam_modutil_privs *privs_new(void);
+//pid_t module_start_helper(pam_handle_t *pamh, const char *path, char **argv, char **envp, int in, int out, int err);
+import "C"
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/msteinert/pam"
+)
+
+// The lookups below use the pam_modutil functions, which cache the results
+// in the transaction and are safe to use from several modules. They are
+// Linux-PAM extensions.
+
+// LookupUser returns the account of the user name, as pam_modutil_getpwnam
+// does. It returns user.UnknownUserError if there is no such user.
+func (mt *ModuleTransaction) LookupUser(name string) (*user.User, error) {
+	if err := checkCString(name); err != nil {
+		return nil, &pam.OpError{Op: "pam_modutil_getpwnam", Args: name, Err: err}
+	}
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	pw := C.pam_modutil_getpwnam(mt.handle, cs)
+	if pw == nil {
+		return nil, user.UnknownUserError(name)
+	}
+	return goUser(pw), nil
+}
+
+// LookupUserID returns the account of the user uid, as
+// pam_modutil_getpwuid does. It returns user.UnknownUserIdError if there is
+// no such user.
+func (mt *ModuleTransaction) LookupUserID(uid int) (*user.User, error) {
+	pw := C.pam_modutil_getpwuid(mt.handle, C.uid_t(uid))
+	if pw == nil {
+		return nil, user.UnknownUserIdError(uid)
+	}
+	return goUser(pw), nil
+}
+
+// LookupGroup returns the group name, as pam_modutil_getgrnam does. It
+// returns user.UnknownGroupError if there is no such group.
+func (mt *ModuleTransaction) LookupGroup(name string) (*user.Group, error) {
+	if err := checkCString(name); err != nil {
+		return nil, &pam.OpError{Op: "pam_modutil_getgrnam", Args: name, Err: err}
+	}
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	gr := C.pam_modutil_getgrnam(mt.handle, cs)
+	if gr == nil {
+		return nil, user.UnknownGroupError(name)
+	}
+	return goGroup(gr), nil
+}
+
+// LookupGroupID returns the group gid, as pam_modutil_getgrgid does. It
+// returns user.UnknownGroupIdError if there is no such group.
+func (mt *ModuleTransaction) LookupGroupID(gid int) (*user.Group, error) {
+	gr := C.pam_modutil_getgrgid(mt.handle, C.gid_t(gid))
+	if gr == nil {
+		return nil, user.UnknownGroupIdError(strconv.Itoa(gid))
+	}
+	return goGroup(gr), nil
+}
+
+// UserInGroup returns whether the user name is a member of the group, as
+// its primary group or as a supplementary one, as
+// pam_modutil_user_in_group_nam_nam does.
+func (mt *ModuleTransaction) UserInGroup(name, group string) bool {
+	if checkCString(name) != nil || checkCString(group) != nil {
+		return false
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	cgroup := C.CString(group)
+	defer C.free(unsafe.Pointer(cgroup))
+	return C.pam_modutil_user_in_group_nam_nam(mt.handle, cname, cgroup) != 0
+}
+
+// Login returns the name of the user logged in on the terminal of the
+// process, as pam_modutil_getlogin does, or an empty string.
+func (mt *ModuleTransaction) Login() string {
+	return C.GoString(C.pam_modutil_getlogin(mt.handle))
+}
+
+// goUser converts pw.
+func goUser(pw *C.struct_passwd) *user.User {
+	return &user.User{
+		Uid:      strconv.FormatUint(uint64(pw.pw_uid), 10),
+		Gid:      strconv.FormatUint(uint64(pw.pw_gid), 10),
+		Username: C.GoString(pw.pw_name),
+		Name:     strings.SplitN(C.GoString(pw.pw_gecos), ",", 2)[0],
+		HomeDir:  C.GoString(pw.pw_dir),
+	}
+}
+
+// goGroup converts gr.
+func goGroup(gr *C.struct_group) *user.Group {
+	return &user.Group{
+		Gid:  strconv.FormatUint(uint64(gr.gr_gid), 10),
+		Name: C.GoString(gr.gr_name),
+	}
+}
+
+// Privileges are the privileges saved by DropPrivileges, to be restored by
+// RegainPrivileges.
+type Privileges struct {
+	p *C.struct_pam_modutil_privs
+}
+
+// DropPrivileges switches the file system identity and the supplementary
+// groups to the ones of the user name, as pam_modutil_drop_priv does, so
+// that the module accesses the files of the user, such as the ones in its
+// home directory, with its permissions. RegainPrivileges must be called
+// before returning from the module.
+//
+// The file system identity is the one of the thread, only the goroutine
+// running the ModuleHandler method, which runs on the thread that called
+// the module, gets the one of the user. The supplementary groups are
+// changed for the whole process though, glibc applying setgroups to all
+// the threads, including the ones of the application. The handler must not
+// start goroutines accessing files while the privileges are dropped: they
+// would run on other threads, with the file system identity of the process
+// and the groups of the user.
+func (mt *ModuleTransaction) DropPrivileges(name string) (*Privileges, error) {
+	if err := checkCString(name); err != nil {
+		return nil, &pam.OpError{Op: "pam_modutil_drop_priv", Args: name, Err: err}
+	}
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	pw := C.pam_modutil_getpwnam(mt.handle, cs)
+	if pw == nil {
+		return nil, user.UnknownUserError(name)
+	}
+	p := C.privs_new()
+	if p == nil {
+		return nil, &pam.OpError{Op: "pam_modutil_drop_priv", Args: name, Err: pam.ErrBuf}
+	}
+	if C.pam_modutil_drop_priv(mt.handle, p, pw) != 0 {
+		C.free(unsafe.Pointer(p))
+		return nil, &pam.OpError{Op: "pam_modutil_drop_priv", Args: name, Err: pam.ErrSystem}
+	}
+	return &Privileges{p: p}, nil
+}
+
+// RegainPrivileges restores the privileges saved by DropPrivileges, as
+// pam_modutil_regain_priv does.
+func (mt *ModuleTransaction) RegainPrivileges(p *Privileges) error {
+	if p == nil || p.p == nil {
+		return &pam.OpError{Op: "pam_modutil_regain_priv", Err: pam.ErrInvalidArgument}
+	}
+	defer func() {
+		C.free(unsafe.Pointer(p.p))
+		p.p = nil
+	}()
+	if C.pam_modutil_regain_priv(mt.handle, p.p) != 0 {
+		return &pam.OpError{Op: "pam_modutil_regain_priv", Err: pam.ErrSystem}
+	}
+	return nil
+}
+
+// Redirect tells StartHelper what to do with a standard descriptor of the
+// helper.
+type Redirect int
+
+// Redirections of the standard descriptors.
+const (
+	// IgnoreFD leaves the descriptor as is.
+	IgnoreFD Redirect = C.PAM_MODUTIL_IGNORE_FD
+	// PipeFD redirects the descriptor to a pipe whose other end is
+	// closed: reading gets end of file, writing fails.
+	PipeFD Redirect = C.PAM_MODUTIL_PIPE_FD
+	// NullFD redirects the descriptor to /dev/null.
+	NullFD Redirect = C.PAM_MODUTIL_NULL_FD
+)
+
+// StartHelper starts the helper program path with args, including the
+// program name, and env, or the environment of the process if env is nil,
+// as C modules do to run helpers such as unix_chkpwd: in the child process
+// pam_modutil_sanitize_helper_fds redirects the standard descriptors and
+// closes all the other ones, which Go can not do in a forked process, so
+// that the descriptors of the application do not leak into the helper.
+func (mt *ModuleTransaction) StartHelper(path string, args, env []string, stdin, stdout, stderr Redirect) (*os.Process, error) {
+	for _, s := range append(append([]string{path}, args...), env...) {
+		if err := checkCString(s); err != nil {
+			return nil, &pam.OpError{Op: "pam_modutil_sanitize_helper_fds", Args: path, Err: err}
+		}
+	}
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	cargs := cStrings(args)
+	defer freeCStrings(cargs)
+	var cenv **C.char
+	if env != nil {
+		cenv = cStrings(env)
+		defer freeCStrings(cenv)
+	}
+	// Hold ForkLock as os/exec does, so that no descriptor is being
+	// created by another goroutine while the process forks.
+	syscall.ForkLock.Lock()
+	pid, err := C.module_start_helper(mt.handle, cpath, cargs, cenv,
+		C.int(stdin), C.int(stdout), C.int(stderr))
+	syscall.ForkLock.Unlock()
+	if pid < 0 {
+		return nil, &os.PathError{Op: "fork", Path: path, Err: err}
+	}
+	return os.FindProcess(int(pid))
+}
+
+// cStrings returns a NULL terminated array of copies of list, allocated
+// with malloc.
+func cStrings(list []string) **C.char {
+	n := len(list) + 1
+	p := (**C.char)(C.calloc(C.size_t(n), C.size_t(unsafe.Sizeof((*C.char)(nil)))))
+	a := unsafe.Slice(p, n)
+	for i, s := range list {
+		a[i] = C.CString(s)
+	}
+	return p
+}
+
+// freeCStrings releases an array returned by cStrings.
+func freeCStrings(p **C.char) {
+	for a := p; *a != nil; a = (**C.char)(unsafe.Add(unsafe.Pointer(a), unsafe.Sizeof(*a))) {
+		C.free(unsafe.Pointer(*a))
+	}
+	C.free(unsafe.Pointer(p))
+}
@@ -0,0 +1,54 @@
+package module
+
+//#include <security/pam_modules.h>
+//#include <stdlib.h>
+//#include <string.h>
+//
+//int module_prompt(pam_handle_t *pamh, int style, char **response, const char *msg);
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/msteinert/pam"
+)
+
+// Prompt sends text to the application through its conversation function
+// with style, as pam_prompt does, and returns the response. The C copy of
+// the response is wiped. Linux-PAM extension.
+func (mt *ModuleTransaction) Prompt(style pam.Style, text string) (string, error) {
+	var resp *C.char
+	if err := mt.prompt(style, text, &resp); err != nil {
+		return "", err
+	}
+	if resp == nil {
+		return "", nil
+	}
+	defer func() {
+		C.memset(unsafe.Pointer(resp), 0, C.strlen(resp))
+		C.free(unsafe.Pointer(resp))
+	}()
+	return C.GoString(resp), nil
+}
+
+// Error shows an error message to the user, as pam_error does. Linux-PAM
+// extension.
+func (mt *ModuleTransaction) Error(text string) error {
+	return mt.prompt(pam.ErrorMsg, text, nil)
+}
+
+// Info shows an informative message to the user, as pam_info does.
+// Linux-PAM extension.
+func (mt *ModuleTransaction) Info(text string) error {
+	return mt.prompt(pam.TextInfo, text, nil)
+}
+
+// prompt sends text with style, storing the response in resp if not nil.
+func (mt *ModuleTransaction) prompt(style pam.Style, text string, resp **C.char) error {
+	if err := checkCString(text); err != nil {
+		return &pam.OpError{Op: "pam_prompt", Args: style.String(), Err: err}
+	}
+	cs := C.CString(text)
+	defer C.free(unsafe.Pointer(cs))
+	return opError(C.module_prompt(mt.handle, C.int(style), resp, cs), "pam_prompt", style)
+}
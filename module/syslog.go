@@ -0,0 +1,26 @@
+package module
+
+//#include <security/pam_modules.h>
+//#include <stdlib.h>
+//
+//void module_syslog(pam_handle_t *pamh, int priority, const char *msg);
+import "C"
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+	"unsafe"
+)
+
+// Logf logs a message formatted with fmt.Sprintf, as pam_syslog does: it
+// is prefixed with the name of the module, the service and the operation
+// being run, such as "pam_example(login:auth): ", and logged with the
+// LOG_AUTHPRIV facility unless priority has another one. Linux-PAM
+// extension.
+func (mt *ModuleTransaction) Logf(priority syslog.Priority, format string, args ...any) {
+	msg := strings.ReplaceAll(fmt.Sprintf(format, args...), "\x00", "")
+	cs := C.CString(msg)
+	defer C.free(unsafe.Pointer(cs))
+	C.module_syslog(mt.handle, C.int(priority), cs)
+}
@@ -0,0 +1,200 @@
+// Command example is the module used by the tests of the module package.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/syslog"
+	"os"
+	"strings"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/module"
+)
+
+type handler struct{}
+
+// data is stored by Authenticate for SetCred.
+type data struct {
+	user    string
+	cleanup string
+}
+
+func (d *data) CleanupData(status pam.Error, flags pam.Flags) {
+	if d.cleanup != "" {
+		os.WriteFile(d.cleanup, []byte(fmt.Sprintf("%d %d", status, flags)), 0o644)
+	}
+}
+
+// arg returns the value of the argument name=value in args.
+func arg(args []string, name string) (string, bool) {
+	for _, a := range args {
+		if v, ok := strings.CutPrefix(a, name+"="); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (handler) Authenticate(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	user, err := mt.GetUser("")
+	if err != nil {
+		return err
+	}
+	if expected, _ := arg(args, "user"); user != expected {
+		return pam.ErrUserUnknown
+	}
+	if _, err := mt.GetItem(pam.XAuthData); !errors.Is(err, pam.ErrInvalidArgument) {
+		return pam.ErrSystem
+	}
+	if rhost, err := mt.GetItem(pam.Rhost); err != nil {
+		return err
+	} else if rhost != "" {
+		if err := mt.SetItem(pam.Ruser, user+"@"+rhost); err != nil {
+			return err
+		}
+	}
+	if password, ok := arg(args, "password"); ok {
+		tok, err := mt.GetAuthTok(pam.Authtok, "")
+		if err != nil {
+			return err
+		}
+		if tok != password {
+			return pam.ErrAuth
+		}
+	}
+	if code, ok := arg(args, "code"); ok {
+		if err := mt.Info("Welcome " + user); err != nil {
+			return err
+		}
+		resp, err := mt.Prompt(pam.PromptEchoOn, "Code: ")
+		if err != nil {
+			return err
+		}
+		if resp != code {
+			mt.Error("Wrong code")
+			return pam.ErrAuth
+		}
+	}
+	if ping, ok := arg(args, "binary"); ok {
+		pong, err := mt.BinaryPrompt(1, []byte(ping))
+		if err != nil {
+			return err
+		}
+		if string(pong) != strings.ToUpper(ping) {
+			return pam.ErrAuth
+		}
+	}
+	if _, ok := arg(args, "log"); ok {
+		mt.Logf(syslog.LOG_NOTICE, "authenticated %s", user)
+	}
+	cleanup, _ := arg(args, "cleanup")
+	if err := mt.SetData("example", &data{user: user, cleanup: cleanup}); err != nil {
+		return err
+	}
+	return mt.PutEnv("EXAMPLE_FLAGS=" + flags.String())
+}
+
+func (handler) SetCred(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	v, err := mt.GetData("example")
+	if err != nil {
+		return err
+	}
+	if in, ok := mt.LookupEnv("EXAMPLE_IN"); ok {
+		if err := mt.PutEnv("EXAMPLE_OUT=" + strings.ToUpper(in)); err != nil {
+			return err
+		}
+	}
+	return mt.PutEnv("EXAMPLE_DATA=" + v.(*data).user)
+}
+
+func (handler) AcctMgmt(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	group, ok := arg(args, "group")
+	if !ok {
+		return errors.New("not a PAM error")
+	}
+	user, err := mt.GetUser("")
+	if err != nil {
+		return err
+	}
+	if !mt.UserInGroup(user, group) {
+		return pam.ErrPermDenied
+	}
+	u, err := mt.LookupUser(user)
+	if err != nil {
+		return pam.ErrUserUnknown
+	}
+	g, err := mt.LookupGroup(group)
+	if err != nil {
+		return pam.ErrSystem
+	}
+	if file, ok := arg(args, "file"); ok {
+		p, err := mt.DropPrivileges(user)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(file, nil, 0o600)
+		if err := mt.RegainPrivileges(p); err != nil {
+			return err
+		}
+		if err != nil {
+			return pam.ErrPermDenied
+		}
+	}
+	if helper, ok := arg(args, "helper"); ok {
+		proc, err := mt.StartHelper(helper, []string{helper}, nil, module.PipeFD, module.NullFD, module.NullFD)
+		if err != nil {
+			return err
+		}
+		state, err := proc.Wait()
+		if err != nil || !state.Success() {
+			return pam.ErrSystem
+		}
+	}
+	return mt.PutEnv("EXAMPLE_ACCOUNT=" + u.Uid + ":" + g.Gid)
+}
+
+func (handler) OpenSession(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	if _, ok := arg(args, "panic"); ok {
+		panic("open session")
+	}
+	return nil
+}
+
+func (handler) CloseSession(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	return mt.SetItem(pam.Rhost, "closed")
+}
+
+func (handler) ChangeAuthTok(mt *module.ModuleTransaction, flags pam.Flags, args []string) error {
+	password, ok := arg(args, "password")
+	if flags&module.PrelimCheck != 0 {
+		if !ok {
+			return nil
+		}
+		old, err := mt.GetAuthTok(pam.Oldauthtok, "")
+		if err != nil {
+			return err
+		}
+		if old != password {
+			return pam.ErrAuth
+		}
+		return nil
+	}
+	if !ok {
+		return pam.ErrAuthTokLockBusy
+	}
+	tok, err := mt.GetAuthTokNoVerify("")
+	if err != nil {
+		return err
+	}
+	if _, err := mt.GetAuthTokVerify(tok, ""); err != nil {
+		return err
+	}
+	return mt.PutEnv("EXAMPLE_AUTHTOK=" + tok)
+}
+
+func init() {
+	module.Register(handler{})
+}
+
+func main() {}
@@ -0,0 +1,127 @@
+package module
+
+//#cgo CFLAGS: -Wall -std=c99
+//#cgo LDFLAGS: -lpam
+//
+//#include <security/pam_modules.h>
+//#include <security/pam_appl.h>
+//#include <stdlib.h>
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/msteinert/pam"
+)
+
+// ModuleTransaction is the PAM transaction seen by a module, it is bound
+// to the handle passed to the entry point and is only valid during the
+// call of the ModuleHandler method it is given to.
+type ModuleTransaction struct {
+	handle *C.pam_handle_t
+}
+
+// opError returns the error reporting status for the operation op, nil on
+// success.
+func opError(status C.int, op string, args ...any) error {
+	if status == C.PAM_SUCCESS {
+		return nil
+	}
+	var desc []string
+	for _, a := range args {
+		desc = append(desc, fmt.Sprint(a))
+	}
+	return &pam.OpError{Op: op, Args: strings.Join(desc, ", "), Err: pam.Error(status)}
+}
+
+// checkCString returns pam.ErrInvalidArgument if s can not be passed to C.
+func checkCString(s string) error {
+	if strings.IndexByte(s, 0) >= 0 {
+		return pam.ErrInvalidArgument
+	}
+	return nil
+}
+
+// GetItem retrieves a PAM information item. Unlike applications, modules
+// can read the Authtok and Oldauthtok items.
+func (mt *ModuleTransaction) GetItem(i pam.Item) (string, error) {
+	if i == pam.XAuthData {
+		return "", &pam.OpError{Op: "pam_get_item", Args: i.String(), Err: pam.ErrInvalidArgument}
+	}
+	var s unsafe.Pointer
+	if err := opError(C.pam_get_item(mt.handle, C.int(i), &s), "pam_get_item", i); err != nil {
+		return "", err
+	}
+	return C.GoString((*C.char)(s)), nil
+}
+
+// SetItem sets a PAM information item. Unlike applications, modules can set
+// the Authtok and Oldauthtok items.
+func (mt *ModuleTransaction) SetItem(i pam.Item, item string) error {
+	if i == pam.XAuthData {
+		return &pam.OpError{Op: "pam_set_item", Args: i.String(), Err: pam.ErrInvalidArgument}
+	}
+	if err := checkCString(item); err != nil {
+		return &pam.OpError{Op: "pam_set_item", Args: fmt.Sprint(i), Err: err}
+	}
+	cs := unsafe.Pointer(C.CString(item))
+	defer C.free(cs)
+	return opError(C.pam_set_item(mt.handle, C.int(i), cs), "pam_set_item", i)
+}
+
+// GetUser returns the user name of the transaction, prompting for it
+// through the conversation of the application if it has not been set yet,
+// as pam_get_user does. If prompt is empty, the UserPrompt item or the PAM
+// default prompt is used.
+func (mt *ModuleTransaction) GetUser(prompt string) (string, error) {
+	if err := checkCString(prompt); err != nil {
+		return "", &pam.OpError{Op: "pam_get_user", Err: err}
+	}
+	var p *C.char
+	if prompt != "" {
+		p = C.CString(prompt)
+		defer C.free(unsafe.Pointer(p))
+	}
+	var user *C.char
+	if err := opError(C.pam_get_user(mt.handle, &user, p), "pam_get_user"); err != nil {
+		return "", err
+	}
+	return C.GoString(user), nil
+}
+
+// PutEnv adds or changes the value of a PAM environment variable, as
+// PutEnv of pam.Transaction does.
+func (mt *ModuleTransaction) PutEnv(nameval string) error {
+	if err := checkCString(nameval); err != nil {
+		return &pam.OpError{Op: "pam_putenv", Err: err}
+	}
+	cs := C.CString(nameval)
+	defer C.free(unsafe.Pointer(cs))
+	return opError(C.pam_putenv(mt.handle, cs), "pam_putenv",
+		strings.SplitN(nameval, "=", 2)[0])
+}
+
+// LookupEnv retrieves a PAM environment variable. If the variable is set the
+// value, which may be empty, is returned and the boolean is true, otherwise
+// the boolean is false.
+func (mt *ModuleTransaction) LookupEnv(name string) (string, bool) {
+	if checkCString(name) != nil {
+		return "", false
+	}
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	value := C.pam_getenv(mt.handle, cs)
+	if value == nil {
+		return "", false
+	}
+	return C.GoString(value), true
+}
+
+// GetEnv retrieves a PAM environment variable, it returns an empty string
+// if the variable is not set.
+func (mt *ModuleTransaction) GetEnv(name string) string {
+	value, _ := mt.LookupEnv(name)
+	return value
+}
@@ -0,0 +1,74 @@
+package pam
+
+//#include <security/pam_appl.h>
+//#include <stdint.h>
+//
+//void init_pam_conv(struct pam_conv *conv, uintptr_t);
+//
+//static inline pam_handle_t *pam_handle_from_uintptr(uintptr_t handle)
+//{
+//	return (pam_handle_t *)handle;
+//}
+import "C"
+
+import (
+	"runtime/cgo"
+	"unsafe"
+)
+
+// FromNativeHandle wraps an existing pam_handle_t, such as one created by C
+// code sharing the process, into a Transaction. No pam_start is performed
+// and no finalizer is installed: the handle remains owned by its creator,
+// that is responsible for calling pam_end on it. End releases the Go
+// resources of the transaction only.
+//
+// The conversation of the handle is kept until SetConversationHandler is
+// used; in that case the previous one is restored by End.
+func FromNativeHandle(handle uintptr) (*Transaction, error) {
+	if handle == 0 {
+		return nil, &OpError{Op: "pam_start", Err: ErrInvalidArgument}
+	}
+	return &Transaction{
+		handle: C.pam_handle_from_uintptr(C.uintptr_t(handle)),
+		native: true,
+	}, nil
+}
+
+// NativeHandle returns the underlying pam_handle_t of the transaction, so
+// that it can be shared with C code. It is zero once the transaction has
+// ended.
+func (t *Transaction) NativeHandle() uintptr {
+	return uintptr(unsafe.Pointer(t.handle))
+}
+
+// installConversation sets up the conversation of a transaction that has no
+// Go conversation yet, saving the current one to be restored by End.
+func (t *Transaction) installConversation(handler ConversationHandler) error {
+	var prev unsafe.Pointer
+	status := t.run(func() C.int {
+		return C.pam_get_item(t.handle, C.PAM_CONV, &prev)
+	})
+	if status != C.PAM_SUCCESS {
+		return t.handlePamStatus(status, "pam_get_item", "PAM_CONV")
+	}
+	// PAM releases the current conversation when replacing it.
+	var saved *C.struct_pam_conv
+	if prev != nil {
+		copied := *(*C.struct_pam_conv)(prev)
+		saved = &copied
+	}
+	state := newConversation(nil, handler)
+	state.appData = t.AppData()
+	c := cgo.NewHandle(state)
+	conv := &C.struct_pam_conv{}
+	C.init_pam_conv(conv, C.uintptr_t(c))
+	err := t.handlePamStatus(t.run(func() C.int {
+		return C.pam_set_item(t.handle, C.PAM_CONV, unsafe.Pointer(conv))
+	}), "pam_set_item", "PAM_CONV")
+	if err != nil {
+		c.Delete()
+		return err
+	}
+	t.state, t.c, t.conv, t.nativeConv = state, c, conv, saved
+	return nil
+}
@@ -0,0 +1,114 @@
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"testing"
+)
+
+func TestFromNativeHandle(t *testing.T) {
+	_, err := FromNativeHandle(0)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("fromnativehandle #expected %v, got %v", ErrInvalidArgument, err)
+	}
+
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	native, err := FromNativeHandle(tx.NativeHandle())
+	if err != nil {
+		t.Fatalf("fromnativehandle #error: %v", err)
+	}
+	s, err := native.GetItem(User)
+	if err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+	if s != "test" {
+		t.Fatalf("getitem #error: expected test, got %v", s)
+	}
+	err = native.End()
+	if err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	if native.NativeHandle() != 0 {
+		t.Fatalf("nativehandle #error: expected 0 after end")
+	}
+	// The original transaction is still usable.
+	s, err = tx.GetItem(Service)
+	if err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+	if s != "passwd" {
+		t.Fatalf("getitem #error: expected passwd, got %v", s)
+	}
+}
+
+func TestFromNativeHandle_SetConversationHandler(t *testing.T) {
+	u, _ := user.Current()
+	var messages []string
+	handler := func(prefix string) ConversationHandler {
+		return ConversationFunc(func(s Style, msg string) (string, error) {
+			messages = append(messages, prefix+msg)
+			return "", nil
+		})
+	}
+	tx, err := StartConfDir("echo-service", u.Username, handler("tx: "), "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	native, err := FromNativeHandle(tx.NativeHandle())
+	if err != nil {
+		t.Fatalf("fromnativehandle #error: %v", err)
+	}
+	err = native.SetConversationHandler(handler("native: "))
+	if err != nil {
+		t.Fatalf("setconversationhandler #error: %v", err)
+	}
+	err = native.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	err = native.End()
+	if err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	// The original conversation has been restored.
+	err = tx.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	msg := "This is an info message for user " + u.Username + " on echo-service"
+	if len(messages) != 2 || messages[0] != "native: "+msg || messages[1] != "tx: "+msg {
+		t.Fatalf("conversation #unexpected messages: %v", messages)
+	}
+}
+
+func TestFromNativeHandle_Unused(t *testing.T) {
+	u, _ := user.Current()
+	tx, err := StartConfDir("permit-service", u.Username, nil, "test-services")
+	if !CheckPamHasStartConfdir() {
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	native, _ := FromNativeHandle(tx.NativeHandle())
+	if err := native.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.End(); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+}
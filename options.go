@@ -0,0 +1,227 @@
+package pam
+
+import (
+	"context"
+	"time"
+)
+
+// StartOption configures a transaction started with StartWithOptions.
+type StartOption func(*startOptions)
+
+// startOptions holds the configuration of a transaction being started.
+type startOptions struct {
+	noFinalizer bool
+	confDir     string
+	items       []startItem
+	endFlags    Flags
+	ctx         context.Context
+	convTimeout time.Duration
+	deadline    time.Time
+	// lockOSThread pins the transaction to a dedicated thread.
+	lockOSThread bool
+	// checkConcurrent detects the concurrent use of the transaction.
+	checkConcurrent bool
+	watchdog        time.Duration
+	watchdogReport  WatchdogFunc
+	abandonAfter    time.Duration
+	// historyLimit is the size of the history, see WithHistoryLimit.
+	historyLimit int
+}
+
+// startItem is an item to set once the transaction is started.
+type startItem struct {
+	item  Item
+	value string
+}
+
+// WithoutFinalizer disables the finalizer that ends the transaction when it
+// is garbage collected. The application is then responsible for calling End,
+// this is useful to manage the transaction lifetime deterministically or
+// when its handle is shared with other C code.
+func WithoutFinalizer() StartOption {
+	return func(o *startOptions) {
+		o.noFinalizer = true
+	}
+}
+
+// WithConfDir defines the directory where the PAM services are defined,
+// this is mostly used to provide custom paths for tests. It requires
+// pam_start_confdir, see CheckPamHasStartConfdir.
+func WithConfDir(confDir string) StartOption {
+	return func(o *startOptions) {
+		o.confDir = confDir
+	}
+}
+
+// WithItem sets the PAM item i to value when the transaction is started.
+func WithItem(i Item, value string) StartOption {
+	return func(o *startOptions) {
+		o.items = append(o.items, startItem{i, value})
+	}
+}
+
+// WithTTY sets the terminal name when the transaction is started.
+func WithTTY(tty string) StartOption {
+	return WithItem(Tty, tty)
+}
+
+// WithRHost sets the requesting host name when the transaction is started.
+func WithRHost(rhost string) StartOption {
+	return WithItem(Rhost, rhost)
+}
+
+// WithRUser sets the requesting user name when the transaction is started.
+func WithRUser(ruser string) StartOption {
+	return WithItem(Ruser, ruser)
+}
+
+// WithEndFlags defines the flags used by End when the transaction is
+// terminated, see EndWithFlags for the valid flags.
+func WithEndFlags(f Flags) StartOption {
+	return func(o *startOptions) {
+		o.endFlags = f
+	}
+}
+
+// WithContext defines the context passed to the ContextConversationHandler
+// of the transaction. Once ctx is done the conversations fail with ErrConv.
+func WithContext(ctx context.Context) StartOption {
+	return func(o *startOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithConversationTimeout makes each conversation fail with ErrConv if the
+// handler does not respond within d, so that a module prompting unexpectedly
+// does not block the application forever. The handler keeps running in the
+// background until it returns, a ContextConversationHandler has its context
+// canceled, see CancelConversation.
+func WithConversationTimeout(d time.Duration) StartOption {
+	return func(o *startOptions) {
+		o.convTimeout = d
+	}
+}
+
+// WithDeadline makes any conversation fail with ErrConv once the deadline
+// is reached, so that the whole transaction is bounded in time.
+func WithDeadline(deadline time.Time) StartOption {
+	return func(o *startOptions) {
+		o.deadline = deadline
+	}
+}
+
+// WithLockedOSThread pins the transaction to a dedicated OS thread: all the
+// libpam calls, from pam_start to pam_end, are proxied to a goroutine locked
+// to it. Some modules keep per-thread state or change the credentials of the
+// calling thread, they then see every call coming from the same thread.
+// The thread is destroyed when the transaction ends.
+func WithLockedOSThread() StartOption {
+	return func(o *startOptions) {
+		o.lockOSThread = true
+	}
+}
+
+// WithConcurrentUseCheck makes the transaction panic with ErrConcurrentUse
+// when a goroutine calls into it while another one is in a libpam call,
+// instead of waiting for the call to complete. This helps finding the
+// code sharing a transaction by mistake. The handlers can still use the
+// transaction while libpam waits for them, but only from the goroutine they
+// are called on.
+func WithConcurrentUseCheck() StartOption {
+	return func(o *startOptions) {
+		o.checkConcurrent = true
+	}
+}
+
+// WithHistoryLimit makes History keep the last n calls instead of
+// DefaultHistoryLimit, n <= 0 disables the history.
+func WithHistoryLimit(n int) StartOption {
+	return func(o *startOptions) {
+		if n <= 0 {
+			n = -1
+		}
+		o.historyLimit = n
+	}
+}
+
+// StartWithOptions initiates a new PAM transaction configured by opts.
+// Service is treated identically to how pam_start treats it internally.
+//
+// The items requested by the options are set right after the transaction
+// is started: if any of them can not be set, the transaction is ended and
+// the error is returned, so that the application never deals with a
+// partially configured transaction.
+func StartWithOptions(service, user string, handler ConversationHandler, opts ...StartOption) (*Transaction, error) {
+	var o startOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return start(service, user, handler, &o)
+}
+
+// Config describes a PAM transaction to be created by New.
+type Config struct {
+	// Service is the name of the PAM service.
+	Service string
+	// User is the user name, it can be empty if the modules have to ask
+	// for it.
+	User string
+	// ConfDir is the directory where the PAM services are defined, if
+	// empty the system default is used.
+	ConfDir string
+	// Tty is the terminal name.
+	Tty string
+	// Rhost is the requesting host name.
+	Rhost string
+	// Ruser is the requesting user name.
+	Ruser string
+	// Handler is the conversation handler, it can be nil.
+	Handler ConversationHandler
+	// Flags are the flags used by End, see EndWithFlags.
+	Flags Flags
+	// Context is passed to the conversation handler, see WithContext.
+	Context context.Context
+	// ConversationTimeout is the time allowed to the conversation handler
+	// to respond, if non-zero, see WithConversationTimeout.
+	ConversationTimeout time.Duration
+	// Deadline is the time after which the conversations fail, if non-zero,
+	// see WithDeadline.
+	Deadline time.Time
+	// LockOSThread pins the transaction to a dedicated OS thread, see
+	// WithLockedOSThread.
+	LockOSThread bool
+}
+
+// New initiates a new PAM transaction as described by the configuration.
+// Only the non-empty items are set.
+func New(c Config) (*Transaction, error) {
+	var opts []StartOption
+	if c.ConfDir != "" {
+		opts = append(opts, WithConfDir(c.ConfDir))
+	}
+	if c.Tty != "" {
+		opts = append(opts, WithTTY(c.Tty))
+	}
+	if c.Rhost != "" {
+		opts = append(opts, WithRHost(c.Rhost))
+	}
+	if c.Ruser != "" {
+		opts = append(opts, WithRUser(c.Ruser))
+	}
+	if c.Flags != 0 {
+		opts = append(opts, WithEndFlags(c.Flags))
+	}
+	if c.Context != nil {
+		opts = append(opts, WithContext(c.Context))
+	}
+	if c.ConversationTimeout != 0 {
+		opts = append(opts, WithConversationTimeout(c.ConversationTimeout))
+	}
+	if !c.Deadline.IsZero() {
+		opts = append(opts, WithDeadline(c.Deadline))
+	}
+	if c.LockOSThread {
+		opts = append(opts, WithLockedOSThread())
+	}
+	return StartWithOptions(c.Service, c.User, c.Handler, opts...)
+}
@@ -0,0 +1,210 @@
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStartWithoutFinalizer(t *testing.T) {
+	tx, err := StartWithOptions("", "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			return "", nil
+		}), WithoutFinalizer())
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	s, err := tx.GetItem(Service)
+	if err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+	if s != "" {
+		t.Fatalf("getitem #error: expected empty service, got %v", s)
+	}
+	err = tx.End()
+	if err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+}
+
+func TestStartWithItems(t *testing.T) {
+	tx, err := StartWithOptions("passwd", "test", nil,
+		WithTTY("tty1"), WithRHost("host.example.com"), WithRUser("admin"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	for i, expected := range map[Item]string{
+		Service: "passwd",
+		User:    "test",
+		Tty:     "tty1",
+		Rhost:   "host.example.com",
+		Ruser:   "admin",
+	} {
+		s, err := tx.GetItem(i)
+		if err != nil {
+			t.Fatalf("getitem #error: %v", err)
+		}
+		if s != expected {
+			t.Fatalf("getitem #error: expected %v, got %v", expected, s)
+		}
+	}
+}
+
+func TestStartWithInvalidItem(t *testing.T) {
+	_, err := StartWithOptions("passwd", "test", nil,
+		WithTTY("tty1"), WithItem(Item(-1), "invalid"))
+	if !errors.Is(err, ErrBadItem) {
+		t.Fatalf("start #expected %v, got %v", ErrBadItem, err)
+	}
+}
+
+func TestStartWithConfDir(t *testing.T) {
+	u, _ := user.Current()
+	tx, err := StartWithOptions("permit-service", u.Username, nil,
+		WithConfDir("test-services"), WithRHost("localhost"))
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	u, _ := user.Current()
+	tx, err := New(Config{
+		Service: "permit-service",
+		User:    u.Username,
+		ConfDir: "test-services",
+		Tty:     "tty1",
+		Flags:   DataSilent,
+	})
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("new #error: %v", err)
+	}
+	s, err := tx.GetItem(Tty)
+	if err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+	if s != "tty1" {
+		t.Fatalf("getitem #error: expected tty1, got %v", s)
+	}
+	err = tx.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	err = tx.End()
+	if err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	h := tx.History()
+	if last := h[len(h)-1]; last.Op != "pam_end" || last.Flags != DataSilent {
+		t.Fatalf("history #error: unexpected entry %v", last)
+	}
+}
+
+func TestWithConversationTimeout(t *testing.T) {
+	h := NewChannelHandler()
+	tx, err := StartWithOptions("succeed-if-user-test", "", h,
+		WithConfDir("test-services"), WithConversationTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	start := time.Now()
+	if err := tx.Authenticate(0); !errors.Is(err, ErrConv) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrConv, err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("authenticate #error: timeout not enforced, took %v", d)
+	}
+	// The handler must have given up instead of waiting to send the prompt.
+	select {
+	case m := <-h.Messages:
+		t.Fatalf("channelhandler #unexpected pending message: %v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWithDeadline(t *testing.T) {
+	h := ConversationFunc(func(s Style, msg string) (string, error) {
+		return "testuser", nil
+	})
+	tx, err := New(Config{Service: "succeed-if-user-test", ConfDir: "test-services",
+		Handler: h, Deadline: time.Now().Add(-time.Second)})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); !errors.Is(err, ErrConv) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestWithLockedOSThread(t *testing.T) {
+	var tx *Transaction
+	var convTids []int
+	h := ConversationFunc(func(s Style, msg string) (string, error) {
+		// Calls performed while a conversation is active must not block,
+		// and run on the transaction thread.
+		if _, err := tx.GetItem(Service); err != nil {
+			return "", err
+		}
+		tx.do(func() {
+			convTids = append(convTids, syscall.Gettid())
+		})
+		return "", nil
+	})
+	tx, err := StartWithOptions("deny-service", "", h,
+		WithConfDir("test-services"), WithLockedOSThread())
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	var tids []int
+	err = tx.SetFailDelayHandler(func(status Error, delay time.Duration) {
+		tids = append(tids, syscall.Gettid())
+		if _, err := tx.GetItem(Service); err != nil {
+			t.Errorf("getitem #error: %v", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("setfaildelayhandler #error: %v", err)
+	}
+	if _, err := tx.GetUser(""); err != nil {
+		t.Fatalf("getuser #error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := tx.Authenticate(0); !errors.Is(err, ErrAuth) {
+			t.Fatalf("authenticate #expected %v, got %v", ErrAuth, err)
+		}
+		runtime.Gosched()
+	}
+	if len(tids) != 2 || tids[0] != tids[1] {
+		t.Fatalf("faildelay #unexpected threads: %v", tids)
+	}
+	if len(convTids) != 1 || convTids[0] != tids[0] {
+		t.Fatalf("conversation #unexpected threads: %v, %v", convTids, tids)
+	}
+	if err := tx.End(); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+}
@@ -0,0 +1,694 @@
+package pamtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// Call is a method call recorded by MockTransaction.
+type Call struct {
+	// Method is the name of the method, such as "Authenticate".
+	Method string
+	// Args are the arguments of the call. Authentication tokens are
+	// recorded as "<redacted>".
+	Args []any
+}
+
+// MockFunc implements an operation of MockTransaction, such as
+// Authenticate, it can converse with Converse and change the items and the
+// environment.
+type MockFunc func(m *MockTransaction, f pam.Flags) error
+
+// MockTransaction is a fake PAM transaction, implementing
+// pam.TransactionHandle, that does not need PAM nor root privileges. The
+// items and the environment are kept in maps, the operations succeed unless
+// programmed otherwise with Results or Funcs, and every call is recorded.
+//
+// The exported fields must be set before the transaction is used; its
+// methods can then be used from several goroutines.
+type MockTransaction struct {
+	// Items are the PAM items, set by SetItem and the like.
+	Items map[pam.Item]string
+	// Env is the PAM environment.
+	Env map[string]string
+	// Results are the errors returned by the successive calls of the
+	// methods, by method name: once they are consumed, Funcs is used.
+	Results map[string][]error
+	// Funcs implement the operations, by method name, such as
+	// "Authenticate" or "OpenSession". An operation without a result nor
+	// a function succeeds.
+	Funcs map[string]MockFunc
+	// Cred is returned by Credential if not nil, otherwise the User item
+	// is looked up.
+	Cred *syscall.Credential
+
+	mu        sync.Mutex
+	handler   pam.ConversationHandler
+	calls     []Call
+	history   []pam.HistoryEntry
+	status    pam.Error
+	ended     bool
+	appData   any
+	xauthName string
+	xauthData []byte
+}
+
+var _ pam.TransactionHandle = (*MockTransaction)(nil)
+
+// NewMockTransaction returns a mock transaction for service and user, using
+// handler for the conversations of the operations.
+func NewMockTransaction(service, user string, handler pam.ConversationHandler) *MockTransaction {
+	m := &MockTransaction{
+		Items:   map[pam.Item]string{pam.Service: service},
+		Env:     map[string]string{},
+		Results: map[string][]error{},
+		Funcs:   map[string]MockFunc{},
+		handler: handler,
+	}
+	if user != "" {
+		m.Items[pam.User] = user
+	}
+	return m
+}
+
+// Calls returns the calls made so far.
+func (m *MockTransaction) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// Called returns the number of calls of method.
+func (m *MockTransaction) Called(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, c := range m.calls {
+		if c.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// Ended returns whether End has been called.
+func (m *MockTransaction) Ended() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ended
+}
+
+// Converse sends a message to the conversation handler of the transaction,
+// as a module does. It fails with pam.ErrConv without a handler.
+func (m *MockTransaction) Converse(s pam.Style, msg string) (string, error) {
+	m.mu.Lock()
+	h := m.handler
+	m.mu.Unlock()
+	if h == nil {
+		return "", pam.ErrConv
+	}
+	return h.RespondPAM(s, msg)
+}
+
+// record records the call of method and returns the next programmed
+// result, with ErrTransactionClosed once the transaction has ended. It must
+// be called with m.mu held.
+func (m *MockTransaction) record(method, op string, args ...any) (error, bool) {
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+	if m.ended {
+		return &pam.OpError{Op: op, Err: pam.ErrTransactionClosed}, true
+	}
+	if results := m.Results[method]; len(results) > 0 {
+		m.Results[method] = results[1:]
+		return results[0], true
+	}
+	return nil, false
+}
+
+// call records a call that has no effect but its result.
+func (m *MockTransaction) call(method, op string, args ...any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err, _ := m.record(method, op, args...)
+	return err
+}
+
+// setStatus stores the status of the operation op reported by err.
+func (m *MockTransaction) setStatus(op string, f pam.Flags, err error) {
+	var status pam.Error
+	if err != nil && !errors.As(err, &status) {
+		status = pam.ErrSystem
+	}
+	m.status = status
+	m.history = append(m.history, pam.HistoryEntry{Op: op, Flags: f, Status: status})
+}
+
+// operation runs the operation method, the PAM function op.
+func (m *MockTransaction) operation(method, op string, f pam.Flags) error {
+	m.mu.Lock()
+	err, done := m.record(method, op, f)
+	fn := m.Funcs[method]
+	m.mu.Unlock()
+	if !done && fn != nil {
+		err = fn(m, f)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.ended {
+		m.setStatus(op, f, err)
+	}
+	return err
+}
+
+// contextOperation runs the operation method unless ctx is done.
+func (m *MockTransaction) contextOperation(ctx context.Context, method, op string, f pam.Flags) error {
+	if err := ctx.Err(); err != nil {
+		m.mu.Lock()
+		m.calls = append(m.calls, Call{Method: method + "Context", Args: []any{f}})
+		m.mu.Unlock()
+		return err
+	}
+	return m.operation(method, op, f)
+}
+
+// Authenticate records the call and runs the programmed operation.
+func (m *MockTransaction) Authenticate(f pam.Flags) error {
+	return m.operation("Authenticate", "pam_authenticate", f)
+}
+
+// SetCred records the call and runs the programmed operation.
+func (m *MockTransaction) SetCred(f pam.Flags) error {
+	return m.operation("SetCred", "pam_setcred", f)
+}
+
+// AcctMgmt records the call and runs the programmed operation.
+func (m *MockTransaction) AcctMgmt(f pam.Flags) error {
+	return m.operation("AcctMgmt", "pam_acct_mgmt", f)
+}
+
+// ChangeAuthTok records the call and runs the programmed operation.
+func (m *MockTransaction) ChangeAuthTok(f pam.Flags) error {
+	return m.operation("ChangeAuthTok", "pam_chauthtok", f)
+}
+
+// OpenSession records the call and runs the programmed operation.
+func (m *MockTransaction) OpenSession(f pam.Flags) error {
+	return m.operation("OpenSession", "pam_open_session", f)
+}
+
+// CloseSession records the call and runs the programmed operation.
+func (m *MockTransaction) CloseSession(f pam.Flags) error {
+	return m.operation("CloseSession", "pam_close_session", f)
+}
+
+// AuthenticateContext is Authenticate, returning the error of ctx if it is
+// already done.
+func (m *MockTransaction) AuthenticateContext(ctx context.Context, f pam.Flags) error {
+	return m.contextOperation(ctx, "Authenticate", "pam_authenticate", f)
+}
+
+// SetCredContext is SetCred, returning the error of ctx if it is already
+// done.
+func (m *MockTransaction) SetCredContext(ctx context.Context, f pam.Flags) error {
+	return m.contextOperation(ctx, "SetCred", "pam_setcred", f)
+}
+
+// AcctMgmtContext is AcctMgmt, returning the error of ctx if it is already
+// done.
+func (m *MockTransaction) AcctMgmtContext(ctx context.Context, f pam.Flags) error {
+	return m.contextOperation(ctx, "AcctMgmt", "pam_acct_mgmt", f)
+}
+
+// ChangeAuthTokContext is ChangeAuthTok, returning the error of ctx if it
+// is already done.
+func (m *MockTransaction) ChangeAuthTokContext(ctx context.Context, f pam.Flags) error {
+	return m.contextOperation(ctx, "ChangeAuthTok", "pam_chauthtok", f)
+}
+
+// OpenSessionContext is OpenSession, returning the error of ctx if it is
+// already done.
+func (m *MockTransaction) OpenSessionContext(ctx context.Context, f pam.Flags) error {
+	return m.contextOperation(ctx, "OpenSession", "pam_open_session", f)
+}
+
+// CloseSessionContext is CloseSession, returning the error of ctx if it is
+// already done.
+func (m *MockTransaction) CloseSessionContext(ctx context.Context, f pam.Flags) error {
+	return m.contextOperation(ctx, "CloseSession", "pam_close_session", f)
+}
+
+// Resume records the call and runs the programmed operation, it fails with
+// pam.ErrNothingToResume by default.
+func (m *MockTransaction) Resume() error {
+	m.mu.Lock()
+	err, done := m.record("Resume", "pam_resume")
+	fn := m.Funcs["Resume"]
+	m.mu.Unlock()
+	if done {
+		return err
+	}
+	if fn != nil {
+		return fn(m, 0)
+	}
+	return pam.ErrNothingToResume
+}
+
+// End ends the transaction, the next calls fail with
+// pam.ErrTransactionClosed.
+func (m *MockTransaction) End() error {
+	return m.EndWithFlags(0)
+}
+
+// EndWithFlags is End, the transaction ends even if an error is programmed.
+// As with pam.Transaction, flags other than Silent and DataSilent return
+// pam.ErrInvalidArgument and the transaction is not ended.
+func (m *MockTransaction) EndWithFlags(f pam.Flags) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err, _ := m.record("EndWithFlags", "pam_end", f)
+	if !m.ended {
+		if allowed := pam.Silent | pam.DataSilent; f&^allowed != 0 {
+			return &pam.OpError{Op: "pam_end", Args: f.String(),
+				Err: &pam.FlagsError{Flags: f, Allowed: allowed}}
+		}
+	}
+	m.ended = true
+	return err
+}
+
+// Status returns the status of the last operation.
+func (m *MockTransaction) Status() pam.Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// StrError returns the message describing status.
+func (m *MockTransaction) StrError(status pam.Error) string {
+	return pam.StrError(status)
+}
+
+// String describes the transaction, as pam.Transaction does.
+func (m *MockTransaction) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("pam[")
+	if m.ended {
+		b.WriteString("<ended>")
+	} else {
+		b.WriteString(m.Items[pam.Service])
+		for _, i := range []struct {
+			item pam.Item
+			name string
+		}{{pam.User, "user"}, {pam.Tty, "tty"}, {pam.Rhost, "rhost"}, {pam.Ruser, "ruser"}} {
+			if v := m.Items[i.item]; v != "" {
+				fmt.Fprintf(&b, " %s=%s", i.name, v)
+			}
+		}
+		if m.Items[pam.Authtok] != "" {
+			b.WriteString(" authtok=<redacted>")
+		}
+	}
+	fmt.Fprintf(&b, " status=%s]", m.status.Name())
+	return b.String()
+}
+
+// History returns the operations run so far.
+func (m *MockTransaction) History() []pam.HistoryEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]pam.HistoryEntry(nil), m.history...)
+}
+
+// CollectMessages records the call.
+func (m *MockTransaction) CollectMessages(enable bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Method: "CollectMessages", Args: []any{enable}})
+}
+
+// SetConversationHandler replaces the conversation handler.
+func (m *MockTransaction) SetConversationHandler(handler pam.ConversationHandler) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err, _ := m.record("SetConversationHandler", "pam_set_item", handler)
+	if err == nil {
+		m.handler = handler
+	}
+	return err
+}
+
+// CancelConversation records the call.
+func (m *MockTransaction) CancelConversation() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Method: "CancelConversation"})
+}
+
+// SetAppData stores v.
+func (m *MockTransaction) SetAppData(v any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Method: "SetAppData", Args: []any{v}})
+	m.appData = v
+}
+
+// AppData returns the value stored by SetAppData.
+func (m *MockTransaction) AppData() any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.appData
+}
+
+// FailDelay records the requested delay.
+func (m *MockTransaction) FailDelay(d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err, _ := m.record("FailDelay", "pam_fail_delay", d)
+	return err
+}
+
+// Credential returns Cred, or the identity of the user named by the User
+// item, including its supplementary groups.
+func (m *MockTransaction) Credential() (*syscall.Credential, error) {
+	m.mu.Lock()
+	err, _ := m.record("Credential", "getpwnam")
+	cred, name := m.Cred, m.Items[pam.User]
+	m.mu.Unlock()
+	if err != nil || cred != nil {
+		return cred, err
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	ids := append([]string{u.Uid, u.Gid}, groups...)
+	nums := make([]uint32, len(ids))
+	for i, id := range ids {
+		n, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = uint32(n)
+	}
+	return &syscall.Credential{Uid: nums[0], Gid: nums[1], Groups: nums[2:]}, nil
+}
+
+// GetItem returns the item i, empty if it is not set. XAuthData returns
+// pam.ErrInvalidArgument, as with pam.Transaction.
+func (m *MockTransaction) GetItem(i pam.Item) (string, error) {
+	if i == pam.XAuthData {
+		return "", &pam.OpError{Op: "pam_get_item", Args: i.String(), Err: pam.ErrInvalidArgument}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err, _ := m.record("GetItem", "pam_get_item", i); err != nil {
+		return "", err
+	}
+	return m.Items[i], nil
+}
+
+// GetItemBytes returns the item i as bytes.
+func (m *MockTransaction) GetItemBytes(i pam.Item) ([]byte, error) {
+	if i == pam.XAuthData {
+		_, data, err := m.GetXAuthData()
+		return data, err
+	}
+	s, err := m.GetItem(i)
+	if err != nil || s == "" {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// SetItem sets the item i. XAuthData returns pam.ErrInvalidArgument, as
+// with pam.Transaction.
+func (m *MockTransaction) SetItem(i pam.Item, item string) error {
+	if i == pam.XAuthData {
+		return &pam.OpError{Op: "pam_set_item", Args: i.String(), Err: pam.ErrInvalidArgument}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	args := []any{i, item}
+	if i == pam.Authtok || i == pam.Oldauthtok {
+		args[1] = "<redacted>"
+	}
+	err, _ := m.record("SetItem", "pam_set_item", args...)
+	if err == nil {
+		m.Items[i] = item
+	}
+	return err
+}
+
+// GetUser returns the User item, asking the conversation handler for it
+// with prompt, the UserPrompt item or "login: " if it is not set.
+func (m *MockTransaction) GetUser(prompt string) (string, error) {
+	m.mu.Lock()
+	err, _ := m.record("GetUser", "pam_get_user", prompt)
+	user, ok := m.Items[pam.User]
+	if prompt == "" {
+		prompt = m.Items[pam.UserPrompt]
+	}
+	m.mu.Unlock()
+	if err != nil || ok {
+		return user, err
+	}
+	if prompt == "" {
+		prompt = "login: "
+	}
+	user, err = m.Converse(pam.PromptEchoOn, prompt)
+	if err != nil {
+		return "", &pam.OpError{Op: "pam_get_user", Err: pam.ErrConv}
+	}
+	m.mu.Lock()
+	m.Items[pam.User] = user
+	m.mu.Unlock()
+	return user, nil
+}
+
+// Service returns the Service item.
+func (m *MockTransaction) Service() (string, error) { return m.GetItem(pam.Service) }
+
+// SetService sets the Service item.
+func (m *MockTransaction) SetService(s string) error { return m.SetItem(pam.Service, s) }
+
+// User returns the User item.
+func (m *MockTransaction) User() (string, error) { return m.GetItem(pam.User) }
+
+// SetUser sets the User item.
+func (m *MockTransaction) SetUser(s string) error { return m.SetItem(pam.User, s) }
+
+// Tty returns the Tty item.
+func (m *MockTransaction) Tty() (string, error) { return m.GetItem(pam.Tty) }
+
+// SetTty sets the Tty item.
+func (m *MockTransaction) SetTty(s string) error { return m.SetItem(pam.Tty, s) }
+
+// Rhost returns the Rhost item.
+func (m *MockTransaction) Rhost() (string, error) { return m.GetItem(pam.Rhost) }
+
+// SetRhost sets the Rhost item.
+func (m *MockTransaction) SetRhost(s string) error { return m.SetItem(pam.Rhost, s) }
+
+// Ruser returns the Ruser item.
+func (m *MockTransaction) Ruser() (string, error) { return m.GetItem(pam.Ruser) }
+
+// SetRuser sets the Ruser item.
+func (m *MockTransaction) SetRuser(s string) error { return m.SetItem(pam.Ruser, s) }
+
+// UserPrompt returns the UserPrompt item.
+func (m *MockTransaction) UserPrompt() (string, error) { return m.GetItem(pam.UserPrompt) }
+
+// SetUserPrompt sets the UserPrompt item.
+func (m *MockTransaction) SetUserPrompt(s string) error { return m.SetItem(pam.UserPrompt, s) }
+
+// XDisplay returns the XDisplay item.
+func (m *MockTransaction) XDisplay() (string, error) { return m.GetItem(pam.XDisplay) }
+
+// SetXDisplay sets the XDisplay item.
+func (m *MockTransaction) SetXDisplay(s string) error { return m.SetItem(pam.XDisplay, s) }
+
+// AuthtokType returns the AuthtokType item.
+func (m *MockTransaction) AuthtokType() (string, error) { return m.GetItem(pam.AuthtokType) }
+
+// SetAuthtokType sets the AuthtokType item.
+func (m *MockTransaction) SetAuthtokType(s string) error { return m.SetItem(pam.AuthtokType, s) }
+
+// SetAuthTok sets the Authtok item and wipes tok.
+func (m *MockTransaction) SetAuthTok(tok []byte) error {
+	defer wipe(tok)
+	return m.SetItem(pam.Authtok, string(tok))
+}
+
+// SetOldAuthTok sets the Oldauthtok item and wipes tok.
+func (m *MockTransaction) SetOldAuthTok(tok []byte) error {
+	defer wipe(tok)
+	return m.SetItem(pam.Oldauthtok, string(tok))
+}
+
+// wipe overwrites the content of b with zeroes.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// GetXAuthData returns the X authentication data.
+func (m *MockTransaction) GetXAuthData() (name string, data []byte, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err, _ := m.record("GetXAuthData", "pam_get_item"); err != nil {
+		return "", nil, err
+	}
+	return m.xauthName, append([]byte(nil), m.xauthData...), nil
+}
+
+// SetXAuthData sets the X authentication data.
+func (m *MockTransaction) SetXAuthData(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err, _ := m.record("SetXAuthData", "pam_set_item", name, "<redacted>")
+	if err == nil {
+		m.xauthName, m.xauthData = name, append([]byte(nil), data...)
+	}
+	return err
+}
+
+// PutEnv sets "NAME=value" or unsets "NAME" in the environment, as
+// pam_putenv does.
+func (m *MockTransaction) PutEnv(nameval string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name, value, set := strings.Cut(nameval, "=")
+	if err, _ := m.record("PutEnv", "pam_putenv", name); err != nil {
+		return err
+	}
+	return m.putEnv(name, value, set)
+}
+
+// putEnv changes the variable name, it must be called with m.mu held.
+func (m *MockTransaction) putEnv(name, value string, set bool) error {
+	if name == "" {
+		return &pam.OpError{Op: "pam_putenv", Err: pam.ErrInvalidArgument}
+	}
+	if set {
+		m.Env[name] = value
+		return nil
+	}
+	if _, ok := m.Env[name]; !ok {
+		return &pam.OpError{Op: "pam_putenv", Args: name, Err: pam.ErrBadItem}
+	}
+	delete(m.Env, name)
+	return nil
+}
+
+// SetEnv sets the variable name to value.
+func (m *MockTransaction) SetEnv(name, value string) error {
+	if name == "" || strings.Contains(name, "=") {
+		return &pam.OpError{Op: "pam_putenv", Args: name, Err: pam.ErrInvalidArgument}
+	}
+	return m.PutEnv(name + "=" + value)
+}
+
+// UnsetEnv removes the variable name, if set.
+func (m *MockTransaction) UnsetEnv(name string) error {
+	if _, ok := m.LookupEnv(name); !ok {
+		return nil
+	}
+	return m.PutEnv(name)
+}
+
+// GetEnv returns the variable name, empty if it is not set.
+func (m *MockTransaction) GetEnv(name string) string {
+	value, _ := m.LookupEnv(name)
+	return value
+}
+
+// LookupEnv returns the variable name and whether it is set.
+func (m *MockTransaction) LookupEnv(name string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ended {
+		return "", false
+	}
+	value, ok := m.Env[name]
+	return value, ok
+}
+
+// GetEnvList returns a copy of the environment.
+func (m *MockTransaction) GetEnvList() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err, _ := m.record("GetEnvList", "pam_getenvlist"); err != nil {
+		return nil, err
+	}
+	env := make(map[string]string, len(m.Env))
+	for k, v := range m.Env {
+		env[k] = v
+	}
+	return env, nil
+}
+
+// Environ returns the environment as sorted "NAME=value" strings.
+func (m *MockTransaction) Environ() ([]string, error) {
+	env, err := m.GetEnvList()
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// PutEnvList applies the "NAME=value" or "NAME" strings, all of them or
+// none.
+func (m *MockTransaction) PutEnvList(list []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err, _ := m.record("PutEnvList", "pam_putenv", list); err != nil {
+		return err
+	}
+	saved := make(map[string]string, len(m.Env))
+	for k, v := range m.Env {
+		saved[k] = v
+	}
+	for _, nameval := range list {
+		name, value, set := strings.Cut(nameval, "=")
+		if err := m.putEnv(name, value, set); err != nil {
+			m.Env = saved
+			return err
+		}
+	}
+	return nil
+}
+
+// PutEnvPairs sets the variables of env, all of them or none.
+func (m *MockTransaction) PutEnvPairs(env map[string]string) error {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		if k == "" || strings.Contains(k, "=") {
+			return &pam.OpError{Op: "pam_putenv", Args: k, Err: pam.ErrInvalidArgument}
+		}
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return m.PutEnvList(list)
+}
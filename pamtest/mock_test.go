@@ -0,0 +1,133 @@
+package pamtest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestMockTransaction(t *testing.T) {
+	c := &Conversation{EchoOff: []string{"secret"}}
+	m := NewMockTransaction("login", "test", c)
+	m.Results["Authenticate"] = []error{pam.ErrAuth}
+	m.Funcs["Authenticate"] = func(m *MockTransaction, f pam.Flags) error {
+		if p, err := m.Converse(pam.PromptEchoOff, "Password: "); err != nil || p != "secret" {
+			return pam.ErrAuth
+		}
+		return m.SetEnv("MOCK", "1")
+	}
+	if err := m.Authenticate(0); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", pam.ErrAuth, err)
+	}
+	if m.Status() != pam.ErrAuth {
+		t.Fatalf("status #expected %v, got %v", pam.ErrAuth, m.Status())
+	}
+	if err := m.Authenticate(pam.Silent); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if v := m.GetEnv("MOCK"); v != "1" {
+		t.Fatalf("getenv #expected 1, got %q", v)
+	}
+	if err := m.AcctMgmt(0); err != nil {
+		t.Fatalf("acctmgmt #error: %v", err)
+	}
+	if n := m.Called("Authenticate"); n != 2 {
+		t.Fatalf("called #expected 2, got %d", n)
+	}
+	history := m.History()
+	if len(history) != 3 || history[0].Status != pam.ErrAuth || history[1].Flags != pam.Silent ||
+		history[2].Op != "pam_acct_mgmt" {
+		t.Fatalf("history #unexpected: %v", history)
+	}
+	if s := m.String(); s != "pam[login user=test status=PAM_SUCCESS]" {
+		t.Fatalf("string #unexpected: %q", s)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.OpenSessionContext(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("opensession #expected %v, got %v", context.Canceled, err)
+	}
+	if err := m.End(); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	if err := m.SetCred(0); !errors.Is(err, pam.ErrTransactionClosed) {
+		t.Fatalf("setcred #expected %v, got %v", pam.ErrTransactionClosed, err)
+	}
+}
+
+func TestMockTransactionItems(t *testing.T) {
+	m := NewMockTransaction("login", "", &Conversation{EchoOn: []string{"test"}})
+	user, err := m.GetUser("")
+	if err != nil || user != "test" {
+		t.Fatalf("getuser #error: %q, %v", user, err)
+	}
+	if err := m.SetRhost("client.example"); err != nil {
+		t.Fatalf("setrhost #error: %v", err)
+	}
+	if rhost, err := m.Rhost(); err != nil || rhost != "client.example" {
+		t.Fatalf("rhost #error: %q, %v", rhost, err)
+	}
+	tok := []byte("secret")
+	if err := m.SetAuthTok(tok); err != nil {
+		t.Fatalf("setauthtok #error: %v", err)
+	}
+	if tok[0] != 0 || m.Items[pam.Authtok] != "secret" {
+		t.Fatalf("setauthtok #unexpected: %q, %q", tok, m.Items[pam.Authtok])
+	}
+	m.Results["SetItem"] = []error{pam.ErrBadItem}
+	if err := m.SetTty("tty1"); !errors.Is(err, pam.ErrBadItem) {
+		t.Fatalf("settty #expected %v, got %v", pam.ErrBadItem, err)
+	}
+	calls := m.Calls()
+	last := calls[len(calls)-1]
+	if last.Method != "SetItem" || !reflect.DeepEqual(last.Args, []any{pam.Tty, "tty1"}) {
+		t.Fatalf("calls #unexpected: %v", last)
+	}
+	for _, c := range calls {
+		if c.Method == "SetItem" && c.Args[0] == pam.Authtok && c.Args[1] != "<redacted>" {
+			t.Fatalf("calls #unexpected: %v", c)
+		}
+	}
+}
+
+func TestMockTransactionEnv(t *testing.T) {
+	m := NewMockTransaction("login", "test", nil)
+	if err := m.PutEnvList([]string{"A=1", "B=2"}); err != nil {
+		t.Fatalf("putenvlist #error: %v", err)
+	}
+	if err := m.PutEnvList([]string{"C=3", "MISSING"}); !errors.Is(err, pam.ErrBadItem) {
+		t.Fatalf("putenvlist #expected %v, got %v", pam.ErrBadItem, err)
+	}
+	if _, ok := m.LookupEnv("C"); ok {
+		t.Fatalf("putenvlist #error: C set by a failed call")
+	}
+	if err := m.UnsetEnv("A"); err != nil {
+		t.Fatalf("unsetenv #error: %v", err)
+	}
+	if err := m.UnsetEnv("A"); err != nil {
+		t.Fatalf("unsetenv #error: %v", err)
+	}
+	env, err := m.Environ()
+	if err != nil || !reflect.DeepEqual(env, []string{"B=2"}) {
+		t.Fatalf("environ #error: %v, %v", env, err)
+	}
+	if _, err := m.Converse(pam.PromptEchoOn, "login: "); !errors.Is(err, pam.ErrConv) {
+		t.Fatalf("converse #expected %v, got %v", pam.ErrConv, err)
+	}
+}
+
+func TestMockTransactionCredential(t *testing.T) {
+	m := NewMockTransaction("login", "root", nil)
+	cred, err := m.Credential()
+	if err != nil || cred.Uid != 0 || cred.Gid != 0 {
+		t.Fatalf("credential #error: %v, %v", cred, err)
+	}
+	m.Cred = &syscall.Credential{Uid: 1234}
+	if cred, err := m.Credential(); err != nil || cred.Uid != 1234 {
+		t.Fatalf("credential #error: %v, %v", cred, err)
+	}
+}
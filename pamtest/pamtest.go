@@ -0,0 +1,224 @@
+// Package pamtest helps testing PAM flows, as libpamtest does for C: a
+// Test declares the operations to run against a service, with the expected
+// statuses and the canned answers of the conversation, and Run checks them.
+// MockTransaction fakes a transaction for unit tests that can not use PAM.
+package pamtest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+// Op is a PAM operation run by a Test.
+type Op int
+
+// Operations of a Test.
+const (
+	// Authenticate is pam_authenticate.
+	Authenticate Op = iota
+	// SetCred is pam_setcred.
+	SetCred
+	// AcctMgmt is pam_acct_mgmt.
+	AcctMgmt
+	// OpenSession is pam_open_session.
+	OpenSession
+	// CloseSession is pam_close_session.
+	CloseSession
+	// ChangeAuthTok is pam_chauthtok.
+	ChangeAuthTok
+)
+
+// String returns the name of the PAM function of op.
+func (op Op) String() string {
+	switch op {
+	case Authenticate:
+		return "pam_authenticate"
+	case SetCred:
+		return "pam_setcred"
+	case AcctMgmt:
+		return "pam_acct_mgmt"
+	case OpenSession:
+		return "pam_open_session"
+	case CloseSession:
+		return "pam_close_session"
+	case ChangeAuthTok:
+		return "pam_chauthtok"
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// run runs op on tx.
+func (op Op) run(tx *pam.Transaction, f pam.Flags) error {
+	switch op {
+	case Authenticate:
+		return tx.Authenticate(f)
+	case SetCred:
+		return tx.SetCred(f)
+	case AcctMgmt:
+		return tx.AcctMgmt(f)
+	case OpenSession:
+		return tx.OpenSession(f)
+	case CloseSession:
+		return tx.CloseSession(f)
+	case ChangeAuthTok:
+		return tx.ChangeAuthTok(f)
+	}
+	return fmt.Errorf("pamtest: unknown operation %v", op)
+}
+
+// Case is an operation of a Test and its expected result.
+type Case struct {
+	// Op is the operation, called with Flags.
+	Op    Op
+	Flags pam.Flags
+	// Expected is the expected status, nil for success. The error of the
+	// operation is matched using errors.Is, so that it can be a pam.Error.
+	Expected error
+}
+
+// Conversation is a conversation handler with canned answers, it records
+// the messages of the modules.
+type Conversation struct {
+	// EchoOff are the answers to the PromptEchoOff prompts, in order.
+	EchoOff []string
+	// EchoOn are the answers to the PromptEchoOn prompts, in order.
+	EchoOn []string
+	// Prompts, Info and Errors record the texts of the prompts, the
+	// TextInfo and the ErrorMsg messages.
+	Prompts []string
+	Info    []string
+	Errors  []string
+}
+
+// RespondPAM answers the prompts with the next canned answer of their
+// style, or fails with pam.ErrConv if there is none left.
+func (c *Conversation) RespondPAM(s pam.Style, msg string) (string, error) {
+	var answers *[]string
+	switch s {
+	case pam.PromptEchoOff:
+		answers = &c.EchoOff
+	case pam.PromptEchoOn:
+		answers = &c.EchoOn
+	case pam.TextInfo:
+		c.Info = append(c.Info, msg)
+		return "", nil
+	case pam.ErrorMsg:
+		c.Errors = append(c.Errors, msg)
+		return "", nil
+	default:
+		return "", pam.ErrConv
+	}
+	c.Prompts = append(c.Prompts, msg)
+	if len(*answers) == 0 {
+		return "", fmt.Errorf("%w: no answer to %q", pam.ErrConv, msg)
+	}
+	answer := (*answers)[0]
+	*answers = (*answers)[1:]
+	return answer, nil
+}
+
+// Test is a sequence of operations run in a PAM transaction.
+type Test struct {
+	// Service and User start the transaction.
+	Service string
+	User    string
+	// ConfDir is the directory of the service configuration, the system
+	// one if empty.
+	ConfDir string
+	// Config, if not empty, is the configuration of Service, it is written
+	// in a temporary directory used instead of ConfDir.
+	Config string
+	// Conversation answers the prompts, none are expected if nil.
+	Conversation *Conversation
+	// Options configure the transaction.
+	Options []pam.StartOption
+	// Cases are run in order, the test stops at the first unexpected
+	// result.
+	Cases []Case
+}
+
+// Result is the state of the transaction once a Test has run.
+type Result struct {
+	// Env is the PAM environment.
+	Env map[string]string
+	// Conversation is the conversation of the test, with the recorded
+	// messages.
+	Conversation *Conversation
+}
+
+// CaseError reports the unexpected result of a case.
+type CaseError struct {
+	// Index is the index of the case in the test.
+	Index int
+	Case  Case
+	// Err is the error returned by the operation.
+	Err error
+}
+
+func (e *CaseError) Error() string {
+	return fmt.Sprintf("pamtest: case %d: %v: expected %v, got %v",
+		e.Index, e.Case.Op, e.Case.Expected, e.Err)
+}
+
+func (e *CaseError) Unwrap() error {
+	return e.Err
+}
+
+// Check runs test, returning a CaseError for the first case whose result is
+// not the expected one.
+func Check(test *Test) (*Result, error) {
+	conv := test.Conversation
+	if conv == nil {
+		conv = &Conversation{}
+	}
+	confDir := test.ConfDir
+	if test.Config != "" {
+		dir, err := os.MkdirTemp("", "pamtest")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		if err := os.WriteFile(filepath.Join(dir, test.Service), []byte(test.Config), 0o644); err != nil {
+			return nil, err
+		}
+		confDir = dir
+	}
+	opts := test.Options
+	if confDir != "" {
+		opts = append(opts[:len(opts):len(opts)], pam.WithConfDir(confDir))
+	}
+	tx, err := pam.StartWithOptions(test.Service, test.User, conv, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.End()
+	res := &Result{Conversation: conv}
+	var caseErr error
+	for i, c := range test.Cases {
+		err := c.Op.run(tx, c.Flags)
+		if (c.Expected == nil && err != nil) || (c.Expected != nil && !errors.Is(err, c.Expected)) {
+			caseErr = &CaseError{Index: i, Case: c, Err: err}
+			break
+		}
+	}
+	if res.Env, err = tx.GetEnvList(); err != nil && caseErr == nil {
+		caseErr = err
+	}
+	return res, caseErr
+}
+
+// Run runs test as Check does, failing t if a case does not have the
+// expected result.
+func Run(t testing.TB, test *Test) *Result {
+	t.Helper()
+	res, err := Check(test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
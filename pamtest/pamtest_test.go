@@ -0,0 +1,68 @@
+package pamtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestRun(t *testing.T) {
+	conv := &Conversation{EchoOff: []string{"secret"}}
+	res := Run(t, &Test{
+		Service: "pamtest",
+		User:    "test",
+		Config: "auth required pam_unix.so\n" +
+			"auth optional pam_echo.so Hello %u\n" +
+			"account required pam_permit.so\n" +
+			"session required pam_permit.so\n",
+		Conversation: conv,
+		Cases: []Case{
+			{Op: Authenticate},
+			{Op: AcctMgmt},
+			{Op: OpenSession},
+			{Op: CloseSession},
+			{Op: ChangeAuthTok, Expected: pam.ErrPermDenied},
+		},
+	})
+	if len(conv.Prompts) != 1 || len(conv.Info) != 1 || conv.Info[0] != "Hello test" {
+		t.Fatalf("run #unexpected conversation: %+v", conv)
+	}
+	if res.Env == nil {
+		t.Fatalf("run #expected an environment")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	_, err := Check(&Test{
+		Service: "deny-service",
+		User:    "test",
+		ConfDir: "../test-services",
+		Cases:   []Case{{Op: Authenticate}},
+	})
+	var ce *CaseError
+	if !errors.As(err, &ce) || ce.Index != 0 || !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("check #expected a CaseError, got %v", err)
+	}
+	_, err = Check(&Test{
+		Service: "permit-service",
+		ConfDir: "../test-services",
+		Cases:   []Case{{Op: Authenticate, Expected: pam.ErrConv}},
+	})
+	if err != nil {
+		t.Fatalf("check #error: %v", err)
+	}
+}
+
+func TestConversation(t *testing.T) {
+	c := &Conversation{EchoOn: []string{"test"}}
+	if r, err := c.RespondPAM(pam.PromptEchoOn, "login: "); err != nil || r != "test" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+	if _, err := c.RespondPAM(pam.PromptEchoOn, "login: "); !errors.Is(err, pam.ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %v", pam.ErrConv, err)
+	}
+	if _, err := c.RespondPAM(pam.ErrorMsg, "oops"); err != nil || len(c.Errors) != 1 {
+		t.Fatalf("respondpam #error: %v, %v", c.Errors, err)
+	}
+}
@@ -0,0 +1,133 @@
+package pam
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// ErrPoolClosed is returned by the methods of a Pool that has been closed.
+var ErrPoolClosed = errors.New("pam: pool closed")
+
+// Pool runs PAM transactions on a fixed set of workers, each one locked to
+// its own OS thread, for servers performing many authentications. All the
+// transactions of a worker run on the same thread and the number of
+// workers bounds the number of transactions running at the same time.
+//
+// The workers are started on first use, a Pool must not be copied after
+// that. Close stops them.
+type Pool struct {
+	// Service is the name of the PAM service of the transactions.
+	Service string
+	// Workers is the number of workers, if zero runtime.NumCPU is used.
+	Workers int
+	// ConfDir is the directory where the PAM services are defined, if
+	// empty the system default is used.
+	ConfDir string
+	// Options are used to start the transactions.
+	Options []StartOption
+
+	once   sync.Once
+	mu     sync.RWMutex
+	jobs   chan func()
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// init starts the workers.
+func (p *Pool) init() {
+	p.once.Do(func() {
+		n := p.Workers
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+		p.jobs = make(chan func())
+		p.wg.Add(n)
+		for i := 0; i < n; i++ {
+			go p.work()
+		}
+	})
+}
+
+// work runs the jobs of the pool on a locked thread.
+func (p *Pool) work() {
+	defer p.wg.Done()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	for job := range p.jobs {
+		job()
+	}
+}
+
+// Do starts a transaction on a worker, without user and conversation
+// handler, passes it to fn and ends it once fn returns. fn must not keep
+// the transaction, its PAM calls must be performed by the goroutine running
+// it so that they happen on the worker thread.
+func (p *Pool) Do(fn func(*Transaction) error) error {
+	p.init()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	var err error
+	done := make(chan struct{})
+	p.jobs <- func() {
+		defer close(done)
+		err = p.run(fn)
+	}
+	<-done
+	return err
+}
+
+// run performs a job of Do.
+func (p *Pool) run(fn func(*Transaction) error) error {
+	opts := p.Options
+	if p.ConfDir != "" {
+		opts = append([]StartOption{WithConfDir(p.ConfDir)}, opts...)
+	}
+	t, err := StartWithOptions(p.Service, "", nil, opts...)
+	if err != nil {
+		return err
+	}
+	if err := fn(t); err != nil {
+		t.End()
+		return err
+	}
+	return t.End()
+}
+
+// Check authenticates user with password and checks that the account is
+// valid, as Authenticate and AcctMgmt do. The password is wiped when the
+// transaction ends.
+func (p *Pool) Check(user, password string) error {
+	return p.Do(func(t *Transaction) error {
+		if err := t.SetUser(user); err != nil {
+			return err
+		}
+		err := t.SetConversationHandler(&CredentialsHandler{
+			User:     user,
+			Password: []byte(password),
+		})
+		if err != nil {
+			return err
+		}
+		return checkAccount(t)
+	})
+}
+
+// Close stops the workers once the running transactions are done, Do then
+// returns ErrPoolClosed.
+func (p *Pool) Close() error {
+	p.init()
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.jobs)
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
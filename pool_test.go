@@ -0,0 +1,59 @@
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestPoolCheck(t *testing.T) {
+	u, _ := user.Current()
+	if u.Uid != "0" {
+		t.Skip("run this test as root")
+	}
+	p := &Pool{Workers: 2}
+	defer p.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Check("test", "secret"); err != nil {
+				t.Errorf("check #error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := p.Check("test", "wrong"); !errors.Is(err, ErrAuth) {
+		t.Fatalf("check #expected %v, got %v", ErrAuth, err)
+	}
+}
+
+func TestPoolDo(t *testing.T) {
+	p := &Pool{Service: "permit-service", Workers: 1, ConfDir: "test-services"}
+	var tids []int
+	for i := 0; i < 2; i++ {
+		err := p.Do(func(tx *Transaction) error {
+			tids = append(tids, syscall.Gettid())
+			if err := tx.SetUser("testuser"); err != nil {
+				return err
+			}
+			return tx.Authenticate(0)
+		})
+		if err != nil {
+			t.Fatalf("do #error: %v", err)
+		}
+	}
+	if tids[0] != tids[1] {
+		t.Fatalf("do #unexpected threads: %v", tids)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	err := p.Do(func(tx *Transaction) error { return nil })
+	if !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("do #expected %v, got %v", ErrPoolClosed, err)
+	}
+}
@@ -0,0 +1,128 @@
+package pam
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// PromptKind is the kind of information that a prompt asks for, as
+// recognized by a PromptClassifier.
+type PromptKind int
+
+// Prompt kinds.
+const (
+	// PromptUnknown is a prompt that was not recognized.
+	PromptUnknown PromptKind = iota
+	// PromptUsername asks for the user name.
+	PromptUsername
+	// PromptPassword asks for the current password.
+	PromptPassword
+	// PromptNewPassword asks for a new password.
+	PromptNewPassword
+	// PromptRetypePassword asks to confirm the new password.
+	PromptRetypePassword
+	// PromptOTP asks for a one-time password or verification code.
+	PromptOTP
+	// PromptPIN asks for the PIN of a token or smart card.
+	PromptPIN
+)
+
+var promptKindNames = []string{
+	"Unknown", "Username", "Password", "NewPassword", "RetypePassword", "OTP", "PIN",
+}
+
+// String returns the name of the kind, such as "NewPassword".
+func (k PromptKind) String() string {
+	if k >= 0 && int(k) < len(promptKindNames) {
+		return promptKindNames[k]
+	}
+	return "PromptKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// PromptRule classifies the prompts matching Pattern as Kind.
+type PromptRule struct {
+	Kind    PromptKind
+	Pattern *regexp.Regexp
+}
+
+// PromptRules are the rules recognizing the prompts of the common modules,
+// by language. Within a language, the rules of the more specific kinds come
+// first, as "Retype new password" also contains "password".
+var PromptRules = map[string][]PromptRule{
+	"en": {
+		{PromptRetypePassword, regexp.MustCompile(`(?i)(retype|re-enter|repeat|again|confirm|verify).*password`)},
+		{PromptNewPassword, regexp.MustCompile(`(?i)new.*password`)},
+		{PromptOTP, regexp.MustCompile(`(?i)verification code|one[- ]time (password|code)|\botp\b|token code|passcode`)},
+		{PromptPIN, regexp.MustCompile(`(?i)\bpin\b`)},
+		{PromptPassword, regexp.MustCompile(`(?i)password|passphrase`)},
+		{PromptUsername, regexp.MustCompile(`(?i)login|user ?name`)},
+	},
+	"fr": {
+		{PromptRetypePassword, regexp.MustCompile(`(?i)(retapez|confirmez|saisissez à nouveau).*mot de passe`)},
+		{PromptNewPassword, regexp.MustCompile(`(?i)nouveau mot de passe`)},
+		{PromptOTP, regexp.MustCompile(`(?i)code de vérification|mot de passe à usage unique`)},
+		{PromptPIN, regexp.MustCompile(`(?i)\bcode pin\b|\bpin\b`)},
+		{PromptPassword, regexp.MustCompile(`(?i)mot de passe`)},
+		{PromptUsername, regexp.MustCompile(`(?i)nom d'utilisateur|identifiant`)},
+	},
+	"de": {
+		{PromptRetypePassword, regexp.MustCompile(`(?i)(erneut|wiederholen|bestätigen).*passwort|passwort.*(erneut|wiederholen|bestätigen)`)},
+		{PromptNewPassword, regexp.MustCompile(`(?i)neues passwort`)},
+		{PromptOTP, regexp.MustCompile(`(?i)bestätigungscode|einmalpasswort`)},
+		{PromptPIN, regexp.MustCompile(`(?i)\bpin\b`)},
+		{PromptPassword, regexp.MustCompile(`(?i)passwort|kennwort`)},
+		{PromptUsername, regexp.MustCompile(`(?i)benutzername|anmeldename`)},
+	},
+	"es": {
+		{PromptRetypePassword, regexp.MustCompile(`(?i)(vuelva a escribir|repita|confirme).*contraseña`)},
+		{PromptNewPassword, regexp.MustCompile(`(?i)nueva contraseña`)},
+		{PromptOTP, regexp.MustCompile(`(?i)código de verificación|contraseña de un solo uso`)},
+		{PromptPIN, regexp.MustCompile(`(?i)\bpin\b`)},
+		{PromptPassword, regexp.MustCompile(`(?i)contraseña`)},
+		{PromptUsername, regexp.MustCompile(`(?i)nombre de usuario|usuario`)},
+	},
+}
+
+// PromptClassifier recognizes the kind of the prompts using ordered rules.
+type PromptClassifier struct {
+	Rules []PromptRule
+}
+
+// NewPromptClassifier returns a classifier using the PromptRules of the
+// given languages, such as "en" or "fr", in order. Unknown languages are
+// ignored.
+func NewPromptClassifier(langs ...string) *PromptClassifier {
+	c := &PromptClassifier{}
+	for _, lang := range langs {
+		c.Rules = append(c.Rules, PromptRules[lang]...)
+	}
+	return c
+}
+
+// DefaultPromptClassifier recognizes the prompts of all the languages of
+// PromptRules, English first.
+var DefaultPromptClassifier = NewPromptClassifier("en", "fr", "de", "es")
+
+// Classify returns the kind of a prompt. Messages that are not prompts are
+// PromptUnknown, as are PromptEchoOff prompts classified as PromptUsername.
+func (c *PromptClassifier) Classify(s Style, msg string) PromptKind {
+	if !isPrompt(s) {
+		return PromptUnknown
+	}
+	for _, r := range c.Rules {
+		if !r.Pattern.MatchString(msg) {
+			continue
+		}
+		if r.Kind == PromptUsername && s == PromptEchoOff {
+			return PromptUnknown
+		}
+		return r.Kind
+	}
+	return PromptUnknown
+}
+
+// ClassifyPrompt returns the kind of a prompt using the
+// DefaultPromptClassifier.
+func ClassifyPrompt(s Style, msg string) PromptKind {
+	return DefaultPromptClassifier.Classify(s, msg)
+}
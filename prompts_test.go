@@ -0,0 +1,39 @@
+package pam
+
+import "testing"
+
+func TestClassifyPrompt(t *testing.T) {
+	tests := []struct {
+		style    Style
+		msg      string
+		expected PromptKind
+	}{
+		{PromptEchoOn, "login: ", PromptUsername},
+		{PromptEchoOn, "Username: ", PromptUsername},
+		{PromptEchoOff, "Password: ", PromptPassword},
+		{PromptEchoOff, "(current) UNIX password: ", PromptPassword},
+		{PromptEchoOff, "New password: ", PromptNewPassword},
+		{PromptEchoOff, "Retype new password: ", PromptRetypePassword},
+		{PromptEchoOff, "Verification code: ", PromptOTP},
+		{PromptEchoOff, "Enter PIN for 'Token': ", PromptPIN},
+		{PromptEchoOff, "Mot de passe : ", PromptPassword},
+		{PromptEchoOff, "Retapez le nouveau mot de passe : ", PromptRetypePassword},
+		{PromptEchoOff, "Neues Passwort: ", PromptNewPassword},
+		{PromptEchoOff, "Contraseña: ", PromptPassword},
+		{PromptEchoOff, "Place your finger", PromptUnknown},
+		{PromptEchoOff, "login: ", PromptUnknown},
+		{TextInfo, "Password: ", PromptUnknown},
+	}
+	for _, tt := range tests {
+		if k := ClassifyPrompt(tt.style, tt.msg); k != tt.expected {
+			t.Fatalf("classifyprompt #error: %q: expected %v, got %v", tt.msg, tt.expected, k)
+		}
+	}
+	c := NewPromptClassifier("fr")
+	if k := c.Classify(PromptEchoOff, "Password: "); k != PromptUnknown {
+		t.Fatalf("classify #error: expected %v, got %v", PromptUnknown, k)
+	}
+	if s := PromptKind(42).String(); s != "PromptKind(42)" {
+		t.Fatalf("string #error: unexpected %v", s)
+	}
+}
@@ -0,0 +1,88 @@
+package pam
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// CredRefresher periodically refreshes the credentials of a transaction by
+// calling SetCred with RefreshCred, such as the Kerberos tickets obtained by
+// pam_krb5, for long running sessions.
+//
+// The transaction can be ended while the refresher runs: End waits for a
+// running refresh, and the refresher then stops on its next refresh, which
+// fails with ErrTransactionClosed and is reported to OnError. Call Stop
+// first to avoid that error.
+type CredRefresher struct {
+	// Transaction is the transaction whose credentials are refreshed.
+	Transaction *Transaction
+	// Interval is the time between two refreshes.
+	Interval time.Duration
+	// Jitter is the maximum random duration added to Interval, so that many
+	// sessions started at the same time do not refresh together.
+	Jitter time.Duration
+	// Flags are passed to SetCred together with RefreshCred, only Silent
+	// is allowed.
+	Flags Flags
+	// OnError is called, if not nil, when a refresh fails. The refreshes
+	// continue, unless the transaction has ended or its call was abandoned.
+	OnError func(error)
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Start starts refreshing the credentials in the background, the first
+// refresh happens after Interval. It returns ErrInvalidArgument if Interval
+// is not positive or if the refresher is already running.
+func (r *CredRefresher) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Interval <= 0 || r.Jitter < 0 || r.stop != nil {
+		return ErrInvalidArgument
+	}
+	r.stop, r.done = make(chan struct{}), make(chan struct{})
+	go r.run(r.stop, r.done)
+	return nil
+}
+
+// run refreshes the credentials until stop is closed.
+func (r *CredRefresher) run(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		d := r.Interval
+		if r.Jitter > 0 {
+			d += time.Duration(rand.Int63n(int64(r.Jitter)))
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		err := r.Transaction.SetCred(r.Flags | RefreshCred)
+		if err != nil && r.OnError != nil {
+			r.OnError(err)
+		}
+		if errors.Is(err, ErrTransactionClosed) || errors.Is(err, ErrCallAbandoned) {
+			return
+		}
+	}
+}
+
+// Stop stops the refreshes, waiting for a running one to complete. The
+// refresher can then be started again.
+func (r *CredRefresher) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+	r.stop, r.done = nil, nil
+}
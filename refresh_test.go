@@ -0,0 +1,76 @@
+package pam
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCredRefresher(t *testing.T) {
+	tx, err := StartConfDir("login-service", "testuser", nil, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	var mu sync.Mutex
+	var errs []error
+	r := &CredRefresher{
+		Transaction: tx,
+		Interval:    5 * time.Millisecond,
+		Jitter:      time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	}
+	if err := r.Start(); err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := r.Start(); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("start #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	r.Stop()
+	refreshes := 0
+	for _, e := range tx.History() {
+		if e.Op == "pam_setcred" && e.Flags == RefreshCred {
+			refreshes++
+		}
+	}
+	if refreshes == 0 {
+		t.Fatalf("refresh #error: no refresh performed")
+	}
+	mu.Lock()
+	if len(errs) != 0 {
+		t.Fatalf("refresh #unexpected errors: %v", errs)
+	}
+	mu.Unlock()
+	tx.End()
+	if err := r.Start(); err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	r.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrTransactionClosed) {
+		t.Fatalf("refresh #unexpected errors: %v", errs)
+	}
+}
+
+func TestCredRefresherEnd(t *testing.T) {
+	tx, err := StartConfDir("login-service", "testuser", nil, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	r := &CredRefresher{Transaction: tx, Interval: time.Millisecond}
+	if err := r.Start(); err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := tx.End(); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	r.Stop()
+}
@@ -0,0 +1,106 @@
+package pam
+
+import (
+	"errors"
+	"time"
+)
+
+// StageResult describes a PAM operation performed by the methods returning
+// an AuthResult.
+type StageResult struct {
+	// Op is the name of the PAM function, such as "pam_authenticate".
+	Op string
+	// Flags are the flags the function was called with.
+	Flags Flags
+	// Status is the status of the operation, zero on success. It is
+	// ErrSystem if the operation failed without a PAM status, Err then
+	// tells why.
+	Status Error
+	// Err is the error returned by the operation.
+	Err error
+	// Duration is the wall-clock time spent in the operation.
+	Duration time.Duration
+	// Prompts are the prompts sent by the modules. The responses are not
+	// recorded, the binary prompts have no data.
+	Prompts []Message
+	// Messages are the TextInfo and ErrorMsg messages sent by the modules.
+	Messages []Message
+}
+
+// AuthResult is a complete record of an authentication attempt, so that
+// audit-heavy applications can persist it.
+type AuthResult struct {
+	// Status is the status of the last stage performed, zero on success.
+	Status Error
+	// Err is the error of the failing stage, nil on success.
+	Err error
+	// Stages are the operations performed, in order.
+	Stages []StageResult
+	// Duration is the wall-clock time spent in the stages.
+	Duration time.Duration
+}
+
+// AuthenticateResult is like Authenticate, but returns a record of the
+// attempt.
+func (t *Transaction) AuthenticateResult(f Flags) *AuthResult {
+	var r AuthResult
+	r.run(t.stage("pam_authenticate", f, t.Authenticate))
+	return &r
+}
+
+// AcctMgmtResult is like AcctMgmt, but returns a record of the attempt.
+func (t *Transaction) AcctMgmtResult(f Flags) *AuthResult {
+	var r AuthResult
+	r.run(t.stage("pam_acct_mgmt", f, t.AcctMgmt))
+	return &r
+}
+
+// CheckResult authenticates the user and checks the account, stopping at
+// the first failure, and returns a record of the attempt.
+func (t *Transaction) CheckResult(f Flags) *AuthResult {
+	var r AuthResult
+	if r.run(t.stage("pam_authenticate", f, t.Authenticate)) {
+		r.run(t.stage("pam_acct_mgmt", f, t.AcctMgmt))
+	}
+	return &r
+}
+
+// run adds the stage s to the result and returns whether it succeeded.
+func (r *AuthResult) run(s StageResult) bool {
+	r.Stages = append(r.Stages, s)
+	r.Status, r.Err = s.Status, s.Err
+	r.Duration += s.Duration
+	return s.Err == nil
+}
+
+// stage performs the operation op with the flags f and records it.
+func (t *Transaction) stage(op string, f Flags, fn func(Flags) error) StageResult {
+	s := StageResult{Op: op, Flags: f}
+	t.setRecord(func(m Message) {
+		switch {
+		case m.Style == TextInfo || m.Style == ErrorMsg:
+			s.Messages = append(s.Messages, m)
+		default:
+			m.Binary = nil
+			s.Prompts = append(s.Prompts, m)
+		}
+	})
+	start := time.Now()
+	s.Err = fn(f)
+	s.Duration = time.Since(start)
+	t.setRecord(nil)
+	if s.Err != nil && !errors.As(s.Err, &s.Status) {
+		s.Status = ErrSystem
+	}
+	return s
+}
+
+// setRecord sets the function receiving the messages of the conversation.
+func (t *Transaction) setRecord(record func(Message)) {
+	if t.state == nil {
+		return
+	}
+	t.state.mu.Lock()
+	t.state.record = record
+	t.state.mu.Unlock()
+}
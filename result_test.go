@@ -0,0 +1,54 @@
+package pam
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckResult(t *testing.T) {
+	tx, err := StartConfDir("succeed-if-user-test", "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			return "testuser", nil
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	r := tx.CheckResult(Silent)
+	if !errors.Is(r.Err, ErrPermDenied) || r.Status != ErrPermDenied {
+		t.Fatalf("checkresult #expected %v, got %v (%v)", ErrPermDenied, r.Err, r.Status)
+	}
+	if len(r.Stages) != 2 {
+		t.Fatalf("checkresult #expected 2 stages, got %v", r.Stages)
+	}
+	auth := r.Stages[0]
+	if auth.Op != "pam_authenticate" || auth.Flags != Silent || auth.Status != 0 || auth.Err != nil {
+		t.Fatalf("checkresult #unexpected stage: %+v", auth)
+	}
+	if len(auth.Prompts) != 1 || auth.Prompts[0].Style != PromptEchoOn {
+		t.Fatalf("checkresult #unexpected prompts: %v", auth.Prompts)
+	}
+	if r.Stages[1].Op != "pam_acct_mgmt" || len(r.Stages[1].Prompts) != 0 {
+		t.Fatalf("checkresult #unexpected stage: %+v", r.Stages[1])
+	}
+	if r.Duration < auth.Duration {
+		t.Fatalf("checkresult #unexpected duration: %v", r.Duration)
+	}
+}
+
+func TestAuthenticateResult(t *testing.T) {
+	tx, err := StartConfDir("deny-service", "testuser", nil, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	r := tx.AuthenticateResult(0)
+	if r.Status != ErrAuth || len(r.Stages) != 1 {
+		t.Fatalf("authenticateresult #unexpected result: %+v", r)
+	}
+	tx.End()
+	r = tx.AcctMgmtResult(0)
+	if r.Status != ErrSystem || !errors.Is(r.Err, ErrTransactionClosed) {
+		t.Fatalf("acctmgmtresult #unexpected result: %+v", r)
+	}
+}
@@ -0,0 +1,51 @@
+package pam
+
+//#include <security/pam_appl.h>
+import "C"
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNothingToResume is returned by Resume when the last operation of the
+// transaction was not left incomplete.
+var ErrNothingToResume = errors.New("pam: no incomplete operation to resume")
+
+// pendingOp is an operation that was left incomplete.
+type pendingOp struct {
+	op         string
+	f, allowed Flags
+	fn         func() C.int
+}
+
+// setPending records the operation to be resumed if err is ErrIncomplete or
+// ErrConvAgain.
+func (t *Transaction) setPending(p *pendingOp, err error) {
+	if !errors.Is(err, ErrIncomplete) && !errors.Is(err, ErrConvAgain) {
+		p = nil
+	}
+	t.historyMu.Lock()
+	t.pending = p
+	t.historyMu.Unlock()
+}
+
+// Resume calls again the operation, such as Authenticate, that returned
+// ErrIncomplete, with the same flags, so that the modules continue where
+// they stopped.
+//
+// A conversation handler that can not answer right away returns ErrConvAgain:
+// the modules supporting it then return ErrIncomplete instead of failing,
+// and the application resumes the operation once the answer is available.
+// Some modules, such as pam_succeed_if, pass ErrConvAgain on instead: the
+// operation can be resumed as well, the stack is then run from the start.
+// This allows event loop based applications to drive PAM without blocking.
+func (t *Transaction) Resume() error {
+	t.historyMu.Lock()
+	p := t.pending
+	t.historyMu.Unlock()
+	if p == nil {
+		return ErrNothingToResume
+	}
+	return t.call(context.Background(), p.op, p.f, p.allowed, p.fn)
+}
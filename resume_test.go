@@ -0,0 +1,38 @@
+package pam
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	calls := 0
+	tx, err := StartConfDir("succeed-if-user-test", "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			calls++
+			if calls == 1 {
+				return "", ErrConvAgain
+			}
+			return "testuser", nil
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Resume(); !errors.Is(err, ErrNothingToResume) {
+		t.Fatalf("resume #expected %v, got %v", ErrNothingToResume, err)
+	}
+	// pam_succeed_if passes the conversation status on.
+	if err := tx.Authenticate(0); !errors.Is(err, ErrIncomplete) && !errors.Is(err, ErrConvAgain) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrIncomplete, err)
+	}
+	if err := tx.Resume(); err != nil {
+		t.Fatalf("resume #error: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("resume #expected 2 calls, got %d", calls)
+	}
+	if err := tx.Resume(); !errors.Is(err, ErrNothingToResume) {
+		t.Fatalf("resume #expected %v, got %v", ErrNothingToResume, err)
+	}
+}
@@ -0,0 +1,101 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy configures RetryingAuthenticate.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, 3 if zero.
+	MaxAttempts int
+	// Backoff returns the time to wait after the failed attempt, numbered
+	// from 1, if not nil.
+	Backoff func(attempt int) time.Duration
+	// OnFailure is called after each failed attempt, if not nil.
+	OnFailure func(attempt int, err error)
+}
+
+// attemptKey is the context key of the attempt number.
+type attemptKey struct{}
+
+// AttemptFromContext returns the number, starting from 1, of the attempt of
+// RetryingAuthenticate the ContextConversationHandler receiving ctx answers
+// for. It returns false outside of RetryingAuthenticate.
+func AttemptFromContext(ctx context.Context) (int, bool) {
+	n, ok := ctx.Value(attemptKey{}).(int)
+	return n, ok
+}
+
+// RetryingAuthenticate calls Authenticate with the flags f until it
+// succeeds, prompting again through the conversation handler after each
+// ErrAuth failure, up to the maximum number of attempts of p. It stops on
+// any other error, such as ErrMaxTries or ErrPermDenied. The conversation
+// handler is reset before each new attempt, see ResetConversationHandler,
+// and if the user was not set when it is called, it is unset so that it is
+// asked again, as login does. The last error is returned.
+func RetryingAuthenticate(t *Transaction, f Flags, p RetryPolicy) error {
+	return RetryingAuthenticateContext(context.Background(), t, f, p)
+}
+
+// RetryingAuthenticateContext is like RetryingAuthenticate, but the
+// attempts are performed with AuthenticateContext and the backoff is
+// interrupted once ctx, or the context of the transaction, is done, in
+// which case the error of the context is returned.
+func RetryingAuthenticateContext(ctx context.Context, t *Transaction, f Flags, p RetryPolicy) error {
+	max := p.MaxAttempts
+	if max <= 0 {
+		max = 3
+	}
+	user, err := t.GetItem(User)
+	if err != nil {
+		return err
+	}
+	var done <-chan struct{}
+	if t.state != nil {
+		done = t.state.ctx.Done()
+	}
+	defer t.setAttempt(0)
+	for attempt := 1; ; attempt++ {
+		t.setAttempt(attempt)
+		err = t.AuthenticateContext(ctx, f)
+		if err == nil {
+			return nil
+		}
+		if p.OnFailure != nil {
+			p.OnFailure(attempt, err)
+		}
+		if !errors.Is(err, ErrAuth) || attempt >= max {
+			return err
+		}
+		if p.Backoff != nil {
+			timer := time.NewTimer(p.Backoff(attempt))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return &OpError{Op: "pam_authenticate", Err: ctx.Err()}
+			case <-done:
+				timer.Stop()
+				return &OpError{Op: "pam_authenticate", Err: t.state.ctx.Err()}
+			}
+		}
+		t.ResetConversationHandler()
+		if user == "" {
+			if err := t.unsetItem(User); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// setAttempt sets the attempt number passed to the handlers.
+func (t *Transaction) setAttempt(n int) {
+	if t.state == nil {
+		return
+	}
+	t.state.mu.Lock()
+	t.state.attempt = n
+	t.state.mu.Unlock()
+}
@@ -0,0 +1,119 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"os/user"
+	"testing"
+	"time"
+)
+
+func TestRetryingAuthenticate(t *testing.T) {
+	var seen []int
+	tx, err := StartConfDir("succeed-if-user-test", "", ContextConversationFunc(
+		func(ctx context.Context, s Style, msg string) (string, error) {
+			n, _ := AttemptFromContext(ctx)
+			seen = append(seen, n)
+			if n < 2 {
+				return "wrong", nil
+			}
+			return "testuser", nil
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	var failures []int
+	var backoffs []int
+	err = RetryingAuthenticate(tx, 0, RetryPolicy{
+		Backoff: func(attempt int) time.Duration {
+			backoffs = append(backoffs, attempt)
+			return time.Millisecond
+		},
+		OnFailure: func(attempt int, err error) {
+			failures = append(failures, attempt)
+		},
+	})
+	if err != nil {
+		t.Fatalf("retryingauthenticate #error: %v", err)
+	}
+	if len(seen) != 2 || seen[0] != 1 || seen[1] != 2 {
+		t.Fatalf("retryingauthenticate #unexpected attempts: %v", seen)
+	}
+	if len(failures) != 1 || len(backoffs) != 1 {
+		t.Fatalf("retryingauthenticate #unexpected failures: %v %v", failures, backoffs)
+	}
+}
+
+func TestRetryingAuthenticateLimit(t *testing.T) {
+	calls := 0
+	tx, err := StartConfDir("succeed-if-user-test", "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			calls++
+			return "wrong", nil
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	err = RetryingAuthenticate(tx, 0, RetryPolicy{MaxAttempts: 2})
+	if !errors.Is(err, ErrAuth) || calls != 2 {
+		t.Fatalf("retryingauthenticate #expected %v after 2 calls, got %v after %d", ErrAuth, err, calls)
+	}
+
+	deny, err := StartConfDir("deny-service", "testuser", nil, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer deny.End()
+	attempts := 0
+	err = RetryingAuthenticate(deny, 0, RetryPolicy{OnFailure: func(int, error) { attempts++ }})
+	if !errors.Is(err, ErrAuth) || attempts != 3 {
+		t.Fatalf("retryingauthenticate #expected %v after 3 attempts, got %v after %d", ErrAuth, err, attempts)
+	}
+}
+
+func TestRetryingAuthenticateReset(t *testing.T) {
+	u, _ := user.Current()
+	if u.Uid != "0" {
+		t.Skip("run this test as root")
+	}
+	passwords := []string{"wrong", "secret"}
+	tx, err := Start("", "test", &TwoFactorHandler{
+		Password: func(string) (string, error) {
+			p := passwords[0]
+			passwords = passwords[1:]
+			return p, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.SetFailDelayHandler(func(Error, time.Duration) {}); err != nil {
+		t.Fatalf("setfaildelayhandler #error: %v", err)
+	}
+	if err := RetryingAuthenticate(tx, 0, RetryPolicy{}); err != nil {
+		t.Fatalf("retryingauthenticate #error: %v", err)
+	}
+	if len(passwords) != 0 {
+		t.Fatalf("retryingauthenticate #unexpected passwords left: %v", passwords)
+	}
+}
+
+func TestRetryingAuthenticateContext(t *testing.T) {
+	tx, err := StartConfDir("deny-service", "testuser", nil, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = RetryingAuthenticateContext(ctx, tx, 0, RetryPolicy{
+		Backoff:   func(int) time.Duration { return time.Hour },
+		OnFailure: func(int, error) { cancel() },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("retryingauthenticatecontext #expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,140 @@
+package pam
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// RunAs runs cmd as user, the way su and login like tools do: the user is
+// authenticated through handler, its account is checked (changing an
+// expired token), the credentials are established and a session is opened
+// for service, as Login does. The command then runs with the identity of
+// the user, including the supplementary groups, and with the PAM
+// environment, HOME, USER and LOGNAME set. The session is closed once the
+// command has exited. opts configure the transaction, see StartWithOptions.
+//
+// The privileges are only dropped in the command process, using
+// cmd.SysProcAttr: the calling process must be allowed to change its
+// identity, usually by running as root.
+func RunAs(service, user string, handler ConversationHandler, cmd *exec.Cmd, opts ...StartOption) error {
+	l := &Login{
+		Service:              service,
+		User:                 user,
+		Handler:              handler,
+		Options:              opts,
+		ChangeExpiredAuthtok: true,
+	}
+	s, err := l.Run()
+	if err != nil {
+		return err
+	}
+	err = runAs(s.Transaction(), cmd)
+	return errors.Join(err, s.Close())
+}
+
+// runAs runs cmd as the user of t, with its environment.
+func runAs(t *Transaction, cmd *exec.Cmd) error {
+	u, err := t.lookupUser()
+	if err != nil {
+		return err
+	}
+	cred, err := credential(u)
+	if err != nil {
+		return err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = cred
+	base := cmd.Env
+	if base == nil {
+		base = os.Environ()
+	}
+	cmd.Env, err = mergeEnv(base, []string{
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+		"LOGNAME=" + u.Username,
+	}, MergeOverwrite)
+	if err != nil {
+		return err
+	}
+	if err := t.ApplyEnv(cmd, MergeOverwrite); err != nil {
+		return err
+	}
+	return cmd.Run()
+}
+
+// lookupUser returns the account of the user of t.
+func (t *Transaction) lookupUser() (*user.User, error) {
+	name, err := t.GetItem(User)
+	if err != nil {
+		return nil, err
+	}
+	return user.Lookup(name)
+}
+
+// Credential returns the identity of the user of the transaction, as found
+// by looking PAM_USER up, including its supplementary groups. It is meant to
+// be used in syscall.SysProcAttr to start processes as the user once the
+// account has been checked and the session opened.
+func (t *Transaction) Credential() (*syscall.Credential, error) {
+	u, err := t.lookupUser()
+	if err != nil {
+		return nil, err
+	}
+	return credential(u)
+}
+
+// DropPrivileges makes the current process run as the user of the
+// transaction, see Credential: the supplementary groups are set first, then
+// the group and finally the user, so that the process keeps no privilege
+// of its previous identity. The change applies to all the threads and can
+// not be undone: the modules may need the privileges to close the session,
+// so this is meant for processes leaving that to a privileged process.
+func (t *Transaction) DropPrivileges() error {
+	cred, err := t.Credential()
+	if err != nil {
+		return err
+	}
+	groups := make([]int, len(cred.Groups))
+	for i, g := range cred.Groups {
+		groups[i] = int(g)
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return err
+	}
+	if err := syscall.Setgid(int(cred.Gid)); err != nil {
+		return err
+	}
+	return syscall.Setuid(int(cred.Uid))
+}
+
+// credential returns the credential of the user u, with its supplementary
+// groups.
+func credential(u *user.User) (*syscall.Credential, error) {
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	for _, id := range ids {
+		g, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		cred.Groups = append(cred.Groups, uint32(g))
+	}
+	return cred, nil
+}
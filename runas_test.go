@@ -0,0 +1,99 @@
+package pam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRunAs(t *testing.T) {
+	u, _ := user.Current()
+	if u.Uid != "0" {
+		t.Skip("run this test as root")
+	}
+	test, err := user.Lookup("test")
+	if err != nil {
+		t.Skipf("lookup #error: %v", err)
+	}
+	var out bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", "id -u; echo $USER")
+	cmd.Stdout = &out
+	err = RunAs("login-service", "test", nil, cmd, WithConfDir("test-services"))
+	if err != nil {
+		t.Fatalf("runas #error: %v", err)
+	}
+	if got := strings.Fields(out.String()); len(got) != 2 || got[0] != test.Uid || got[1] != "test" {
+		t.Fatalf("runas #unexpected output: %q", out.String())
+	}
+	err = RunAs("deny-service", "test", nil, exec.Command("/bin/true"), WithConfDir("test-services"))
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("runas #expected %v, got %v", ErrAuth, err)
+	}
+}
+
+func TestCredential(t *testing.T) {
+	test, err := user.Lookup("test")
+	if err != nil {
+		t.Skipf("lookup #error: %v", err)
+	}
+	tx, err := StartConfDir("login-service", "test", nil, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	cred, err := tx.Credential()
+	if err != nil {
+		t.Fatalf("credential #error: %v", err)
+	}
+	if fmt.Sprint(cred.Uid) != test.Uid || fmt.Sprint(cred.Gid) != test.Gid || len(cred.Groups) == 0 {
+		t.Fatalf("credential #unexpected value: %+v", cred)
+	}
+	if err := tx.SetUser("no-such-user-here"); err != nil {
+		t.Fatalf("setuser #error: %v", err)
+	}
+	if _, err := tx.Credential(); err == nil {
+		t.Fatalf("credential #expected an error")
+	}
+}
+
+func TestDropPrivileges(t *testing.T) {
+	if os.Getenv("PAM_TEST_DROP_PRIVILEGES") == "1" {
+		tx, err := StartConfDir("login-service", "test", nil, "test-services")
+		if err != nil {
+			t.Fatalf("start #error: %v", err)
+		}
+		defer tx.End()
+		if err := tx.DropPrivileges(); err != nil {
+			t.Fatalf("dropprivileges #error: %v", err)
+		}
+		fmt.Printf("uid=%d gid=%d\n", os.Getuid(), os.Getgid())
+		if err := syscall.Setuid(0); err == nil {
+			t.Fatalf("setuid #expected an error")
+		}
+		return
+	}
+	u, _ := user.Current()
+	if u.Uid != "0" {
+		t.Skip("run this test as root")
+	}
+	test, err := user.Lookup("test")
+	if err != nil {
+		t.Skipf("lookup #error: %v", err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDropPrivileges$")
+	cmd.Env = append(os.Environ(), "PAM_TEST_DROP_PRIVILEGES=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("dropprivileges #error: %v: %s", err, out)
+	}
+	expected := fmt.Sprintf("uid=%s gid=%s", test.Uid, test.Gid)
+	if !strings.Contains(string(out), expected) {
+		t.Fatalf("dropprivileges #expected %q, got %q", expected, out)
+	}
+}
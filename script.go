@@ -0,0 +1,186 @@
+package pam
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Script is a conversation handler that follows a script of expected
+// messages and replies, as in expect(1):
+//
+//	s := pam.NewScript().
+//		ExpectInfo("Welcome").
+//		Expect("Password:").Reply(password).
+//		FailOnUnexpected()
+//
+// The messages are matched in order against the steps of the script, by
+// substring. A prompt that does not match the next step fails the
+// conversation, as do unexpected TextInfo and ErrorMsg messages if
+// FailOnUnexpected is set, otherwise they are skipped. The failure is
+// available as a *ScriptError from Err.
+type Script struct {
+	mu         sync.Mutex
+	steps      []scriptStep
+	next       int
+	strict     bool
+	transcript []TranscriptEntry
+	err        error
+}
+
+type scriptStep struct {
+	prompt bool
+	style  Style
+	text   string
+	reply  string
+}
+
+// TranscriptEntry is a message received by a Script and its response.
+type TranscriptEntry struct {
+	Message
+	Resp string
+	Err  error
+}
+
+// ScriptError describes how the module deviated from a Script, it matches
+// ErrConv.
+type ScriptError struct {
+	// Step is the index of the step that was expected.
+	Step int
+	// Expected describes the expected message, it is empty if the script
+	// was over.
+	Expected string
+	// Got is the message that was received, it is zero if the module
+	// did not send all the expected messages.
+	Got Message
+}
+
+func (e *ScriptError) Error() string {
+	if e.Got.Style == 0 {
+		return fmt.Sprintf("pam: script: step %d: expected %s, got nothing", e.Step, e.Expected)
+	}
+	if e.Expected == "" {
+		return fmt.Sprintf("pam: script: unexpected %v %q after the end", e.Got.Style, e.Got.Msg)
+	}
+	return fmt.Sprintf("pam: script: step %d: expected %s, got %v %q",
+		e.Step, e.Expected, e.Got.Style, e.Got.Msg)
+}
+
+// Unwrap returns ErrConv.
+func (e *ScriptError) Unwrap() error {
+	return ErrConv
+}
+
+// NewScript returns an empty script.
+func NewScript() *Script {
+	return &Script{}
+}
+
+// Expect adds a step expecting a prompt containing text, of any echo style
+// or RadioType.
+func (s *Script) Expect(text string) *Script {
+	s.steps = append(s.steps, scriptStep{prompt: true, text: text})
+	return s
+}
+
+// Reply sets the reply to the prompt of the last step.
+func (s *Script) Reply(reply string) *Script {
+	if n := len(s.steps); n > 0 {
+		s.steps[n-1].reply = reply
+	}
+	return s
+}
+
+// ExpectInfo adds a step expecting a TextInfo message containing text.
+func (s *Script) ExpectInfo(text string) *Script {
+	s.steps = append(s.steps, scriptStep{style: TextInfo, text: text})
+	return s
+}
+
+// ExpectError adds a step expecting an ErrorMsg message containing text.
+func (s *Script) ExpectError(text string) *Script {
+	s.steps = append(s.steps, scriptStep{style: ErrorMsg, text: text})
+	return s
+}
+
+// FailOnUnexpected makes the conversation fail on TextInfo and ErrorMsg
+// messages that do not match the next step.
+func (s *Script) FailOnUnexpected() *Script {
+	s.strict = true
+	return s
+}
+
+func (st scriptStep) String() string {
+	if st.prompt {
+		return fmt.Sprintf("prompt %q", st.text)
+	}
+	return fmt.Sprintf("%v %q", st.style, st.text)
+}
+
+func (st scriptStep) matches(style Style, msg string) bool {
+	if st.prompt {
+		if !isPrompt(style) {
+			return false
+		}
+	} else if style != st.style {
+		return false
+	}
+	return strings.Contains(msg, st.text)
+}
+
+// RespondPAM replies to the message following the script.
+func (s *Script) RespondPAM(style Style, msg string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, err := s.respond(style, msg)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	s.transcript = append(s.transcript, TranscriptEntry{
+		Message: Message{Style: style, Msg: msg}, Resp: r, Err: err})
+	return r, err
+}
+
+func (s *Script) respond(style Style, msg string) (string, error) {
+	prompt := isPrompt(style)
+	if s.next < len(s.steps) && s.steps[s.next].matches(style, msg) {
+		s.next++
+		return s.steps[s.next-1].reply, nil
+	}
+	if !prompt && !s.strict {
+		return "", nil
+	}
+	e := &ScriptError{Step: s.next, Got: Message{Style: style, Msg: msg}}
+	if s.next < len(s.steps) {
+		e.Expected = s.steps[s.next].String()
+	}
+	return "", e
+}
+
+// Transcript returns the messages received so far and their responses.
+func (s *Script) Transcript() []TranscriptEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]TranscriptEntry(nil), s.transcript...)
+}
+
+// Err returns the first deviation from the script, if any.
+func (s *Script) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Done returns the first deviation from the script or, if the module did not
+// send all the expected messages, a *ScriptError describing the next one.
+func (s *Script) Done() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.next < len(s.steps) {
+		return &ScriptError{Step: s.next, Expected: s.steps[s.next].String()}
+	}
+	return nil
+}
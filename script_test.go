@@ -0,0 +1,68 @@
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	s := NewScript().
+		ExpectInfo("Welcome").
+		Expect("Password:").Reply("secret").
+		Expect("code").Reply("123456")
+	if _, err := s.RespondPAM(TextInfo, "Welcome to the system"); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if _, err := s.RespondPAM(ErrorMsg, "skipped"); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if r, err := s.RespondPAM(PromptEchoOff, "Password: "); err != nil || r != "secret" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+	if err := s.Done(); err == nil {
+		t.Fatalf("done #expected an error")
+	}
+	if r, err := s.RespondPAM(PromptEchoOn, "Verification code: "); err != nil || r != "123456" {
+		t.Fatalf("respondpam #error: %q, %v", r, err)
+	}
+	if err := s.Done(); err != nil {
+		t.Fatalf("done #error: %v", err)
+	}
+	_, err := s.RespondPAM(PromptEchoOff, "Password: ")
+	var se *ScriptError
+	if !errors.As(err, &se) || !errors.Is(err, ErrConv) || se.Step != 3 {
+		t.Fatalf("respondpam #expected a ScriptError, got %v", err)
+	}
+	if tr := s.Transcript(); len(tr) != 5 || tr[2].Resp != "secret" || tr[4].Err == nil {
+		t.Fatalf("transcript #error: unexpected %v", tr)
+	}
+	if s.Err() != err {
+		t.Fatalf("err #error: expected %v, got %v", err, s.Err())
+	}
+}
+
+func TestScriptFailOnUnexpected(t *testing.T) {
+	s := NewScript().Expect("Password:").Reply("secret").FailOnUnexpected()
+	_, err := s.RespondPAM(TextInfo, "Welcome")
+	expected := `pam: script: step 0: expected prompt "Password:", got TextInfo "Welcome"`
+	if err == nil || err.Error() != expected {
+		t.Fatalf("respondpam #expected %v, got %v", expected, err)
+	}
+}
+
+func TestPAM_ConfDir_Script(t *testing.T) {
+	u, _ := user.Current()
+	s := NewScript().ExpectInfo("This is an info message for user " + u.Username).FailOnUnexpected()
+	tx, err := StartConfDir("echo-service", u.Username, s, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := s.Done(); err != nil {
+		t.Fatalf("done #error: %v", err)
+	}
+}
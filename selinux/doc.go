@@ -0,0 +1,29 @@
+// Package selinux sets the SELinux context of the processes started for an
+// authenticated user, as login does in cooperation with pam_selinux. The
+// SELinux support requires libselinux and the selinux build tag; without it
+// the package reports that SELinux is not available.
+package selinux
+
+import (
+	"errors"
+	"os/user"
+
+	"github.com/msteinert/pam"
+)
+
+// ErrNotSupported is returned when SELinux is not supported by the build or
+// not enabled on the system.
+var ErrNotSupported = errors.New("selinux: not supported")
+
+// ContextFor returns the default context of the processes of the user of
+// the transaction, see ExecContext.
+func ContextFor(t pam.TransactionHandle) (string, error) {
+	name, err := t.User()
+	if err != nil {
+		return "", err
+	}
+	if _, err := user.Lookup(name); err != nil {
+		return "", err
+	}
+	return ExecContext(name)
+}
@@ -0,0 +1,74 @@
+//go:build linux && selinux
+
+package selinux
+
+//#cgo LDFLAGS: -lselinux
+//#include <selinux/selinux.h>
+//#include <selinux/get_context_list.h>
+//#include <stdlib.h>
+import "C"
+
+import (
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Enabled returns whether SELinux is enabled on the system.
+func Enabled() bool {
+	return C.is_selinux_enabled() > 0
+}
+
+// ExecContext returns the default context of the processes of the Linux
+// user name, derived from its SELinux user and level as seen by
+// getseuserbyname.
+func ExecContext(name string) (string, error) {
+	if !Enabled() {
+		return "", ErrNotSupported
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	var seuser, level *C.char
+	if r, err := C.getseuserbyname(cname, &seuser, &level); r != 0 {
+		return "", failed(err)
+	}
+	defer C.free(unsafe.Pointer(seuser))
+	defer C.free(unsafe.Pointer(level))
+	var con *C.char
+	if r, err := C.get_default_context_with_level(seuser, level, nil, &con); r != 0 {
+		return "", failed(err)
+	}
+	defer C.freecon(con)
+	return C.GoString(con), nil
+}
+
+// Start starts cmd with the SELinux context con, as setexeccon does for the
+// next exec. The exec context is per thread: it is set on a locked thread
+// for the time needed to start cmd. An empty context starts cmd with the
+// default transition.
+func Start(cmd *exec.Cmd, con string) error {
+	if con == "" {
+		return cmd.Start()
+	}
+	if !Enabled() {
+		return ErrNotSupported
+	}
+	ccon := C.CString(con)
+	defer C.free(unsafe.Pointer(ccon))
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if r, err := C.setexeccon(ccon); r != 0 {
+		return failed(err)
+	}
+	defer C.setexeccon(nil)
+	return cmd.Start()
+}
+
+// failed returns the errno of a failed libselinux call, which may be unset.
+func failed(err error) error {
+	if err == nil {
+		return syscall.EINVAL
+	}
+	return err
+}
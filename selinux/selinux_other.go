@@ -0,0 +1,28 @@
+//go:build !linux || !selinux
+
+package selinux
+
+import (
+	"os/exec"
+)
+
+// Enabled returns whether SELinux is enabled on the system, it is always
+// false without the selinux build tag.
+func Enabled() bool {
+	return false
+}
+
+// ExecContext returns the default context of the processes of the Linux
+// user name, it returns ErrNotSupported without the selinux build tag.
+func ExecContext(name string) (string, error) {
+	return "", ErrNotSupported
+}
+
+// Start starts cmd with the SELinux context con. Without the selinux build
+// tag, only an empty context is supported.
+func Start(cmd *exec.Cmd, con string) error {
+	if con != "" {
+		return ErrNotSupported
+	}
+	return cmd.Start()
+}
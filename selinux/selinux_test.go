@@ -0,0 +1,42 @@
+package selinux
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestContextFor(t *testing.T) {
+	tx, err := pam.StartConfDir("permit-service", "root", nil, "../test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	con, err := ContextFor(tx)
+	if !Enabled() {
+		if !errors.Is(err, ErrNotSupported) {
+			t.Fatalf("contextfor #expected %v, got %v", ErrNotSupported, err)
+		}
+		return
+	}
+	if err != nil || con == "" {
+		t.Fatalf("contextfor #error: %q, %v", con, err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	cmd := exec.Command("/bin/true")
+	if err := Start(cmd, ""); err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("wait #error: %v", err)
+	}
+	if !Enabled() {
+		if err := Start(exec.Command("/bin/true"), "user_u:user_r:user_t:s0"); !errors.Is(err, ErrNotSupported) {
+			t.Fatalf("start #expected %v, got %v", ErrNotSupported, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package pam
+
+import "context"
+
+// StreamingHandler is a conversation handler delivering the TextInfo and
+// ErrorMsg messages asynchronously on a channel, so that progress messages
+// such as "Place your finger on the reader" can be displayed while the
+// operation is still running. Prompts are answered by Handler.
+type StreamingHandler struct {
+	// Handler answers the prompts, they fail with ErrConv if nil.
+	Handler  ConversationHandler
+	messages chan Message
+}
+
+// NewStreamingHandler returns a StreamingHandler answering the prompts with
+// h, that can queue up to buffer messages before blocking the conversation.
+func NewStreamingHandler(h ConversationHandler, buffer int) *StreamingHandler {
+	return &StreamingHandler{Handler: h, messages: make(chan Message, buffer)}
+}
+
+// Messages returns the channel where the messages are delivered.
+func (s *StreamingHandler) Messages() <-chan Message {
+	return s.messages
+}
+
+// RespondPAM queues the messages and passes the prompts to the handler.
+func (s *StreamingHandler) RespondPAM(style Style, msg string) (string, error) {
+	return s.RespondPAMContext(context.Background(), style, msg)
+}
+
+// RespondPAMContext queues the messages and passes the prompts to the
+// handler, unless ctx is done before.
+func (s *StreamingHandler) RespondPAMContext(ctx context.Context, style Style, msg string) (string, error) {
+	if style == TextInfo || style == ErrorMsg {
+		select {
+		case s.messages <- Message{Style: style, Msg: msg}:
+			return "", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	if s.Handler == nil {
+		return "", ErrConv
+	}
+	r, err := respondMessage(ctx, s.Handler, Message{Style: style, Msg: msg})
+	return r.Resp, err
+}
+
+// Run runs op, such as a call to Authenticate, in its own goroutine and
+// passes the messages delivered meanwhile to onMessage, in the calling
+// goroutine. It returns the result of op once it is over and all its
+// messages have been passed.
+func (s *StreamingHandler) Run(op func() error, onMessage func(Message)) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- op()
+	}()
+	for {
+		select {
+		case m := <-s.messages:
+			onMessage(m)
+		case err := <-done:
+			for {
+				select {
+				case m := <-s.messages:
+					onMessage(m)
+				default:
+					return err
+				}
+			}
+		}
+	}
+}
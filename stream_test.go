@@ -0,0 +1,51 @@
+package pam
+
+import (
+	"os/user"
+	"testing"
+)
+
+func TestStreamingHandler(t *testing.T) {
+	u, _ := user.Current()
+	s := NewStreamingHandler(nil, 0)
+	tx, err := StartConfDir("echo-service", u.Username, s, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	var got []Message
+	err = s.Run(func() error {
+		return tx.Authenticate(0)
+	}, func(m Message) {
+		got = append(got, m)
+	})
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	msg := "This is an info message for user " + u.Username + " on echo-service"
+	if len(got) != 1 || got[0].Style != TextInfo || got[0].Msg != msg {
+		t.Fatalf("run #unexpected messages: %v", got)
+	}
+	if _, err := s.RespondPAM(PromptEchoOff, "Password: "); err != ErrConv {
+		t.Fatalf("respondpam #expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestStreamingHandlerPrompt(t *testing.T) {
+	s := NewStreamingHandler(ConversationFunc(func(style Style, msg string) (string, error) {
+		return "testuser", nil
+	}), 1)
+	tx, err := StartConfDir("succeed-if-user-test", "", s, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	err = s.Run(func() error {
+		return tx.Authenticate(0)
+	}, func(m Message) {
+		t.Fatalf("run #unexpected message: %v", m)
+	})
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+}
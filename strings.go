@@ -0,0 +1,180 @@
+package pam
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var styleNames = []struct {
+	style Style
+	name  string
+}{
+	{PromptEchoOff, "PromptEchoOff"},
+	{PromptEchoOn, "PromptEchoOn"},
+	{ErrorMsg, "ErrorMsg"},
+	{TextInfo, "TextInfo"},
+	{BinaryPrompt, "BinaryPrompt"},
+	{RadioType, "RadioType"},
+}
+
+// String returns the name of the style, such as "PromptEchoOff".
+func (s Style) String() string {
+	for _, n := range styleNames {
+		if n.style == s {
+			return n.name
+		}
+	}
+	return "Style(" + strconv.Itoa(int(s)) + ")"
+}
+
+// ParseStyle returns the Style matching a name as returned by Style.String.
+func ParseStyle(name string) (Style, error) {
+	for _, n := range styleNames {
+		if n.name == name {
+			return n.style, nil
+		}
+	}
+	return 0, fmt.Errorf("pam: unknown style %q", name)
+}
+
+var itemNames = []struct {
+	item Item
+	name string
+}{
+	{Service, "Service"},
+	{User, "User"},
+	{Tty, "Tty"},
+	{Rhost, "Rhost"},
+	{Authtok, "Authtok"},
+	{Oldauthtok, "Oldauthtok"},
+	{Ruser, "Ruser"},
+	{UserPrompt, "UserPrompt"},
+	{XDisplay, "XDisplay"},
+	{XAuthData, "XAuthData"},
+	{AuthtokType, "AuthtokType"},
+}
+
+// String returns the name of the item, such as "User".
+func (i Item) String() string {
+	for _, n := range itemNames {
+		if n.item == i {
+			return n.name
+		}
+	}
+	return "Item(" + strconv.Itoa(int(i)) + ")"
+}
+
+// ParseItem returns the Item matching a name as returned by Item.String.
+func ParseItem(name string) (Item, error) {
+	for _, n := range itemNames {
+		if n.name == name {
+			return n.item, nil
+		}
+	}
+	return 0, fmt.Errorf("pam: unknown item %q", name)
+}
+
+var flagNames = []struct {
+	flag Flags
+	name string
+}{
+	{Silent, "Silent"},
+	{DisallowNullAuthtok, "DisallowNullAuthtok"},
+	{EstablishCred, "EstablishCred"},
+	{DeleteCred, "DeleteCred"},
+	{ReinitializeCred, "ReinitializeCred"},
+	{RefreshCred, "RefreshCred"},
+	{ChangeExpiredAuthtok, "ChangeExpiredAuthtok"},
+	{DataSilent, "DataSilent"},
+}
+
+// String returns the names of the flags that are set joined by "|", such as
+// "Silent|EstablishCred". Unknown bits are reported in hexadecimal form.
+func (f Flags) String() string {
+	if f == 0 {
+		return "0"
+	}
+	var names []string
+	for _, n := range flagNames {
+		if f&n.flag != 0 {
+			names = append(names, n.name)
+			f &^= n.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#x", int(f)))
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseFlags returns the Flags matching a string as returned by Flags.String.
+func ParseFlags(s string) (Flags, error) {
+	var f Flags
+	if s == "0" || s == "" {
+		return f, nil
+	}
+	for _, name := range strings.Split(s, "|") {
+		found := false
+		for _, n := range flagNames {
+			if n.name == name {
+				f |= n.flag
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		v, err := strconv.ParseInt(name, 0, 0)
+		if err != nil {
+			return 0, fmt.Errorf("pam: unknown flag %q", name)
+		}
+		f |= Flags(v)
+	}
+	return f, nil
+}
+
+var errorNames = map[Error]string{
+	0:                      "PAM_SUCCESS",
+	ErrOpen:                "PAM_OPEN_ERR",
+	ErrSymbol:              "PAM_SYMBOL_ERR",
+	ErrService:             "PAM_SERVICE_ERR",
+	ErrSystem:              "PAM_SYSTEM_ERR",
+	ErrBuf:                 "PAM_BUF_ERR",
+	ErrPermDenied:          "PAM_PERM_DENIED",
+	ErrAuth:                "PAM_AUTH_ERR",
+	ErrCredInsufficient:    "PAM_CRED_INSUFFICIENT",
+	ErrAuthinfoUnavail:     "PAM_AUTHINFO_UNAVAIL",
+	ErrUserUnknown:         "PAM_USER_UNKNOWN",
+	ErrMaxTries:            "PAM_MAXTRIES",
+	ErrNewAuthTokRequired:  "PAM_NEW_AUTHTOK_REQD",
+	ErrAcctExpired:         "PAM_ACCT_EXPIRED",
+	ErrSession:             "PAM_SESSION_ERR",
+	ErrCredUnavail:         "PAM_CRED_UNAVAIL",
+	ErrCredExpired:         "PAM_CRED_EXPIRED",
+	ErrCred:                "PAM_CRED_ERR",
+	ErrNoModuleData:        "PAM_NO_MODULE_DATA",
+	ErrConv:                "PAM_CONV_ERR",
+	ErrAuthTok:             "PAM_AUTHTOK_ERR",
+	ErrAuthTokRecovery:     "PAM_AUTHTOK_RECOVERY_ERR",
+	ErrAuthTokLockBusy:     "PAM_AUTHTOK_LOCK_BUSY",
+	ErrAuthTokDisableAging: "PAM_AUTHTOK_DISABLE_AGING",
+	ErrTryAgain:            "PAM_TRY_AGAIN",
+	ErrIgnore:              "PAM_IGNORE",
+	ErrAbort:               "PAM_ABORT",
+	ErrAuthTokExpired:      "PAM_AUTHTOK_EXPIRED",
+	ErrModuleUnknown:       "PAM_MODULE_UNKNOWN",
+	ErrBadItem:             "PAM_BAD_ITEM",
+	ErrConvAgain:           "PAM_CONV_AGAIN",
+	ErrIncomplete:          "PAM_INCOMPLETE",
+}
+
+// Name returns the symbolic name of the status as defined by PAM, such as
+// "PAM_AUTH_ERR". A zero status is named "PAM_SUCCESS".
+func (status Error) Name() string {
+	if name, ok := errorNames[status]; ok {
+		return name
+	}
+	return "PAM_STATUS(" + strconv.Itoa(int(status)) + ")"
+}
@@ -0,0 +1,82 @@
+package pam
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStyleString(t *testing.T) {
+	for _, s := range []Style{PromptEchoOff, PromptEchoOn, ErrorMsg, TextInfo, BinaryPrompt, RadioType} {
+		p, err := ParseStyle(s.String())
+		if err != nil {
+			t.Fatalf("parsestyle #error: %v", err)
+		}
+		if p != s {
+			t.Fatalf("parsestyle #error: expected %v, got %v", s, p)
+		}
+	}
+	if s := fmt.Sprint(PromptEchoOff); s != "PromptEchoOff" {
+		t.Fatalf("string #error: expected PromptEchoOff, got %v", s)
+	}
+	if s := Style(-1).String(); s != "Style(-1)" {
+		t.Fatalf("string #error: expected Style(-1), got %v", s)
+	}
+	if _, err := ParseStyle("Unknown"); err == nil {
+		t.Fatalf("parsestyle #expected an error")
+	}
+}
+
+func TestItemString(t *testing.T) {
+	for _, i := range []Item{Service, User, Tty, Rhost, Authtok, Oldauthtok, Ruser, UserPrompt,
+		XDisplay, XAuthData, AuthtokType} {
+		p, err := ParseItem(i.String())
+		if err != nil {
+			t.Fatalf("parseitem #error: %v", err)
+		}
+		if p != i {
+			t.Fatalf("parseitem #error: expected %v, got %v", i, p)
+		}
+	}
+	if s := fmt.Sprint(User); s != "User" {
+		t.Fatalf("string #error: expected User, got %v", s)
+	}
+	if _, err := ParseItem("Unknown"); err == nil {
+		t.Fatalf("parseitem #expected an error")
+	}
+}
+
+func TestFlagsString(t *testing.T) {
+	tests := map[Flags]string{
+		0:                            "0",
+		Silent:                       "Silent",
+		Silent | EstablishCred:       "Silent|EstablishCred",
+		ChangeExpiredAuthtok | 0x100: "ChangeExpiredAuthtok|0x100",
+	}
+	for f, name := range tests {
+		if s := f.String(); s != name {
+			t.Fatalf("string #error: expected %v, got %v", name, s)
+		}
+		p, err := ParseFlags(name)
+		if err != nil {
+			t.Fatalf("parseflags #error: %v", err)
+		}
+		if p != f {
+			t.Fatalf("parseflags #error: expected %v, got %v", f, p)
+		}
+	}
+	if _, err := ParseFlags("Silent|Unknown"); err == nil {
+		t.Fatalf("parseflags #expected an error")
+	}
+}
+
+func TestErrorName(t *testing.T) {
+	if s := Error(0).Name(); s != "PAM_SUCCESS" {
+		t.Fatalf("name #error: expected PAM_SUCCESS, got %v", s)
+	}
+	if s := ErrNewAuthTokRequired.Name(); s != "PAM_NEW_AUTHTOK_REQD" {
+		t.Fatalf("name #error: expected PAM_NEW_AUTHTOK_REQD, got %v", s)
+	}
+	if s := Error(1000).Name(); s != "PAM_STATUS(1000)" {
+		t.Fatalf("name #error: expected PAM_STATUS(1000), got %v", s)
+	}
+}
@@ -0,0 +1,216 @@
+package pam
+
+//#include <security/pam_appl.h>
+import "C"
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// executor runs functions on a goroutine locked to a dedicated OS thread.
+type executor struct {
+	calls chan func()
+}
+
+// newExecutor starts an executor. Its thread is destroyed once stopped,
+// since the goroutine exits without unlocking it.
+func newExecutor() *executor {
+	e := &executor{calls: make(chan func())}
+	go func() {
+		runtime.LockOSThread()
+		for fn := range e.calls {
+			fn()
+		}
+	}()
+	return e
+}
+
+// exec runs fn on the executor thread and waits for it to return.
+func (e *executor) exec(fn func()) {
+	done := make(chan struct{})
+	e.calls <- func() {
+		defer close(done)
+		fn()
+	}
+	<-done
+}
+
+// stop terminates the executor, it can be called on a nil executor.
+func (e *executor) stop() {
+	if e != nil {
+		close(e.calls)
+	}
+}
+
+// do performs a libpam call, serialized with the other calls, within the
+// concurrency limits and on the transaction thread if the transaction has
+// one. The call is skipped once the transaction has ended, since the PAM
+// handle has been released.
+//
+// Calls made by a handler while libpam waits for it can not take the lock,
+// which is held by the waiting call: they run on the goroutine waiting for
+// the handler instead, which is on the right thread and blocks no other
+// call. This only applies to the goroutine running the handler, the other
+// goroutines wait for the operation to return as usual.
+func (t *Transaction) do(fn func()) {
+	if cb := t.callback(); cb != nil && cb.run(fn) {
+		return
+	}
+	t.lock()
+	defer t.mu.Unlock()
+	if t.ended {
+		return
+	}
+	defer acquireLimits(t.service)()
+	t.onThread(fn)
+}
+
+// locked runs fn holding the lock serializing the libpam calls, as do does,
+// but on the calling goroutine.
+func (t *Transaction) locked(fn func()) {
+	if t.callback() != nil {
+		fn()
+		return
+	}
+	t.lock()
+	defer t.mu.Unlock()
+	fn()
+}
+
+// lock acquires the lock serializing the libpam calls, panicking with
+// ErrConcurrentUse if it is held and WithConcurrentUseCheck is used.
+func (t *Transaction) lock() {
+	if !t.checkConcurrent {
+		t.mu.Lock()
+	} else if !t.mu.TryLock() {
+		panic(ErrConcurrentUse)
+	}
+}
+
+// onThread runs fn on the transaction thread if the transaction has one.
+func (t *Transaction) onThread(fn func()) {
+	if t.exec == nil {
+		fn()
+		return
+	}
+	t.exec.exec(fn)
+}
+
+// callback returns the callback registered for the calling goroutine if
+// libpam is waiting for it, or nil. The goroutine is only identified while
+// a handler runs, see goid.
+func (t *Transaction) callback() *callback {
+	if t.state == nil || atomic.LoadInt32(&t.state.active) == 0 {
+		return nil
+	}
+	id := goid()
+	if id == 0 {
+		return nil
+	}
+	t.state.mu.Lock()
+	defer t.state.mu.Unlock()
+	return t.state.callbacks[id]
+}
+
+// callback lets a handler perform libpam calls while libpam waits for it.
+type callback struct {
+	// calls are run by the goroutine waiting for the handler, they are
+	// run directly if nil, for handlers running on that goroutine.
+	calls chan func()
+	// done is closed once libpam no longer waits for the handler.
+	done chan struct{}
+}
+
+// newCallback returns a callback run by the goroutine waiting for the
+// handler.
+func newCallback() *callback {
+	return &callback{calls: make(chan func()), done: make(chan struct{})}
+}
+
+// run performs fn for the handler, it returns false if libpam no longer
+// waits for the handler, the call must then be performed as usual.
+func (cb *callback) run(fn func()) bool {
+	if cb.calls == nil {
+		fn()
+		return true
+	}
+	done := make(chan struct{})
+	select {
+	case cb.calls <- func() {
+		defer close(done)
+		fn()
+	}:
+		<-done
+		return true
+	case <-cb.done:
+		return false
+	}
+}
+
+// register makes the calling goroutine use cb for its libpam calls, until
+// the returned function is called.
+func (c *conversation) register(cb *callback) func() {
+	id := goid()
+	if id == 0 {
+		return func() {}
+	}
+	c.mu.Lock()
+	if c.callbacks == nil {
+		c.callbacks = make(map[int64]*callback)
+	}
+	prev, ok := c.callbacks[id]
+	c.callbacks[id] = cb
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if ok {
+			c.callbacks[id] = prev
+		} else {
+			delete(c.callbacks, id)
+		}
+	}
+}
+
+// goid returns the identifier of the calling goroutine, as found in the
+// header of its stack trace, "goroutine 42 [running]:", or 0 if it can not
+// be parsed.
+//
+// The handlers call back into the transaction through its methods, which
+// receive nothing identifying the conversation: the goroutine is the only
+// way to tell the calls of a handler, which must not wait for the lock held
+// by the operation waiting for it, from the calls of other goroutines.
+// Capturing the stack is costly, so it is only done while libpam waits for
+// a handler. No callback is registered nor looked up for the identifier 0,
+// a handler calling back into the transaction would then deadlock.
+func goid() int64 {
+	prefix := []byte("goroutine ")
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	if !bytes.HasPrefix(b, prefix) {
+		return 0
+	}
+	b = b[len(prefix):]
+	i := bytes.IndexByte(b, ' ')
+	if i < 0 {
+		return 0
+	}
+	id, err := strconv.ParseInt(string(b[:i]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// run is like do for calls returning a status, it returns PAM_SYSTEM_ERR
+// if the call was skipped because the transaction has ended.
+func (t *Transaction) run(fn func() C.int) C.int {
+	status := C.int(C.PAM_SYSTEM_ERR)
+	t.do(func() {
+		status = fn()
+	})
+	return status
+}
@@ -14,31 +14,8 @@ int cb_pam_conv(int num_msg, PAM_CONST struct pam_message **msg, struct pam_resp
 	if (num_msg <= 0 || num_msg > PAM_MAX_NUM_MSG)
 		return PAM_CONV_ERR;
 
-	*resp = calloc(num_msg, sizeof **resp);
-	if (!*resp)
-		return PAM_BUF_ERR;
-
-	for (size_t i = 0; i < num_msg; ++i) {
-		struct cbPAMConv_return result = cbPAMConv(msg[i]->msg_style, (char *)msg[i]->msg, (uintptr_t)appdata_ptr);
-		if (result.r1 != PAM_SUCCESS)
-			goto error;
-
-		(*resp)[i].resp = result.r0;
-	}
-
-	return PAM_SUCCESS;
-error:
-	for (size_t i = 0; i < num_msg; ++i) {
-		if ((*resp)[i].resp) {
-			memset((*resp)[i].resp, 0, strlen((*resp)[i].resp));
-			free((*resp)[i].resp);
-		}
-	}
-
-	memset(*resp, 0, num_msg * sizeof *resp);
-	free(*resp);
 	*resp = NULL;
-	return PAM_CONV_ERR;
+	return cbPAMConv(num_msg, (struct pam_message **)msg, resp, (uintptr_t)appdata_ptr);
 }
 
 void init_pam_conv(struct pam_conv *conv, uintptr_t appdata)
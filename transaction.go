@@ -1,4 +1,10 @@
 // Package pam provides a wrapper for the PAM application API.
+//
+// The wrappers of the Linux-PAM libpam_misc library, MiscPasteEnv and
+// MiscSetEnv, are only built with the pam_misc build tag, so that the other
+// programs are not linked with it:
+//
+//	go build -tags pam_misc
 package pam
 
 //#cgo CFLAGS: -Wall -std=c99
@@ -16,16 +22,39 @@ package pam
 //#define BINARY_PROMPT_IS_SUPPORTED 0
 //#endif
 //
+//#ifdef PAM_RADIO_TYPE
+//#define RADIO_TYPE_IS_SUPPORTED 1
+//#else
+//#include <limits.h>
+//#define PAM_RADIO_TYPE (INT_MAX - 1)
+//#define RADIO_TYPE_IS_SUPPORTED 0
+//#endif
+//
+//#ifdef PAM_XDISPLAY
+//#define EXTENDED_ITEMS_ARE_SUPPORTED 1
+//#else
+//#include <limits.h>
+//#define PAM_XDISPLAY (INT_MIN + 11)
+//#define PAM_XAUTHDATA (INT_MIN + 12)
+//#define PAM_AUTHTOK_TYPE (INT_MIN + 13)
+//#define EXTENDED_ITEMS_ARE_SUPPORTED 0
+//#endif
+//
 //void init_pam_conv(struct pam_conv *conv, uintptr_t);
 //int pam_start_confdir(const char *service_name, const char *user, const struct pam_conv *pam_conversation, const char *confdir, pam_handle_t **pamh) __attribute__ ((weak));
 //int check_pam_start_confdir(void);
 import "C"
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"runtime"
 	"runtime/cgo"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -39,27 +68,98 @@ const (
 	PromptEchoOff Style = C.PAM_PROMPT_ECHO_OFF
 	// PromptEchoOn indicates the conversation handler should obtain a
 	// string while echoing text.
-	PromptEchoOn = C.PAM_PROMPT_ECHO_ON
+	PromptEchoOn Style = C.PAM_PROMPT_ECHO_ON
 	// ErrorMsg indicates the conversation handler should display an
 	// error message.
-	ErrorMsg = C.PAM_ERROR_MSG
+	ErrorMsg Style = C.PAM_ERROR_MSG
 	// TextInfo indicates the conversation handler should display some
 	// text.
-	TextInfo = C.PAM_TEXT_INFO
+	TextInfo Style = C.PAM_TEXT_INFO
 	// BinaryPrompt indicates the conversation handler that should implement
 	// the private binary protocol
-	BinaryPrompt = C.PAM_BINARY_PROMPT
+	BinaryPrompt Style = C.PAM_BINARY_PROMPT
+	// RadioType indicates the conversation handler should obtain a
+	// yes/no or multiple-choice response to the message, it is a
+	// Linux-PAM extension, see CheckPamHasRadioType.
+	RadioType Style = C.PAM_RADIO_TYPE
 )
 
 // ConversationHandler is an interface for objects that can be used as
 // conversation callbacks during PAM authentication.
+//
+// The same handler can be used by several transactions running in parallel,
+// it is then called from different goroutines at the same time and must be
+// safe for concurrent use. Handlers keeping per transaction state should
+// implement ConversationHandlerCloner instead.
 type ConversationHandler interface {
 	// RespondPAM receives a message style and a message string. If the
 	// message Style is PromptEchoOff or PromptEchoOn then the function
 	// should return a response string.
+	//
+	// If the returned error is (or wraps) an Error, such as ErrBuf,
+	// ErrConvAgain or ErrAuthinfoUnavail, that status is reported to the
+	// module, otherwise the conversation fails with ErrConv.
 	RespondPAM(Style, string) (string, error)
 }
 
+// ConversationHandlerCloner is implemented by conversation handlers holding
+// the state of a conversation, such as the step of a flow. Each transaction
+// started with, or switched to, such a handler uses its own copy returned
+// by CloneConversationHandler, so that a single handler value can be shared
+// by the transactions.
+type ConversationHandlerCloner interface {
+	ConversationHandler
+	// CloneConversationHandler returns a copy of the handler with a fresh
+	// conversation state.
+	CloneConversationHandler() ConversationHandler
+}
+
+// ConversationHandlerResetter is implemented by conversation handlers whose
+// conversation state can be restarted, such as the step of a flow, so that
+// they can answer a new operation from its start. The handler of a
+// transaction is reset by ResetConversationHandler, which
+// RetryingAuthenticate calls before each new attempt.
+type ConversationHandlerResetter interface {
+	ConversationHandler
+	// Reset restarts the conversation state of the handler.
+	Reset()
+}
+
+// ConversationHandlerWiper is implemented by conversation handlers holding
+// secrets, such as CredentialsHandler, Wipe is called once the transaction
+// using the handler ends.
+type ConversationHandlerWiper interface {
+	ConversationHandler
+	// Wipe clears the secrets held by the handler.
+	Wipe()
+}
+
+// ContextConversationHandler is an interface for conversation handlers that
+// receive a context derived from the one of the transaction, configured
+// using WithContext, so that they can abort a pending prompt. The context is
+// canceled once the conversation is over, including when it is canceled by
+// CancelConversation or when the transaction ends.
+type ContextConversationHandler interface {
+	ConversationHandler
+	// RespondPAMContext is used instead of RespondPAM.
+	RespondPAMContext(context.Context, Style, string) (string, error)
+}
+
+// ContextConversationFunc is an adapter to allow the use of ordinary
+// functions as ContextConversationHandler.
+type ContextConversationFunc func(context.Context, Style, string) (string, error)
+
+// RespondPAM is a conversation callback adapter, it uses a background
+// context.
+func (f ContextConversationFunc) RespondPAM(s Style, msg string) (string, error) {
+	return f(context.Background(), s, msg)
+}
+
+// RespondPAMContext is a conversation callback adapter.
+func (f ContextConversationFunc) RespondPAMContext(ctx context.Context, s Style, msg string) (string, error) {
+	return f(ctx, s, msg)
+}
+
 // BinaryPointer exposes the type used for the data in a binary conversation
 // it represents a pointer to data that is produced by the module and that
 // must be parsed depending on the protocol in use
@@ -71,9 +171,11 @@ type BinaryPointer unsafe.Pointer
 type BinaryConversationHandler interface {
 	ConversationHandler
 	// RespondPAMBinary receives a pointer to the binary message. It's up to
-	// the receiver to parse it according to the protocol specifications.
+	// the receiver to parse it according to the protocol specifications,
+	// see BinaryDecode.
 	// The function can return a byte array that will passed as pointer back
-	// to the module.
+	// to the module, usually a binary message built by BinaryEncode. The
+	// module owns and releases the copy it receives.
 	RespondPAMBinary(BinaryPointer) ([]byte, error)
 }
 
@@ -86,50 +188,407 @@ func (f ConversationFunc) RespondPAM(s Style, msg string) (string, error) {
 	return f(s, msg)
 }
 
+// ConversationsHandler is an interface for objects that can be used as
+// conversation callbacks receiving all the messages of a conversation at
+// once, so that grouped messages, such as an informative line followed by a
+// prompt, can be rendered together. RespondPAMConversations is used instead
+// of RespondPAM and RespondPAMBinary.
+type ConversationsHandler interface {
+	ConversationHandler
+	// RespondPAMConversations receives the messages sent by a module in a
+	// single conversation and returns a response for each one of them, in
+	// the same order.
+	RespondPAMConversations([]Message) ([]Response, error)
+}
+
+// ConversationsFunc is an adapter to allow the use of ordinary functions as
+// ConversationsHandler.
+type ConversationsFunc func([]Message) ([]Response, error)
+
+// RespondPAM is a conversation callback adapter.
+func (f ConversationsFunc) RespondPAM(s Style, msg string) (string, error) {
+	r, err := f([]Message{{Style: s, Msg: msg}})
+	if err != nil {
+		return "", err
+	}
+	if len(r) != 1 {
+		return "", ErrConv
+	}
+	return r[0].Resp, nil
+}
+
+// RespondPAMConversations is a conversation callback adapter.
+func (f ConversationsFunc) RespondPAMConversations(msgs []Message) ([]Response, error) {
+	return f(msgs)
+}
+
+// Message is a message sent by a module through the conversation.
+type Message struct {
+	// Style is the style of the message.
+	Style Style
+	// Msg is the message text.
+	Msg string
+	// Binary is the data of a BinaryPrompt message, it is only valid
+	// during the conversation.
+	Binary BinaryPointer
+}
+
+// Response is the reply of a conversation handler to a Message.
+type Response struct {
+	// Resp is the response to a PromptEchoOff or PromptEchoOn message.
+	Resp string
+	// Binary is the response to a BinaryPrompt message.
+	Binary []byte
+}
+
+// conversation is the state shared between a transaction and its
+// conversation callback, it is referenced by the cgo handle used as PAM
+// appdata.
+type conversation struct {
+	mu        sync.Mutex
+	handler   ConversationHandler
+	collect   bool
+	messages  []Message
+	failDelay FailDelayHandler
+	ctx       context.Context
+	cancel    context.CancelFunc
+	canceled  chan struct{}
+	timeout   time.Duration
+	opCtx     context.Context
+	// active counts the callbacks libpam is waiting for, callbacks are
+	// the callbacks of their goroutines, see Transaction.do.
+	active    int32
+	callbacks map[int64]*callback
+	// appData is passed to the handlers, see SetAppData.
+	appData any
+	// attempt is passed to the handlers, see RetryingAuthenticate.
+	attempt int
+	// record receives all the messages if set, see AuthResult.
+	record func(Message)
+}
+
+// newConversation returns the conversation state of a transaction, its
+// context is derived from ctx, if not nil.
+func newConversation(ctx context.Context, handler ConversationHandler) *conversation {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c := &conversation{handler: handler, canceled: make(chan struct{}, 1)}
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	return c
+}
+
+// respond records the messages if collection is enabled and passes them to
+// the conversation handler.
+func (c *conversation) respond(msgs []Message) ([]Response, error) {
+	atomic.AddInt32(&c.active, 1)
+	defer atomic.AddInt32(&c.active, -1)
+	c.mu.Lock()
+	if c.collect {
+		for _, m := range msgs {
+			if m.Style == ErrorMsg || m.Style == TextInfo {
+				c.messages = append(c.messages, m)
+			}
+		}
+	}
+	if c.record != nil {
+		for _, m := range msgs {
+			c.record(m)
+		}
+	}
+	h := c.handler
+	appData, attempt := c.appData, c.attempt
+	var opDone <-chan struct{}
+	if c.opCtx != nil {
+		opDone = c.opCtx.Done()
+	}
+	c.mu.Unlock()
+	select {
+	case <-c.canceled:
+		return nil, ErrConv
+	case <-c.ctx.Done():
+		return nil, ErrConv
+	case <-opDone:
+		return nil, ErrConv
+	default:
+	}
+	type result struct {
+		responses []Response
+		err       error
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(c.ctx, c.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.ctx)
+	}
+	defer cancel()
+	if appData != nil {
+		ctx = context.WithValue(ctx, appDataKey{}, appData)
+	}
+	if attempt > 0 {
+		ctx = context.WithValue(ctx, attemptKey{}, attempt)
+	}
+	done := make(chan result, 1)
+	cb := newCallback()
+	defer close(cb.done)
+	go func() {
+		defer c.register(cb)()
+		r, err := respond(ctx, h, msgs)
+		done <- result{r, err}
+	}()
+	for {
+		select {
+		case fn := <-cb.calls:
+			fn()
+		case r := <-done:
+			return r.responses, r.err
+		case <-c.canceled:
+			return nil, ErrConv
+		case <-ctx.Done():
+			return nil, ErrConv
+		case <-opDone:
+			return nil, ErrConv
+		}
+	}
+}
+
+// respond passes the messages to the handler, one at a time unless it is a
+// ConversationsHandler.
+func respond(ctx context.Context, h ConversationHandler, msgs []Message) ([]Response, error) {
+	switch cb := h.(type) {
+	case nil:
+		return nil, ErrConv
+	case ConversationsHandler:
+		return cb.RespondPAMConversations(msgs)
+	}
+	responses := make([]Response, len(msgs))
+	for i, m := range msgs {
+		r, err := respondMessage(ctx, h, m)
+		if err != nil {
+			return nil, err
+		}
+		responses[i] = r
+	}
+	return responses, nil
+}
+
+// respondMessage passes a single message to the handler.
+func respondMessage(ctx context.Context, h ConversationHandler, m Message) (Response, error) {
+	if m.Style == BinaryPrompt {
+		cb, ok := h.(BinaryConversationHandler)
+		if !ok {
+			return Response{}, ErrAuthinfoUnavail
+		}
+		bytes, err := cb.RespondPAMBinary(m.Binary)
+		return Response{Binary: bytes}, err
+	}
+	if cb, ok := h.(ContextConversationHandler); ok {
+		r, err := cb.RespondPAMContext(ctx, m.Style, m.Msg)
+		return Response{Resp: r}, err
+	}
+	r, err := h.RespondPAM(m.Style, m.Msg)
+	return Response{Resp: r}, err
+}
+
 // cbPAMConv is a wrapper for the conversation callback function.
 //
 //export cbPAMConv
-func cbPAMConv(s C.int, msg *C.char, c C.uintptr_t) (*C.char, C.int) {
-	var r string
-	var err error
-	v := cgo.Handle(c).Value()
-	style := Style(s)
-	switch cb := v.(type) {
-	case BinaryConversationHandler:
-		if style == BinaryPrompt {
-			bytes, err := cb.RespondPAMBinary(BinaryPointer(msg))
-			if err != nil {
-				return nil, C.PAM_CONV_ERR
-			}
-			return (*C.char)(C.CBytes(bytes)), C.PAM_SUCCESS
+func cbPAMConv(n C.int, msg **C.struct_pam_message, resp **C.struct_pam_response, c C.uintptr_t) C.int {
+	msgs := make([]Message, n)
+	for i, m := range unsafe.Slice(msg, n) {
+		msgs[i].Style = Style(m.msg_style)
+		if msgs[i].Style == BinaryPrompt {
+			msgs[i].Binary = BinaryPointer(m.msg)
 		} else {
-			r, err = cb.RespondPAM(style, C.GoString(msg))
+			msgs[i].Msg = C.GoString(m.msg)
 		}
-	case ConversationHandler:
-		if style == BinaryPrompt {
-			return nil, C.PAM_AUTHINFO_UNAVAIL
-		}
-		r, err = cb.RespondPAM(style, C.GoString(msg))
 	}
+	if c == 0 {
+		return C.PAM_CONV_ERR
+	}
+	state, ok := cgo.Handle(c).Value().(*conversation)
+	if !ok {
+		return C.PAM_CONV_ERR
+	}
+	responses, err := state.respond(msgs)
 	if err != nil {
-		return nil, C.PAM_CONV_ERR
+		return convErrorStatus(err)
+	}
+	if len(responses) != len(msgs) {
+		return C.PAM_CONV_ERR
+	}
+	for _, r := range responses {
+		if checkCString(r.Resp) != nil {
+			return C.PAM_CONV_ERR
+		}
+	}
+	r := (*C.struct_pam_response)(C.calloc(C.size_t(n), C.sizeof_struct_pam_response))
+	if r == nil {
+		return C.PAM_BUF_ERR
 	}
-	return C.CString(r), C.PAM_SUCCESS
+	cr := unsafe.Slice(r, n)
+	for i := range cr {
+		switch {
+		case msgs[i].Style != BinaryPrompt:
+			cr[i].resp = C.CString(responses[i].Resp)
+		case responses[i].Binary != nil:
+			cr[i].resp = (*C.char)(C.CBytes(responses[i].Binary))
+		}
+	}
+	*resp = r
+	return C.PAM_SUCCESS
+}
+
+// convErrorStatus returns the status that the conversation reports to the
+// module when the handler fails with err.
+func convErrorStatus(err error) C.int {
+	var status Error
+	if errors.As(err, &status) && status != 0 {
+		return C.int(status)
+	}
+	return C.PAM_CONV_ERR
 }
 
 // Transaction is the application's handle for a PAM transaction.
+//
+// A transaction can be used by several goroutines, its libpam calls are
+// serialized: a goroutine calling into it while another one is in a PAM
+// operation waits for the operation to complete. The conversation handlers
+// may call back into the transaction while an operation is waiting for
+// them, from the goroutine they are called on. End waits for the running
+// calls, the later ones fail with ErrTransactionClosed.
 type Transaction struct {
-	handle *C.pam_handle_t
-	conv   *C.struct_pam_conv
-	status C.int
-	c      cgo.Handle
+	handle   *C.pam_handle_t
+	conv     *C.struct_pam_conv
+	status   C.int
+	c        cgo.Handle
+	state    *conversation
+	history  []HistoryEntry
+	ended    bool
+	endFlags Flags
+	// native is set for transactions wrapping a handle owned by C code,
+	// nativeConv then holds the conversation to restore when ending it.
+	native     bool
+	nativeConv *C.struct_pam_conv
+	// exec runs the libpam calls when the transaction is pinned to a
+	// thread, see WithLockedOSThread.
+	exec *executor
+	// mu serializes the libpam calls, checkConcurrent makes a concurrent
+	// call panic instead of waiting.
+	mu              sync.Mutex
+	checkConcurrent bool
+	// historyMu protects status, history, appData and pending.
+	historyMu sync.Mutex
+	// historyLimit is the size of the history, DefaultHistoryLimit if
+	// zero, the history is disabled if negative.
+	historyLimit int
+	// service is the service the transaction was started with, it selects
+	// the concurrency limit, see SetConcurrencyLimit.
+	service string
+	// watchdog settings, abandoned is set once an operation was abandoned.
+	watchdog       time.Duration
+	watchdogReport WatchdogFunc
+	abandonAfter   time.Duration
+	abandoned      int32
+	// appData is the value set by SetAppData.
+	appData any
+	// pending is the operation to be resumed, see Resume.
+	pending *pendingOp
+}
+
+// HistoryEntry describes a PAM call performed on a transaction.
+type HistoryEntry struct {
+	// Op is the name of the PAM function, such as "pam_authenticate".
+	Op string
+	// Flags are the flags the function was called with.
+	Flags Flags
+	// Status is the status returned by the function, zero on success.
+	Status Error
 }
 
 // transactionFinalizer cleans up the PAM handle and deletes the callback
 // function.
 func transactionFinalizer(t *Transaction) {
-	C.pam_end(t.handle, t.status)
+	if t.ended {
+		return
+	}
+	t.run(func() C.int {
+		return C.pam_end(t.handle, t.status|C.int(t.endFlags))
+	})
 	t.c.Delete()
+	t.exec.stop()
+}
+
+// End terminates the PAM transaction immediately, releasing the PAM handle
+// and the conversation handler, instead of waiting for the garbage
+// collector to do it. The transaction can not be used anymore after this.
+func (t *Transaction) End() error {
+	return t.EndWithFlags(t.endFlags)
+}
+
+// endAllowed are the flags accepted by EndWithFlags.
+const endAllowed = Silent | DataSilent
+
+// EndWithFlags is like End, but the flags are passed to the modules cleanup
+// functions together with the last status. Other flags return
+// ErrInvalidArgument, the transaction is then not ended.
+//
+// Valid flags: Silent, DataSilent
+func (t *Transaction) EndWithFlags(f Flags) error {
+	if err := t.checkEnded("pam_end"); err != nil {
+		return err
+	}
+	if f&^endAllowed != 0 {
+		return &OpError{Op: "pam_end", Args: f.String(),
+			Err: &FlagsError{Flags: f, Allowed: endAllowed}}
+	}
+	var err error
+	ended := false
+	// The handle is released while holding the lock, so that it is never
+	// used by a call running concurrently, such as a CredRefresher one.
+	t.locked(func() {
+		if ended = t.ended; ended {
+			return
+		}
+		t.ended = true
+		if !t.native {
+			status := C.int(C.PAM_SYSTEM_ERR)
+			func() {
+				defer acquireLimits(t.service)()
+				t.onThread(func() {
+					status = C.pam_end(t.handle, C.int(t.Status())|C.int(f))
+				})
+			}()
+			err = t.handlePamStatus(status, "pam_end", f)
+		} else if t.nativeConv != nil {
+			var status C.int
+			t.onThread(func() {
+				status = C.pam_set_item(t.handle, C.PAM_CONV, unsafe.Pointer(t.nativeConv))
+			})
+			err = t.handlePamStatus(status, "pam_set_item", "PAM_CONV")
+		}
+		t.exec.stop()
+		t.handle = nil
+	})
+	if ended {
+		return &OpError{Op: "pam_end", Err: ErrTransactionClosed}
+	}
+	runtime.SetFinalizer(t, nil)
+	if t.c != 0 {
+		t.c.Delete()
+	}
+	if t.state != nil {
+		t.state.mu.Lock()
+		h := t.state.handler
+		t.state.mu.Unlock()
+		if w, ok := h.(ConversationHandlerWiper); ok {
+			w.Wipe()
+		}
+		t.state.cancel()
+	}
+	return err
 }
 
 // Start initiates a new PAM transaction. Service is treated identically to
@@ -137,8 +596,12 @@ func transactionFinalizer(t *Transaction) {
 //
 // All application calls to PAM begin with Start*. The returned
 // transaction provides an interface to the remainder of the API.
+//
+// The handler can be nil for transactions that should never prompt, such as
+// the ones only used for account or session management: any conversation
+// attempted by the modules then fails with ErrConv.
 func Start(service, user string, handler ConversationHandler) (*Transaction, error) {
-	return start(service, user, handler, "")
+	return start(service, user, handler, &startOptions{})
 }
 
 // StartFunc registers the handler func as a conversation handler.
@@ -154,26 +617,55 @@ func StartFunc(service, user string, handler func(Style, string) (string, error)
 // All application calls to PAM begin with Start*. The returned
 // transaction provides an interface to the remainder of the API.
 func StartConfDir(service, user string, handler ConversationHandler, confDir string) (*Transaction, error) {
-	if !CheckPamHasStartConfdir() {
-		return nil, errors.New("StartConfDir() was used, but the pam version on the system is not recent enough")
-	}
-
-	return start(service, user, handler, confDir)
+	return StartWithOptions(service, user, handler, WithConfDir(confDir))
 }
 
-func start(service, user string, handler ConversationHandler, confDir string) (*Transaction, error) {
-	switch handler.(type) {
-	case BinaryConversationHandler:
-		if !CheckPamHasBinaryProtocol() {
-			return nil, errors.New("BinaryConversationHandler() was used, but it is not supported by this platform")
+func start(service, user string, handler ConversationHandler, o *startOptions) (*Transaction, error) {
+	if o.confDir != "" && !CheckPamHasStartConfdir() {
+		return nil, errors.New("StartConfDir() was used, but the pam version on the system is not recent enough")
+	}
+	for _, s := range []string{service, user, o.confDir} {
+		if err := checkCString(s); err != nil {
+			return nil, &OpError{Op: "pam_start", Args: service, Err: err}
 		}
 	}
+	if o.endFlags&^endAllowed != 0 {
+		return nil, &OpError{Op: "pam_start", Args: service,
+			Err: &FlagsError{Flags: o.endFlags, Allowed: endAllowed}}
+	}
+	if err := checkHandler(handler); err != nil {
+		return nil, err
+	}
+	handler = cloneHandler(handler)
 	t := &Transaction{
-		conv: &C.struct_pam_conv{},
-		c:    cgo.NewHandle(handler),
+		conv:     &C.struct_pam_conv{},
+		state:    newConversation(o.ctx, handler),
+		endFlags: o.endFlags,
+		service:  service,
+		// History is kept by default, see WithHistoryLimit.
+		historyLimit: o.historyLimit,
 	}
+	t.state.timeout = o.convTimeout
+	if !o.deadline.IsZero() {
+		ctx, cancel := context.WithDeadline(t.state.ctx, o.deadline)
+		cancelParent := t.state.cancel
+		t.state.ctx = ctx
+		t.state.cancel = func() {
+			cancel()
+			cancelParent()
+		}
+	}
+	t.checkConcurrent = o.checkConcurrent
+	t.watchdog, t.watchdogReport = o.watchdog, o.watchdogReport
+	t.abandonAfter = o.abandonAfter
+	if o.lockOSThread {
+		t.exec = newExecutor()
+	}
+	t.c = cgo.NewHandle(t.state)
 	C.init_pam_conv(t.conv, C.uintptr_t(t.c))
-	runtime.SetFinalizer(t, transactionFinalizer)
+	if !o.noFinalizer {
+		runtime.SetFinalizer(t, transactionFinalizer)
+	}
 	s := C.CString(service)
 	defer C.free(unsafe.Pointer(s))
 	var u *C.char
@@ -181,21 +673,353 @@ func start(service, user string, handler ConversationHandler, confDir string) (*
 		u = C.CString(user)
 		defer C.free(unsafe.Pointer(u))
 	}
-	if confDir == "" {
-		t.status = C.pam_start(s, u, t.conv, &t.handle)
+	if o.confDir == "" {
+		t.status = t.run(func() C.int {
+			return C.pam_start(s, u, t.conv, &t.handle)
+		})
 	} else {
-		c := C.CString(confDir)
+		c := C.CString(o.confDir)
 		defer C.free(unsafe.Pointer(c))
-		t.status = C.pam_start_confdir(s, u, t.conv, c, &t.handle)
+		t.status = t.run(func() C.int {
+			return C.pam_start_confdir(s, u, t.conv, c, &t.handle)
+		})
 	}
-	if t.status != C.PAM_SUCCESS {
-		return nil, t
+	if err := t.handlePamStatus(t.status, "pam_start", service); err != nil {
+		t.End()
+		return nil, err
+	}
+	for _, i := range o.items {
+		if err := t.SetItem(i.item, i.value); err != nil {
+			t.End()
+			return nil, err
+		}
 	}
 	return t, nil
 }
 
+// checkHandler returns an error if handler is not supported by the platform.
+func checkHandler(handler ConversationHandler) error {
+	switch handler.(type) {
+	case BinaryConversationHandler:
+		if !CheckPamHasBinaryProtocol() {
+			return errors.New("BinaryConversationHandler() was used, but it is not supported by this platform")
+		}
+	}
+	return nil
+}
+
+// cloneHandler returns the copy of handler to be used by a transaction if it
+// implements ConversationHandlerCloner, handler otherwise.
+func cloneHandler(handler ConversationHandler) ConversationHandler {
+	if c, ok := handler.(ConversationHandlerCloner); ok {
+		return c.CloneConversationHandler()
+	}
+	return handler
+}
+
+// SetConversationHandler replaces the conversation handler of the
+// transaction, so that a different prompt backend can be used by the next
+// operations. As with Start, the handler can be nil.
+func (t *Transaction) SetConversationHandler(handler ConversationHandler) error {
+	if err := t.checkEnded("pam_set_item"); err != nil {
+		return err
+	}
+	if err := checkHandler(handler); err != nil {
+		return err
+	}
+	return t.setConversationHandler(cloneHandler(handler))
+}
+
+// setConversationHandler installs handler as the conversation handler of the
+// transaction as is, without copying it.
+func (t *Transaction) setConversationHandler(handler ConversationHandler) error {
+	if t.state == nil {
+		return t.installConversation(handler)
+	}
+	t.state.mu.Lock()
+	old := t.state.handler
+	t.state.handler = handler
+	t.state.mu.Unlock()
+	err := t.handlePamStatus(t.run(func() C.int {
+		return C.pam_set_item(t.handle, C.PAM_CONV, unsafe.Pointer(t.conv))
+	}),
+		"pam_set_item", "PAM_CONV")
+	if err != nil {
+		t.state.mu.Lock()
+		t.state.handler = old
+		t.state.mu.Unlock()
+	}
+	return err
+}
+
+// ResetConversationHandler resets the conversation handler of the
+// transaction if it implements ConversationHandlerResetter, so that an
+// operation such as Authenticate can be performed again from the start of
+// the flow. The handler of the transaction is a copy if it implements
+// ConversationHandlerCloner, resetting the original has then no effect.
+func (t *Transaction) ResetConversationHandler() {
+	if t.state == nil {
+		return
+	}
+	t.state.mu.Lock()
+	h := t.state.handler
+	t.state.mu.Unlock()
+	if r, ok := h.(ConversationHandlerResetter); ok {
+		r.Reset()
+	}
+}
+
+// CancelConversation makes the conversation that is currently waiting for
+// the handler, or else the next one, fail with ErrConv, so that an
+// application can abort a pending prompt while an operation such as
+// Authenticate is running in another goroutine.
+//
+// The handler runs in its own goroutine, which keeps running in the
+// background until the handler returns: a ContextConversationHandler, such
+// as ChannelHandler, has its context canceled and should return promptly,
+// but a TTYConversationHandler stays blocked until a line is read. The
+// handlers must not be left blocked forever, or their goroutines pile up.
+func (t *Transaction) CancelConversation() {
+	if t.state == nil {
+		return
+	}
+	select {
+	case t.state.canceled <- struct{}{}:
+	default:
+	}
+}
+
+// String describes the transaction service, its main items and the last
+// status, such as "pam[sshd user=alice status=PAM_SUCCESS]". Authentication
+// tokens are never included. Since Transaction also implements error, fmt
+// prints the Error message instead, String must be called explicitly.
+func (t *Transaction) String() string {
+	var ended bool
+	t.locked(func() {
+		ended = t.ended || t.handle == nil
+	})
+	var b strings.Builder
+	b.WriteString("pam[")
+	if ended || atomic.LoadInt32(&t.abandoned) != 0 {
+		b.WriteString("<ended>")
+	} else {
+		b.WriteString(t.peekItem(Service))
+		for _, i := range []struct {
+			item Item
+			name string
+		}{{User, "user"}, {Tty, "tty"}, {Rhost, "rhost"}, {Ruser, "ruser"}} {
+			if v := t.peekItem(i.item); v != "" {
+				fmt.Fprintf(&b, " %s=%s", i.name, v)
+			}
+		}
+		if t.peekItem(Authtok) != "" {
+			b.WriteString(" authtok=<redacted>")
+		}
+	}
+	fmt.Fprintf(&b, " status=%s]", t.Status().Name())
+	return b.String()
+}
+
+// Error returns the error message of the last PAM call.
+//
+// As Transaction implements error, fmt and the %v verb use this method
+// rather than String, which must be called explicitly.
+//
+// Deprecated: PAM calls return an Error value describing their own status,
+// use that instead.
 func (t *Transaction) Error() string {
-	return C.GoString(C.pam_strerror(t.handle, C.int(t.status)))
+	return t.StrError(t.Status())
+}
+
+// Unwrap returns the Error of the last PAM call, so that a Transaction used
+// as an error can still be matched with errors.Is and errors.As.
+//
+// Deprecated: PAM calls return an Error value describing their own status,
+// use that instead.
+func (t *Transaction) Unwrap() error {
+	if status := t.Status(); status != 0 {
+		return status
+	}
+	return nil
+}
+
+// peekItem returns the value of a string item, without affecting the
+// transaction status.
+func (t *Transaction) peekItem(i Item) string {
+	var s unsafe.Pointer
+	status := t.run(func() C.int {
+		return C.pam_get_item(t.handle, C.int(i), &s)
+	})
+	if status != C.PAM_SUCCESS || s == nil {
+		return ""
+	}
+	return C.GoString((*C.char)(s))
+}
+
+// DefaultHistoryLimit is the number of calls kept by History, unless
+// WithHistoryLimit is used.
+const DefaultHistoryLimit = 64
+
+// History returns the sequence of PAM calls performed on the transaction,
+// in the order they were executed, so that failures in multi-step flows can
+// be reconstructed. Only the last DefaultHistoryLimit calls are kept, see
+// WithHistoryLimit.
+func (t *Transaction) History() []HistoryEntry {
+	t.historyMu.Lock()
+	defer t.historyMu.Unlock()
+	return append([]HistoryEntry(nil), t.history...)
+}
+
+// StrError returns the human readable message describing a PAM status in
+// the context of the transaction, as returned by pam_strerror.
+func (t *Transaction) StrError(status Error) string {
+	var s *C.char
+	t.do(func() {
+		s = C.pam_strerror(t.handle, C.int(status))
+	})
+	if s == nil {
+		return StrError(status)
+	}
+	return C.GoString(s)
+}
+
+// CollectMessages enables or disables the collection of the ErrorMsg and
+// TextInfo messages sent by the modules. When enabled, the messages
+// received while an operation such as Authenticate fails are attached to
+// the returned error as an AuthError, so that the real reason of the
+// failure can be shown to the user. Messages are still passed to the
+// conversation handler.
+func (t *Transaction) CollectMessages(enable bool) {
+	if t.state == nil {
+		return
+	}
+	t.state.mu.Lock()
+	defer t.state.mu.Unlock()
+	t.state.collect = enable
+	t.state.messages = nil
+}
+
+// Status returns the raw status of the last PAM call performed on the
+// transaction. It is zero (PAM_SUCCESS) if the call succeeded.
+func (t *Transaction) Status() Error {
+	t.historyMu.Lock()
+	defer t.historyMu.Unlock()
+	return Error(t.status)
+}
+
+// record adds entry to the history, dropping the oldest entries past the
+// limit. It must be called with historyMu held.
+func (t *Transaction) record(entry HistoryEntry) {
+	limit := t.historyLimit
+	switch {
+	case limit < 0:
+		return
+	case limit == 0:
+		limit = DefaultHistoryLimit
+	}
+	if len(t.history) >= limit {
+		n := copy(t.history, t.history[len(t.history)-limit+1:])
+		t.history = t.history[:n]
+	}
+	t.history = append(t.history, entry)
+}
+
+// handlePamStatus stores the status of a PAM call and converts it to an
+// error describing the operation and its arguments. Unset flags are not
+// reported.
+func (t *Transaction) handlePamStatus(status C.int, op string, args ...any) error {
+	entry := HistoryEntry{Op: op, Status: Error(status)}
+	for _, a := range args {
+		if f, ok := a.(Flags); ok {
+			entry.Flags = f
+		}
+	}
+	t.historyMu.Lock()
+	t.status = status
+	t.record(entry)
+	t.historyMu.Unlock()
+	if status == C.PAM_SUCCESS {
+		return nil
+	}
+	var desc []string
+	for _, a := range args {
+		if f, ok := a.(Flags); ok && f == 0 {
+			continue
+		}
+		desc = append(desc, fmt.Sprint(a))
+	}
+	return &OpError{Op: op, Args: strings.Join(desc, ", "), Err: Error(status)}
+}
+
+// checkEnded returns ErrTransactionClosed for the operation op if the
+// transaction has ended, so that the released PAM handle is never used.
+func (t *Transaction) checkEnded(op string) error {
+	if atomic.LoadInt32(&t.abandoned) != 0 {
+		return &OpError{Op: op, Err: ErrCallAbandoned}
+	}
+	var ended bool
+	t.locked(func() {
+		ended = t.ended
+	})
+	if ended {
+		return &OpError{Op: op, Err: ErrTransactionClosed}
+	}
+	return nil
+}
+
+// call performs the PAM operation op, collecting the messages that the
+// modules send during it if requested. The flags f must be a subset of
+// allowed. The conversations fail once ctx is done, see withContext.
+func (t *Transaction) call(ctx context.Context, op string, f, allowed Flags, fn func() C.int) error {
+	if err := t.checkEnded(op); err != nil {
+		return err
+	}
+	if f&^allowed != 0 {
+		return &OpError{Op: op, Args: f.String(),
+			Err: &FlagsError{Flags: f, Allowed: allowed}}
+	}
+	pending := &pendingOp{op: op, f: f, allowed: allowed, fn: fn}
+	if t.state == nil {
+		err := t.handleOpStatus(op, f, fn)
+		t.setPending(pending, err)
+		return err
+	}
+	if ctx.Done() != nil {
+		call := fn
+		// The context is set by the libpam call itself, which holds the
+		// lock, so that it is never the one of a concurrent operation.
+		fn = func() C.int {
+			defer t.state.setOpContext(ctx)()
+			return call()
+		}
+	}
+	t.state.mu.Lock()
+	t.state.messages = nil
+	t.state.mu.Unlock()
+	err := t.handleOpStatus(op, f, fn)
+	t.setPending(pending, err)
+	t.state.mu.Lock()
+	defer t.state.mu.Unlock()
+	messages := t.state.messages
+	t.state.messages = nil
+	if err == nil || !t.state.collect || len(messages) == 0 {
+		return err
+	}
+	return &AuthError{Err: err, Messages: messages}
+}
+
+// handleOpStatus performs the libpam call of the operation op and handles
+// its status.
+func (t *Transaction) handleOpStatus(op string, f Flags, fn func() C.int) error {
+	status, ok := t.runOp(op, fn)
+	if !ok {
+		err := &OpError{Op: op, Err: ErrCallAbandoned}
+		if f != 0 {
+			err.Args = f.String()
+		}
+		return err
+	}
+	return t.handlePamStatus(status, op, f)
 }
 
 // Item is a an PAM information type.
@@ -206,38 +1030,66 @@ const (
 	// Service is the name which identifies the PAM stack.
 	Service Item = C.PAM_SERVICE
 	// User identifies the username identity used by a service.
-	User = C.PAM_USER
+	User Item = C.PAM_USER
 	// Tty is the terminal name.
-	Tty = C.PAM_TTY
+	Tty Item = C.PAM_TTY
 	// Rhost is the requesting host name.
-	Rhost = C.PAM_RHOST
+	Rhost Item = C.PAM_RHOST
 	// Authtok is the currently active authentication token.
-	Authtok = C.PAM_AUTHTOK
+	Authtok Item = C.PAM_AUTHTOK
 	// Oldauthtok is the old authentication token.
-	Oldauthtok = C.PAM_OLDAUTHTOK
+	Oldauthtok Item = C.PAM_OLDAUTHTOK
 	// Ruser is the requesting user name.
-	Ruser = C.PAM_RUSER
+	Ruser Item = C.PAM_RUSER
 	// UserPrompt is the string use to prompt for a username.
-	UserPrompt = C.PAM_USER_PROMPT
+	UserPrompt Item = C.PAM_USER_PROMPT
+	// XDisplay is the name of the X display, as in the DISPLAY environment
+	// variable. Linux-PAM extension, see CheckPamHasExtendedItems.
+	XDisplay Item = C.PAM_XDISPLAY
+	// XAuthData is the X authentication data used to access the display,
+	// it is not a string so SetXAuthData and GetXAuthData must be used to
+	// access it. Linux-PAM extension, see CheckPamHasExtendedItems.
+	XAuthData Item = C.PAM_XAUTHDATA
+	// AuthtokType is the word used by the modules in the password
+	// prompts instead of "password", such as "LDAP" in "New LDAP
+	// password". Linux-PAM extension, see CheckPamHasExtendedItems.
+	AuthtokType Item = C.PAM_AUTHTOK_TYPE
 )
 
-// SetItem sets a PAM information item.
+// SetItem sets a PAM information item. XAuthData is not a string and
+// returns ErrInvalidArgument, SetXAuthData must be used instead.
 func (t *Transaction) SetItem(i Item, item string) error {
+	if i == XAuthData {
+		return &OpError{Op: "pam_set_item", Args: i.String(), Err: ErrInvalidArgument}
+	}
+	if err := t.checkEnded("pam_set_item"); err != nil {
+		return err
+	}
+	if err := checkCString(item); err != nil {
+		return &OpError{Op: "pam_set_item", Args: fmt.Sprint(i), Err: err}
+	}
 	cs := unsafe.Pointer(C.CString(item))
 	defer C.free(cs)
-	t.status = C.pam_set_item(t.handle, C.int(i), cs)
-	if t.status != C.PAM_SUCCESS {
-		return t
-	}
-	return nil
+	return t.handlePamStatus(t.run(func() C.int {
+		return C.pam_set_item(t.handle, C.int(i), cs)
+	}), "pam_set_item", i)
 }
 
-// GetItem retrieves a PAM information item.
+// GetItem retrieves a PAM information item. XAuthData is not a string and
+// returns ErrInvalidArgument, GetXAuthData must be used instead.
 func (t *Transaction) GetItem(i Item) (string, error) {
+	if i == XAuthData {
+		return "", &OpError{Op: "pam_get_item", Args: i.String(), Err: ErrInvalidArgument}
+	}
+	if err := t.checkEnded("pam_get_item"); err != nil {
+		return "", err
+	}
 	var s unsafe.Pointer
-	t.status = C.pam_get_item(t.handle, C.int(i), &s)
-	if t.status != C.PAM_SUCCESS {
-		return "", t
+	err := t.handlePamStatus(t.run(func() C.int {
+		return C.pam_get_item(t.handle, C.int(i), &s)
+	}), "pam_get_item", i)
+	if err != nil {
+		return "", err
 	}
 	return C.GoString((*C.char)(s)), nil
 }
@@ -253,88 +1105,121 @@ const (
 	Silent Flags = C.PAM_SILENT
 	// DisallowNullAuthtok indicates that authorization should fail
 	// if the user does not have a registered authentication token.
-	DisallowNullAuthtok = C.PAM_DISALLOW_NULL_AUTHTOK
+	DisallowNullAuthtok Flags = C.PAM_DISALLOW_NULL_AUTHTOK
 	// EstablishCred indicates that credentials should be established
 	// for the user.
-	EstablishCred = C.PAM_ESTABLISH_CRED
+	EstablishCred Flags = C.PAM_ESTABLISH_CRED
 	// DeleteCred inidicates that credentials should be deleted.
-	DeleteCred = C.PAM_DELETE_CRED
+	DeleteCred Flags = C.PAM_DELETE_CRED
 	// ReinitializeCred indicates that credentials should be fully
 	// reinitialized.
-	ReinitializeCred = C.PAM_REINITIALIZE_CRED
+	ReinitializeCred Flags = C.PAM_REINITIALIZE_CRED
 	// RefreshCred indicates that the lifetime of existing credentials
 	// should be extended.
-	RefreshCred = C.PAM_REFRESH_CRED
+	RefreshCred Flags = C.PAM_REFRESH_CRED
 	// ChangeExpiredAuthtok indicates that the authentication token
 	// should be changed if it has expired.
-	ChangeExpiredAuthtok = C.PAM_CHANGE_EXPIRED_AUTHTOK
+	ChangeExpiredAuthtok Flags = C.PAM_CHANGE_EXPIRED_AUTHTOK
+	// DataSilent indicates that the modules should not remove the data
+	// they own when the transaction ends, this is used by forked
+	// processes that share the transaction with their parent.
+	DataSilent Flags = C.PAM_DATA_SILENT
 )
 
 // Authenticate is used to authenticate the user.
 //
 // Valid flags: Silent, DisallowNullAuthtok
 func (t *Transaction) Authenticate(f Flags) error {
-	t.status = C.pam_authenticate(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
-	}
-	return nil
+	return t.authenticate(context.Background(), f)
+}
+
+// authenticate performs Authenticate, see withContext.
+func (t *Transaction) authenticate(ctx context.Context, f Flags) error {
+	return t.call(ctx, "pam_authenticate", f, Silent|DisallowNullAuthtok, func() C.int {
+		return C.pam_authenticate(t.handle, C.int(f))
+	})
 }
 
 // SetCred is used to establish, maintain and delete the credentials of a
 // user.
 //
-// Valid flags: EstablishCred, DeleteCred, ReinitializeCred, RefreshCred
+// Valid flags: Silent, and one of EstablishCred, DeleteCred,
+// ReinitializeCred, RefreshCred
 func (t *Transaction) SetCred(f Flags) error {
-	t.status = C.pam_setcred(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
+	return t.setCred(context.Background(), f)
+}
+
+// setCred performs SetCred, see withContext.
+func (t *Transaction) setCred(ctx context.Context, f Flags) error {
+	cred := EstablishCred | DeleteCred | ReinitializeCred | RefreshCred
+	if c := f & cred; c&(c-1) != 0 {
+		return &OpError{Op: "pam_setcred", Args: f.String(),
+			Err: &FlagsError{Flags: f, Allowed: Silent | cred, Exclusive: cred}}
 	}
-	return nil
+	return t.call(ctx, "pam_setcred", f, Silent|cred, func() C.int {
+		return C.pam_setcred(t.handle, C.int(f))
+	})
 }
 
 // AcctMgmt is used to determine if the user's account is valid.
 //
+// If the account is valid but its authentication token has expired, the
+// returned error matches ErrNewAuthTokRequired: applications should then ask
+// the user for a new token using ChangeAuthTok(ChangeExpiredAuthtok), as
+// login(1) does.
+//
 // Valid flags: Silent, DisallowNullAuthtok
 func (t *Transaction) AcctMgmt(f Flags) error {
-	t.status = C.pam_acct_mgmt(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
-	}
-	return nil
+	return t.acctMgmt(context.Background(), f)
+}
+
+// acctMgmt performs AcctMgmt, see withContext.
+func (t *Transaction) acctMgmt(ctx context.Context, f Flags) error {
+	return t.call(ctx, "pam_acct_mgmt", f, Silent|DisallowNullAuthtok, func() C.int {
+		return C.pam_acct_mgmt(t.handle, C.int(f))
+	})
 }
 
 // ChangeAuthTok is used to change the authentication token.
 //
 // Valid flags: Silent, ChangeExpiredAuthtok
 func (t *Transaction) ChangeAuthTok(f Flags) error {
-	t.status = C.pam_chauthtok(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
-	}
-	return nil
+	return t.changeAuthTok(context.Background(), f)
+}
+
+// changeAuthTok performs ChangeAuthTok, see withContext.
+func (t *Transaction) changeAuthTok(ctx context.Context, f Flags) error {
+	return t.call(ctx, "pam_chauthtok", f, Silent|ChangeExpiredAuthtok, func() C.int {
+		return C.pam_chauthtok(t.handle, C.int(f))
+	})
 }
 
 // OpenSession sets up a user session for an authenticated user.
 //
-// Valid flags: Slient
+// Valid flags: Silent
 func (t *Transaction) OpenSession(f Flags) error {
-	t.status = C.pam_open_session(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
-	}
-	return nil
+	return t.openSession(context.Background(), f)
+}
+
+// openSession performs OpenSession, see withContext.
+func (t *Transaction) openSession(ctx context.Context, f Flags) error {
+	return t.call(ctx, "pam_open_session", f, Silent, func() C.int {
+		return C.pam_open_session(t.handle, C.int(f))
+	})
 }
 
 // CloseSession closes a previously opened session.
 //
 // Valid flags: Silent
 func (t *Transaction) CloseSession(f Flags) error {
-	t.status = C.pam_close_session(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
-	}
-	return nil
+	return t.closeSession(context.Background(), f)
+}
+
+// closeSession performs CloseSession, see withContext.
+func (t *Transaction) closeSession(ctx context.Context, f Flags) error {
+	return t.call(ctx, "pam_close_session", f, Silent, func() C.int {
+		return C.pam_close_session(t.handle, C.int(f))
+	})
 }
 
 // PutEnv adds or changes the value of PAM environment variables.
@@ -343,24 +1228,80 @@ func (t *Transaction) CloseSession(f Flags) error {
 // NAME= will set a variable to an empty value.
 // NAME (without an "=") will delete a variable.
 func (t *Transaction) PutEnv(nameval string) error {
+	if err := t.checkEnded("pam_putenv"); err != nil {
+		return err
+	}
+	if err := checkCString(nameval); err != nil {
+		return &OpError{Op: "pam_putenv", Err: err}
+	}
 	cs := C.CString(nameval)
 	defer C.free(unsafe.Pointer(cs))
-	t.status = C.pam_putenv(t.handle, cs)
-	if t.status != C.PAM_SUCCESS {
-		return t
+	return t.handlePamStatus(t.run(func() C.int {
+		return C.pam_putenv(t.handle, cs)
+	}), "pam_putenv",
+		strings.SplitN(nameval, "=", 2)[0])
+}
+
+// SetEnv sets the value of a PAM environment variable. The name must not be
+// empty nor contain "=".
+func (t *Transaction) SetEnv(name, value string) error {
+	if err := t.checkEnded("pam_putenv"); err != nil {
+		return err
 	}
-	return nil
+	if err := checkEnvName(name); err != nil {
+		return &OpError{Op: "pam_putenv", Args: name, Err: err}
+	}
+	return t.PutEnv(name + "=" + value)
+}
+
+// UnsetEnv deletes a PAM environment variable. Deleting a variable that is
+// not set is not an error.
+func (t *Transaction) UnsetEnv(name string) error {
+	if err := t.checkEnded("pam_putenv"); err != nil {
+		return err
+	}
+	if err := checkEnvName(name); err != nil {
+		return &OpError{Op: "pam_putenv", Args: name, Err: err}
+	}
+	if _, ok := t.LookupEnv(name); !ok {
+		return nil
+	}
+	return t.PutEnv(name)
+}
+
+// checkEnvName returns ErrInvalidArgument if name can not be used as the
+// name of an environment variable.
+func checkEnvName(name string) error {
+	if name == "" || strings.IndexByte(name, '=') >= 0 {
+		return ErrInvalidArgument
+	}
+	return checkCString(name)
 }
 
-// GetEnv is used to retrieve a PAM environment variable.
+// GetEnv is used to retrieve a PAM environment variable. It returns an
+// empty string if the variable is not set, see LookupEnv.
 func (t *Transaction) GetEnv(name string) string {
+	value, _ := t.LookupEnv(name)
+	return value
+}
+
+// LookupEnv retrieves a PAM environment variable. If the variable is set the
+// value, which may be empty, is returned and the boolean is true, otherwise
+// the boolean is false.
+func (t *Transaction) LookupEnv(name string) (string, bool) {
+	if checkCString(name) != nil {
+		return "", false
+	}
 	cs := C.CString(name)
 	defer C.free(unsafe.Pointer(cs))
-	value := C.pam_getenv(t.handle, cs)
+	var value *C.char
+	t.do(func() {
+		value = C.pam_getenv(t.handle, cs)
+	})
 	if value == nil {
-		return ""
+		return "", false
 	}
-	return C.GoString(value)
+	return C.GoString(value), true
 }
 
 func next(p **C.char) **C.char {
@@ -369,17 +1310,37 @@ func next(p **C.char) **C.char {
 
 // GetEnvList returns a copy of the PAM environment as a map.
 func (t *Transaction) GetEnvList() (map[string]string, error) {
-	env := make(map[string]string)
-	p := C.pam_getenvlist(t.handle)
-	if p == nil {
-		t.status = C.PAM_BUF_ERR
-		return nil, t
+	list, err := t.Environ()
+	if err != nil {
+		return nil, err
 	}
-	for q := p; *q != nil; q = next(q) {
-		chunks := strings.SplitN(C.GoString(*q), "=", 2)
+	env := make(map[string]string)
+	for _, kv := range list {
+		chunks := strings.SplitN(kv, "=", 2)
 		if len(chunks) == 2 {
 			env[chunks[0]] = chunks[1]
 		}
+	}
+	return env, nil
+}
+
+// Environ returns a copy of the PAM environment as "NAME=value" strings, in
+// the order returned by pam_getenvlist. The result can be used as the Env of
+// an exec.Cmd.
+func (t *Transaction) Environ() ([]string, error) {
+	if err := t.checkEnded("pam_getenvlist"); err != nil {
+		return nil, err
+	}
+	var p **C.char
+	t.do(func() {
+		p = C.pam_getenvlist(t.handle)
+	})
+	if p == nil {
+		return nil, t.handlePamStatus(C.PAM_BUF_ERR, "pam_getenvlist")
+	}
+	env := []string{}
+	for q := p; *q != nil; q = next(q) {
+		env = append(env, C.GoString(*q))
 		C.free(unsafe.Pointer(*q))
 	}
 	C.free(unsafe.Pointer(p))
@@ -391,6 +1352,17 @@ func CheckPamHasStartConfdir() bool {
 	return C.check_pam_start_confdir() == 0
 }
 
+// CheckPamHasExtendedItems return if pam on system supports the Linux-PAM
+// XDisplay, XAuthData and AuthtokType items
+func CheckPamHasExtendedItems() bool {
+	return C.EXTENDED_ITEMS_ARE_SUPPORTED != 0
+}
+
+// CheckPamHasRadioType return if pam on system supports PAM_RADIO_TYPE
+func CheckPamHasRadioType() bool {
+	return C.RADIO_TYPE_IS_SUPPORTED != 0
+}
+
 // CheckPamHasBinaryProtocol return if pam on system supports PAM_BINARY_PROMPT
 func CheckPamHasBinaryProtocol() bool {
 	return C.BINARY_PROMPT_IS_SUPPORTED != 0
@@ -1,8 +1,13 @@
 package pam
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os/user"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -242,6 +247,16 @@ func TestPAM_ConfDir_Deny(t *testing.T) {
 	if len(s) == 0 {
 		t.Fatalf("error #expected an error message")
 	}
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("error #unexpected error %v", err)
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "pam_authenticate" {
+		t.Fatalf("error #expected a pam_authenticate error, got %v", err)
+	}
+	if s != "pam_authenticate: "+ErrAuth.Error() {
+		t.Fatalf("error #unexpected error message %q", s)
+	}
 }
 
 func TestPAM_ConfDir_PromptForUserName(t *testing.T) {
@@ -299,6 +314,9 @@ func TestItem(t *testing.T) {
 	if err != nil {
 		t.Fatalf("getitem #error: %v", err)
 	}
+	if tx.Status() != 0 {
+		t.Fatalf("status #error: expected success, got %v", tx.Status())
+	}
 	if s != "passwd" {
 		t.Fatalf("getitem #error: expected passwd, got %v", s)
 	}
@@ -452,6 +470,10 @@ func TestFailure_008(t *testing.T) {
 	if err == nil {
 		t.Fatalf("getenvlist #expected an error")
 	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "pam_set_item" || opErr.Args != "User" {
+		t.Fatalf("setitem #expected a pam_set_item error, got %v", err)
+	}
 }
 
 func TestFailure_009(t *testing.T) {
@@ -461,3 +483,712 @@ func TestFailure_009(t *testing.T) {
 		t.Fatalf("getenvlist #expected an error")
 	}
 }
+
+func TestFailure_010(t *testing.T) {
+	tx := Transaction{}
+	err := tx.Authenticate(0)
+	if err == nil {
+		t.Fatalf("authenticate #expected an error")
+	}
+	var pamErr Error
+	if !errors.As(err, &pamErr) {
+		t.Fatalf("authenticate #expected a pam.Error, got %#v", err)
+	}
+	if !errors.Is(&tx, pamErr) {
+		t.Fatalf("authenticate #expected transaction to unwrap to %v", pamErr)
+	}
+	if tx.Status() != pamErr {
+		t.Fatalf("status #expected %v, got %v", pamErr, tx.Status())
+	}
+}
+
+func TestPAM_ConfDir_ConvAgain(t *testing.T) {
+	tx, err := StartConfDir("succeed-if-user-test", "",
+		ConversationFunc(func(s Style, msg string) (string, error) {
+			return "", ErrConvAgain
+		}), "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if !errors.Is(err, ErrConvAgain) && !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrConvAgain, err)
+	}
+}
+
+func TestPAM_ConfDir_ConvBufErr(t *testing.T) {
+	tx, err := StartConfDir("succeed-if-user-test", "",
+		ConversationFunc(func(s Style, msg string) (string, error) {
+			return "", fmt.Errorf("no memory: %w", ErrBuf)
+		}), "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if !errors.Is(err, ErrBuf) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrBuf, err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	u, _ := user.Current()
+	tx, err := StartConfDir("permit-service", u.Username, Credentials{}, "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(Silent)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	// The permit-service has no account stack, so this fails.
+	_ = tx.AcctMgmt(0)
+	h := tx.History()
+	if len(h) != 3 {
+		t.Fatalf("history #error: expected 3 entries, got %v", h)
+	}
+	if h[0].Op != "pam_start" || h[0].Status != 0 {
+		t.Fatalf("history #error: unexpected entry %v", h[0])
+	}
+	if h[1].Op != "pam_authenticate" || h[1].Flags != Silent || h[1].Status != 0 {
+		t.Fatalf("history #error: unexpected entry %v", h[1])
+	}
+	if h[2].Op != "pam_acct_mgmt" || h[2].Status != tx.Status() || h[2].Status == 0 {
+		t.Fatalf("history #error: unexpected entry %v", h[2])
+	}
+}
+
+func TestInvalidArgument(t *testing.T) {
+	_, err := StartFunc("passwd\x00", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("start #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.SetItem(Authtok, "secret\x00truncated")
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("setitem #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	err = tx.PutEnv("VAL=1\x002")
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("putenv #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if s := tx.GetEnv("VAL"); s != "" {
+		t.Fatalf("getenv #error: expected \"\", got %v", s)
+	}
+}
+
+func TestPAM_ConfDir_InvalidResponse(t *testing.T) {
+	tx, err := StartConfDir("succeed-if-user-test", "",
+		ConversationFunc(func(s Style, msg string) (string, error) {
+			return "testuser\x00", nil
+		}), "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if !errors.Is(err, ErrConv) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestPAM_ConfDir_CollectMessages(t *testing.T) {
+	u, _ := user.Current()
+	tx, err := StartConfDir("echo-deny-service", u.Username,
+		ConversationFunc(func(s Style, msg string) (string, error) {
+			return "", nil
+		}), "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		t.Fatalf("authenticate #unexpected messages: %v", err)
+	}
+	tx.CollectMessages(true)
+	err = tx.Authenticate(0)
+	if !errors.As(err, &authErr) {
+		t.Fatalf("authenticate #expected an AuthError, got %v", err)
+	}
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrAuth, err)
+	}
+	expected := Message{Style: TextInfo, Msg: "Access denied for user " + u.Username + " on echo-deny-service"}
+	if len(authErr.Messages) != 1 || authErr.Messages[0] != expected {
+		t.Fatalf("authenticate #unexpected messages: %v", authErr.Messages)
+	}
+}
+
+func TestEnd(t *testing.T) {
+	tx, err := StartFunc("", "", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.End()
+	if err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	err = tx.End()
+	if !errors.Is(err, ErrTransactionClosed) {
+		t.Fatalf("end #expected %v, got %v", ErrTransactionClosed, err)
+	}
+	for _, f := range []func() error{
+		func() error { return tx.Authenticate(0) },
+		func() error { return tx.AcctMgmt(0) },
+		func() error { return tx.SetCred(0) },
+		func() error { return tx.ChangeAuthTok(0) },
+		func() error { return tx.OpenSession(0) },
+		func() error { return tx.CloseSession(0) },
+		func() error { return tx.SetItem(User, "test") },
+		func() error { _, err := tx.GetItem(User); return err },
+		func() error { return tx.PutEnv("VAL=1") },
+		func() error { _, err := tx.GetEnvList(); return err },
+		func() error { return tx.SetConversationHandler(nil) },
+	} {
+		if err := f(); !errors.Is(err, ErrTransactionClosed) {
+			t.Fatalf("ended #expected %v, got %v", ErrTransactionClosed, err)
+		}
+	}
+	if s := tx.GetEnv("VAL"); s != "" {
+		t.Fatalf("getenv #error: expected \"\", got %v", s)
+	}
+}
+
+func TestEndWithFlags(t *testing.T) {
+	tx, err := StartFunc("", "", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.EndWithFlags(EstablishCred); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("end #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	err = tx.EndWithFlags(DataSilent)
+	if err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	h := tx.History()
+	if last := h[len(h)-1]; last.Op != "pam_end" || last.Flags != DataSilent {
+		t.Fatalf("history #error: unexpected entry %v", last)
+	}
+	_, err = StartWithOptions("", "", nil, WithEndFlags(DeleteCred))
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("start #expected %v, got %v", ErrInvalidArgument, err)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil, WithHistoryLimit(2))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	for _, tty := range []string{"tty1", "tty2", "tty3"} {
+		if err := tx.SetTty(tty); err != nil {
+			t.Fatalf("settty #error: %v", err)
+		}
+	}
+	_ = tx.SetItem(Item(-1), "")
+	h := tx.History()
+	if len(h) != 2 || h[0].Op != "pam_set_item" || h[1].Status != ErrBadItem {
+		t.Fatalf("history #unexpected: %v", h)
+	}
+	off, err := StartWithOptions("", "", nil, WithHistoryLimit(0))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer off.End()
+	_ = off.SetItem(Item(-1), "")
+	if h := off.History(); len(h) != 0 {
+		t.Fatalf("history #unexpected: %v", h)
+	}
+	if off.Status() != ErrBadItem {
+		t.Fatalf("status #expected %v, got %v", ErrBadItem, off.Status())
+	}
+}
+
+func TestPAM_ConfDir_NoHandler(t *testing.T) {
+	u, _ := user.Current()
+	tx, err := StartConfDir("permit-service", u.Username, nil, "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	tx, err = StartConfDir("succeed-if-user-test", "", nil, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if !errors.Is(err, ErrConv) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestPAM_ConfDir_SetConversationHandler(t *testing.T) {
+	tx, err := StartConfDir("succeed-if-user-test", "", Credentials{User: "wronguser"}, "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.SetConversationHandler(Credentials{User: "testuser"})
+	if err != nil {
+		t.Fatalf("setconversationhandler #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+}
+
+func TestFailure_011(t *testing.T) {
+	tx := Transaction{}
+	err := tx.SetConversationHandler(Credentials{})
+	if err == nil {
+		t.Fatalf("setconversationhandler #expected an error")
+	}
+}
+
+func TestString(t *testing.T) {
+	tx, err := StartWithOptions("passwd", "test", nil, WithRHost("localhost"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	expected := "pam[passwd user=test rhost=localhost status=PAM_SUCCESS]"
+	if s := tx.String(); s != expected {
+		t.Fatalf("string #error: expected %v, got %v", expected, s)
+	}
+	_ = tx.SetItem(Item(-1), "")
+	if h := len(tx.History()); h != 3 {
+		t.Fatalf("history #error: expected 3 entries, got %v", h)
+	}
+	if s := tx.String(); s != strings.Replace(expected, "PAM_SUCCESS", "PAM_BAD_ITEM", 1) {
+		t.Fatalf("string #error: unexpected %v", s)
+	}
+	tx.End()
+	if s := tx.String(); !strings.HasPrefix(s, "pam[<ended>") {
+		t.Fatalf("string #error: unexpected %v", s)
+	}
+}
+
+func TestGoid(t *testing.T) {
+	id := goid()
+	other := make(chan int64)
+	go func() {
+		other <- goid()
+	}()
+	if o := <-other; id == 0 || o == 0 || id == o {
+		t.Fatalf("goid #error: unexpected identifiers %v and %v", id, o)
+	}
+}
+
+func TestStringConcurrentEnd(t *testing.T) {
+	tx, err := StartWithOptions("passwd", "test", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = tx.String()
+			_ = tx.Error()
+		}
+	}()
+	tx.End()
+	<-done
+	if s := tx.String(); !strings.HasPrefix(s, "pam[<ended>") {
+		t.Fatalf("string #error: unexpected %v", s)
+	}
+}
+
+func TestInvalidFlags(t *testing.T) {
+	tx, err := StartWithOptions("passwd", "test", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	var fe *FlagsError
+	err = tx.Authenticate(EstablishCred)
+	if !errors.As(err, &fe) || !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("authenticate #expected a FlagsError, got %v", err)
+	}
+	if fe.Allowed != Silent|DisallowNullAuthtok {
+		t.Fatalf("authenticate #error: unexpected allowed flags %v", fe.Allowed)
+	}
+	err = tx.SetCred(Silent | EstablishCred | DeleteCred)
+	if !errors.As(err, &fe) {
+		t.Fatalf("setcred #expected a FlagsError, got %v", err)
+	}
+	err = tx.OpenSession(ChangeExpiredAuthtok)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("opensession #expected %v, got %v", ErrInvalidArgument, err)
+	}
+	if h := len(tx.History()); h != 1 {
+		t.Fatalf("history #error: expected invalid calls not to reach pam, got %v", tx.History())
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	env, err := tx.Environ()
+	if err != nil {
+		t.Fatalf("environ #error: %v", err)
+	}
+	if env == nil || len(env) != 0 {
+		t.Fatalf("environ #error: expected an empty list, got %v", env)
+	}
+	vals := []string{"VAL2=2", "VAL1=", "VAL3=a=b"}
+	for _, s := range vals {
+		if err := tx.PutEnv(s); err != nil {
+			t.Fatalf("putenv #error: %v", err)
+		}
+	}
+	env, err = tx.Environ()
+	if err != nil {
+		t.Fatalf("environ #error: %v", err)
+	}
+	if strings.Join(env, " ") != strings.Join(vals, " ") {
+		t.Fatalf("environ #error: expected %v, got %v", vals, env)
+	}
+	tx.End()
+	if _, err := tx.Environ(); !errors.Is(err, ErrTransactionClosed) {
+		t.Fatalf("environ #expected %v, got %v", ErrTransactionClosed, err)
+	}
+}
+
+func TestLookupEnv(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.PutEnv("EMPTY="); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	if v, ok := tx.LookupEnv("EMPTY"); !ok || v != "" {
+		t.Fatalf("lookupenv #error: expected an empty value, got %q, %v", v, ok)
+	}
+	if v, ok := tx.LookupEnv("UNSET"); ok {
+		t.Fatalf("lookupenv #error: expected unset, got %q", v)
+	}
+	if _, ok := tx.LookupEnv("EMPTY\x00"); ok {
+		t.Fatalf("lookupenv #error: expected an invalid name to be unset")
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	tx, err := StartWithOptions("", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.SetEnv("KRB5CCNAME", "FILE:/tmp/krb5cc=1"); err != nil {
+		t.Fatalf("setenv #error: %v", err)
+	}
+	if v := tx.GetEnv("KRB5CCNAME"); v != "FILE:/tmp/krb5cc=1" {
+		t.Fatalf("setenv #error: unexpected value %v", v)
+	}
+	if err := tx.SetEnv("EMPTY", ""); err != nil {
+		t.Fatalf("setenv #error: %v", err)
+	}
+	if _, ok := tx.LookupEnv("EMPTY"); !ok {
+		t.Fatalf("setenv #error: expected EMPTY to be set")
+	}
+	for _, name := range []string{"", "A=B", "A\x00"} {
+		err := tx.SetEnv(name, "value")
+		if !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("setenv #expected %v, got %v", ErrInvalidArgument, err)
+		}
+	}
+	if err := tx.UnsetEnv("KRB5CCNAME"); err != nil {
+		t.Fatalf("unsetenv #error: %v", err)
+	}
+	if _, ok := tx.LookupEnv("KRB5CCNAME"); ok {
+		t.Fatalf("unsetenv #error: expected KRB5CCNAME to be unset")
+	}
+	if err := tx.UnsetEnv("KRB5CCNAME"); err != nil {
+		t.Fatalf("unsetenv #error: %v", err)
+	}
+	if err := tx.UnsetEnv("A=B"); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("unsetenv #expected %v, got %v", ErrInvalidArgument, err)
+	}
+}
+
+func TestPAM_ConfDir_ConversationsHandler(t *testing.T) {
+	u, _ := user.Current()
+	var got [][]Message
+	tx, err := StartConfDir("echo-service", u.Username,
+		ConversationsFunc(func(msgs []Message) ([]Response, error) {
+			got = append(got, msgs)
+			return make([]Response, len(msgs)), nil
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	msg := "This is an info message for user " + u.Username + " on echo-service"
+	if len(got) != 1 || len(got[0]) != 1 || got[0][0] != (Message{Style: TextInfo, Msg: msg}) {
+		t.Fatalf("conversation #unexpected messages: %v", got)
+	}
+}
+
+func TestRespond(t *testing.T) {
+	msgs := []Message{
+		{Style: TextInfo, Msg: "Your password will expire"},
+		{Style: PromptEchoOff, Msg: "Password: "},
+	}
+	var seen []string
+	single := ConversationFunc(func(s Style, msg string) (string, error) {
+		seen = append(seen, msg)
+		if s == PromptEchoOff {
+			return "secret", nil
+		}
+		return "", nil
+	})
+	r, err := respond(context.Background(), single, msgs)
+	if err != nil {
+		t.Fatalf("respond #error: %v", err)
+	}
+	if len(r) != 2 || r[1].Resp != "secret" || len(seen) != 2 {
+		t.Fatalf("respond #unexpected responses: %v", r)
+	}
+	batch := ConversationsFunc(func(m []Message) ([]Response, error) {
+		if len(m) != 2 {
+			return nil, ErrConv
+		}
+		return []Response{{}, {Resp: m[0].Msg}}, nil
+	})
+	r, err = respond(context.Background(), batch, msgs)
+	if err != nil {
+		t.Fatalf("respond #error: %v", err)
+	}
+	if r[1].Resp != "Your password will expire" {
+		t.Fatalf("respond #unexpected responses: %v", r)
+	}
+	if _, err := respond(context.Background(), nil, msgs); !errors.Is(err, ErrConv) {
+		t.Fatalf("respond #expected %v, got %v", ErrConv, err)
+	}
+	_, err = respond(context.Background(), single, []Message{{Style: BinaryPrompt}})
+	if !errors.Is(err, ErrAuthinfoUnavail) {
+		t.Fatalf("respond #expected %v, got %v", ErrAuthinfoUnavail, err)
+	}
+	if s, err := batch.RespondPAM(TextInfo, "x"); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #expected %v, got %q, %v", ErrConv, s, err)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	tx, err := StartWithOptions("permit-service", "", nil, WithConfDir("test-services"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := tx.SetItem(Tty, fmt.Sprintf("tty%d", i)); err != nil {
+					t.Errorf("setitem #error: %v", err)
+				}
+				if _, err := tx.GetItem(Tty); err != nil {
+					t.Errorf("getitem #error: %v", err)
+				}
+				_ = tx.History()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentUseCheck(t *testing.T) {
+	tx, err := StartWithOptions("permit-service", "", nil,
+		WithConfDir("test-services"), WithConcurrentUseCheck())
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tx.do(func() {
+			close(entered)
+			<-release
+		})
+	}()
+	<-entered
+	var recovered any
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		_, _ = tx.GetItem(Service)
+	}()
+	close(release)
+	<-done
+	if recovered != ErrConcurrentUse {
+		t.Fatalf("getitem #expected panic %v, got %v", ErrConcurrentUse, recovered)
+	}
+	if _, err := tx.GetItem(Service); err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+}
+
+func TestConcurrentUseCheckConversation(t *testing.T) {
+	var tx *Transaction
+	var recovered any
+	h := ConversationFunc(func(s Style, msg string) (string, error) {
+		// The handler can use the transaction, other goroutines can not.
+		if _, err := tx.GetItem(Service); err != nil {
+			return "", err
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer func() {
+				recovered = recover()
+			}()
+			_, _ = tx.GetItem(Service)
+		}()
+		<-done
+		return "testuser", nil
+	})
+	tx, err := StartWithOptions("succeed-if-user-test", "", h,
+		WithConfDir("test-services"), WithConcurrentUseCheck(), WithLockedOSThread())
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if recovered != ErrConcurrentUse {
+		t.Fatalf("getitem #expected panic %v, got %v", ErrConcurrentUse, recovered)
+	}
+}
+
+func TestParallelTransactions(t *testing.T) {
+	var calls int32
+	shared := ConversationFunc(func(s Style, msg string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "testuser", nil
+	})
+	flow := &TwoFactorHandler{User: "testuser"}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var h ConversationHandler = shared
+			if i%2 == 0 {
+				h = flow
+			}
+			for j := 0; j < 10; j++ {
+				tx, err := StartConfDir("succeed-if-user-test", "", h, "test-services")
+				if err != nil {
+					t.Errorf("start #error: %v", err)
+					return
+				}
+				err = tx.Authenticate(0)
+				tx.End()
+				if err != nil {
+					t.Errorf("authenticate #error: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 80 {
+		t.Fatalf("conversation #expected 80 calls, got %d", n)
+	}
+}
+
+func TestConversationHandlerCloner(t *testing.T) {
+	h := &TwoFactorHandler{User: "testuser"}
+	tx, err := StartConfDir("succeed-if-user-test", "", h, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	c, ok := tx.state.handler.(*TwoFactorHandler)
+	if !ok || c == h || c.User != h.User {
+		t.Fatalf("start #error: handler not cloned: %v", tx.state.handler)
+	}
+	if err := tx.SetConversationHandler(h); err != nil {
+		t.Fatalf("setconversationhandler #error: %v", err)
+	}
+	if tx.state.handler == ConversationHandler(h) {
+		t.Fatalf("setconversationhandler #error: handler not cloned")
+	}
+}
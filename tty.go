@@ -0,0 +1,123 @@
+package pam
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// TTYConversationHandler is a conversation handler for terminal
+// applications, equivalent to misc_conv from libpam_misc. Echo is disabled
+// while reading the responses to PromptEchoOff messages, and the terminal
+// state is restored if the process is interrupted meanwhile. Reads can not
+// be interrupted: after a cancellation or a timeout, the handler keeps
+// waiting for a line in the background, see CancelConversation.
+type TTYConversationHandler struct {
+	// In is the terminal where the responses are read, os.Stdin if nil.
+	In *os.File
+	// Out is where the prompts and TextInfo messages are written,
+	// os.Stdout if nil.
+	Out io.Writer
+	// Err is where the ErrorMsg messages are written, os.Stderr if nil.
+	Err io.Writer
+}
+
+// RespondPAM handles the messages using the terminal.
+func (h *TTYConversationHandler) RespondPAM(s Style, msg string) (string, error) {
+	in, out, errOut := h.In, h.Out, h.Err
+	if in == nil {
+		in = os.Stdin
+	}
+	if out == nil {
+		out = os.Stdout
+	}
+	if errOut == nil {
+		errOut = os.Stderr
+	}
+	switch s {
+	case PromptEchoOn, RadioType:
+		fmt.Fprint(out, msg)
+		return readLine(in)
+	case PromptEchoOff:
+		fmt.Fprint(out, msg)
+		fd := int(in.Fd())
+		if !term.IsTerminal(fd) {
+			return readLine(in)
+		}
+		r, err := readPassword(fd)
+		fmt.Fprintln(out)
+		return r, err
+	case ErrorMsg:
+		fmt.Fprintln(errOut, msg)
+		return "", nil
+	case TextInfo:
+		fmt.Fprintln(out, msg)
+		return "", nil
+	}
+	return "", ErrConv
+}
+
+// readPassword reads a line from the terminal fd without echo, restoring
+// the terminal state before the process is terminated by a signal.
+func readPassword(fd int) (string, error) {
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", err
+	}
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		select {
+		case sig := <-sigs:
+			_ = term.Restore(fd, state)
+			signal.Stop(sigs)
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				_ = p.Signal(sig)
+			}
+		case <-done:
+		}
+	}()
+	defer func() {
+		signal.Stop(sigs)
+		close(done)
+	}()
+	b, err := term.ReadPassword(fd)
+	defer wipe(b)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// readLine reads a line from in, one byte at a time so that nothing past the
+// line is consumed.
+func readLine(in io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := in.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+			continue
+		}
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return string(line), nil
+}
@@ -0,0 +1,40 @@
+package pam
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestTTYConversationHandler(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe #error: %v", err)
+	}
+	defer r.Close()
+	if _, err := w.WriteString("test\nsecret\r\n"); err != nil {
+		t.Fatalf("write #error: %v", err)
+	}
+	w.Close()
+	var out, errOut bytes.Buffer
+	h := &TTYConversationHandler{In: r, Out: &out, Err: &errOut}
+	if s, err := h.RespondPAM(PromptEchoOn, "login: "); err != nil || s != "test" {
+		t.Fatalf("respondpam #error: %q, %v", s, err)
+	}
+	if s, err := h.RespondPAM(PromptEchoOff, "Password: "); err != nil || s != "secret" {
+		t.Fatalf("respondpam #error: %q, %v", s, err)
+	}
+	if _, err := h.RespondPAM(TextInfo, "Welcome"); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if _, err := h.RespondPAM(ErrorMsg, "Sorry"); err != nil {
+		t.Fatalf("respondpam #error: %v", err)
+	}
+	if out.String() != "login: Password: Welcome\n" || errOut.String() != "Sorry\n" {
+		t.Fatalf("respondpam #error: unexpected output %q, %q", out.String(), errOut.String())
+	}
+	if _, err := h.RespondPAM(PromptEchoOn, "login: "); err != io.EOF {
+		t.Fatalf("respondpam #expected %v, got %v", io.EOF, err)
+	}
+}
@@ -0,0 +1,96 @@
+package pam
+
+//#include <security/pam_appl.h>
+import "C"
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// WatchdogFunc is called when a PAM operation is still running after the
+// duration set by WithWatchdog, elapsed is the time spent in it so far.
+type WatchdogFunc func(op string, elapsed time.Duration)
+
+// WithWatchdog makes the transaction call report, from another goroutine,
+// when an operation such as Authenticate is still running after d, so that
+// daemons can at least alert when a misconfigured module blocks, for
+// instance on an unreachable LDAP server. The operation is not interrupted.
+func WithWatchdog(d time.Duration, report WatchdogFunc) StartOption {
+	return func(o *startOptions) {
+		o.watchdog = d
+		o.watchdogReport = report
+	}
+}
+
+// WithAbandonAfter makes the operations that are still running after d
+// return ErrCallAbandoned, so that the request can be failed.
+//
+// libpam calls can not be interrupted: the abandoned call keeps running in
+// the background, holding its thread and the PAM handle, which are only
+// released once it returns, if ever. The conversations of the transaction
+// are canceled and any further use of it fails with ErrCallAbandoned.
+func WithAbandonAfter(d time.Duration) StartOption {
+	return func(o *startOptions) {
+		o.abandonAfter = d
+	}
+}
+
+// Per call states of an operation that can be abandoned.
+const (
+	callRunning int32 = iota
+	callDone
+	callAbandoned
+)
+
+// runOp performs the libpam call of the operation op under the watchdog of
+// the transaction, it returns false if the call was abandoned.
+func (t *Transaction) runOp(op string, fn func() C.int) (C.int, bool) {
+	if t.watchdog > 0 && t.watchdogReport != nil {
+		start := time.Now()
+		timer := time.AfterFunc(t.watchdog, func() {
+			t.watchdogReport(op, time.Since(start))
+		})
+		defer timer.Stop()
+	}
+	if t.abandonAfter <= 0 {
+		return t.run(fn), true
+	}
+	state := callRunning
+	done := make(chan C.int, 1)
+	go func() {
+		status := t.run(fn)
+		if !atomic.CompareAndSwapInt32(&state, callRunning, callDone) {
+			t.release()
+			return
+		}
+		done <- status
+	}()
+	timer := time.NewTimer(t.abandonAfter)
+	defer timer.Stop()
+	select {
+	case status := <-done:
+		return status, true
+	case <-timer.C:
+	}
+	if !atomic.CompareAndSwapInt32(&state, callRunning, callAbandoned) {
+		return <-done, true
+	}
+	atomic.StoreInt32(&t.abandoned, 1)
+	runtime.SetFinalizer(t, nil)
+	if t.state != nil {
+		t.state.cancel()
+	}
+	return 0, false
+}
+
+// release frees the resources of a transaction once its abandoned call has
+// returned.
+func (t *Transaction) release() {
+	t.run(func() C.int {
+		return C.pam_end(t.handle, C.PAM_SUCCESS)
+	})
+	t.c.Delete()
+	t.exec.stop()
+}
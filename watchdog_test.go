@@ -0,0 +1,58 @@
+package pam
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithWatchdog(t *testing.T) {
+	var mu sync.Mutex
+	var ops []string
+	tx, err := StartWithOptions("succeed-if-user-test", "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			time.Sleep(50 * time.Millisecond)
+			return "testuser", nil
+		}), WithConfDir("test-services"),
+		WithWatchdog(10*time.Millisecond, func(op string, elapsed time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			ops = append(ops, op)
+		}))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.End()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ops) != 1 || ops[0] != "pam_authenticate" {
+		t.Fatalf("watchdog #unexpected reports: %v", ops)
+	}
+}
+
+func TestWithAbandonAfter(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	tx, err := StartWithOptions("succeed-if-user-test", "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			<-release
+			return "testuser", nil
+		}), WithConfDir("test-services"), WithAbandonAfter(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if !errors.Is(err, ErrCallAbandoned) {
+		t.Fatalf("authenticate #expected %v, got %v", ErrCallAbandoned, err)
+	}
+	if _, err := tx.GetItem(Service); !errors.Is(err, ErrCallAbandoned) {
+		t.Fatalf("getitem #expected %v, got %v", ErrCallAbandoned, err)
+	}
+	if err := tx.End(); !errors.Is(err, ErrCallAbandoned) {
+		t.Fatalf("end #expected %v, got %v", ErrCallAbandoned, err)
+	}
+}
@@ -0,0 +1,74 @@
+package pam
+
+//#include <security/pam_appl.h>
+//#include <stdlib.h>
+//#include <string.h>
+//
+//#ifndef PAM_XAUTHDATA
+//#include <limits.h>
+//#define PAM_XAUTHDATA (INT_MIN + 12)
+//struct pam_xauth_data {
+//	int namelen;
+//	char *name;
+//	int datalen;
+//	char *data;
+//};
+//#endif
+import "C"
+
+import (
+	"unsafe"
+)
+
+// SetXAuthData sets the X authentication data used to access the display,
+// name is the authentication method (such as "MIT-MAGIC-COOKIE-1") and data
+// its binary payload. Linux-PAM extension, see CheckPamHasExtendedItems.
+func (t *Transaction) SetXAuthData(name string, data []byte) error {
+	if err := t.checkEnded("pam_set_item"); err != nil {
+		return err
+	}
+	if err := checkCString(name); err != nil {
+		return &OpError{Op: "pam_set_item", Args: XAuthData.String(), Err: err}
+	}
+	xauth := (*C.struct_pam_xauth_data)(C.calloc(1, C.sizeof_struct_pam_xauth_data))
+	defer C.free(unsafe.Pointer(xauth))
+	xauth.name = C.CString(name)
+	xauth.namelen = C.int(len(name))
+	defer C.free(unsafe.Pointer(xauth.name))
+	if len(data) > 0 {
+		xauth.data = (*C.char)(C.CBytes(data))
+		xauth.datalen = C.int(len(data))
+		defer func() {
+			C.memset(unsafe.Pointer(xauth.data), 0, C.size_t(xauth.datalen))
+			C.free(unsafe.Pointer(xauth.data))
+		}()
+	}
+	return t.handlePamStatus(t.run(func() C.int {
+		return C.pam_set_item(t.handle, C.PAM_XAUTHDATA, unsafe.Pointer(xauth))
+	}),
+		"pam_set_item", XAuthData)
+}
+
+// GetXAuthData returns the X authentication method name and data, as set by
+// SetXAuthData. Linux-PAM extension, see CheckPamHasExtendedItems.
+func (t *Transaction) GetXAuthData() (name string, data []byte, err error) {
+	if err := t.checkEnded("pam_get_item"); err != nil {
+		return "", nil, err
+	}
+	var p unsafe.Pointer
+	err = t.handlePamStatus(t.run(func() C.int {
+		return C.pam_get_item(t.handle, C.PAM_XAUTHDATA, &p)
+	}),
+		"pam_get_item", XAuthData)
+	if err != nil || p == nil {
+		return "", nil, err
+	}
+	xauth := (*C.struct_pam_xauth_data)(p)
+	if xauth.namelen > 0 && xauth.name != nil {
+		name = C.GoStringN(xauth.name, xauth.namelen)
+	}
+	if xauth.datalen > 0 && xauth.data != nil {
+		data = C.GoBytes(unsafe.Pointer(xauth.data), xauth.datalen)
+	}
+	return name, data, nil
+}